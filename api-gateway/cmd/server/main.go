@@ -4,67 +4,213 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tobey0x/api-gateway/internal/analytics"
 	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/client"
 	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/events"
+	"github.com/tobey0x/api-gateway/internal/flags"
+	"github.com/tobey0x/api-gateway/internal/fieldcrypt"
 	"github.com/tobey0x/api-gateway/internal/handlers"
+	"github.com/tobey0x/api-gateway/internal/links"
+	"github.com/tobey0x/api-gateway/internal/logging"
 	"github.com/tobey0x/api-gateway/internal/middleware"
+	"github.com/tobey0x/api-gateway/internal/netutil"
 	"github.com/tobey0x/api-gateway/internal/queue"
+	"github.com/tobey0x/api-gateway/internal/status"
+	"github.com/tobey0x/api-gateway/internal/webhooks"
 )
 
 
 func main() {
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	// Validated by config.Load, so this cannot fail
+	_ = logging.Setup(cfg.Server.LogLevel)
 
 
 	if cfg.Server.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	// Bind variables as json.Number so large integers keep their precision
+	binding.EnableDecoderUseNumber = true
 
 
+	// Checked by config.Load; the CA bundle and certificate are read again here
+	rabbitMQTLS, err := cfg.RabbitMQ.TLSConfig()
+	if err != nil {
+		log.Fatalf("Failed to load RabbitMQ TLS settings: %v", err)
+	}
 	rabbitMQ, err := queue.NewRabbitMQClient(
-		cfg.RabbitMQ.URL,
+		cfg.RabbitMQ.URLs(),
 		cfg.RabbitMQ.Exchange,
+		cfg.RabbitMQ.FallbackExchange,
 		cfg.RabbitMQ.EmailQueue,
 		cfg.RabbitMQ.PushQueue,
 		cfg.RabbitMQ.FailedQueue,
+		cfg.RabbitMQ.ChannelExchanges,
+		cfg.RabbitMQ.AllowDegraded,
+		cfg.RabbitMQ.AdoptExistingQueues,
+		queue.DialOptions{
+			Heartbeat: cfg.RabbitMQ.Heartbeat(),
+			Locale: cfg.RabbitMQ.Locale,
+			ConnectionName: cfg.RabbitMQ.ConnectionName,
+			TLS: rabbitMQTLS,
+		},
 	)
 	if err != nil {
 		log.Fatalf("Failed to initialize RabbitMQ: %v", err)
 	}
 	defer rabbitMQ.Close()
+	rabbitMQ.SetCompressionThreshold(cfg.RabbitMQ.CompressThresholdBytes)
 
 	redisClient, err := cache.NewRedisClient(cfg.Redis.URL, cfg.Redis.DB)
 	if err != nil {
 		log.Fatalf("Failed to initialize Redis: %v", err)
 	}
 	defer redisClient.Close()
+	if cfg.Redis.ReplicaURL != "" {
+		if err := redisClient.UseReplica(cfg.Redis.ReplicaURL, cfg.Redis.DB); err != nil {
+			log.Fatalf("Failed to initialize Redis replica: %v", err)
+		}
+	}
+
+
+	// One breaker guards every call to the User Service
+	userServiceBreaker := client.NewCircuitBreaker("user_service", cfg.UserService.BreakerThreshold, cfg.UserService.BreakerResetTimeout())
+	userServiceClient := client.NewUserServiceClient(cfg.UserService.URL, userServiceBreaker)
 
+	healthHandler := handlers.NewHealthHandler(rabbitMQ, redisClient, cfg.Health)
+	// Background workers stop when the server shuts down. Shutdown waits
+	// for them, so the deferred Redis and RabbitMQ closes run last.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
 
-	healthHandler := handlers.NewHealthHandler(rabbitMQ, redisClient)
-	notificationHandler := handlers.NewNotificationHandler(rabbitMQ, redisClient)
-	userHandler := handlers.NewUserHandler(cfg.UserService.URL)
+	// Blocks take effect on other instances within the snapshot TTL
+	denylist := cache.NewDenylist(redisClient, 10*time.Second)
+
+	var exporter analytics.Exporter = analytics.NopExporter{}
+	if len(cfg.Kafka.Brokers) > 0 {
+		exporter = analytics.NewKafkaExporter(cfg.Kafka.Brokers, cfg.Kafka.Topic)
+		log.Printf("✓ Exporting notification events to Kafka topic %s", cfg.Kafka.Topic)
+	}
+	defer exporter.Close()
+
+	outbox := queue.NewOutbox(rabbitMQ, redisClient)
+	notificationHandler := handlers.NewNotificationHandler(rabbitMQ, redisClient, outbox, userServiceClient, denylist, exporter, cfg.Notifications)
+	notificationHandler.SetTenantClaim(cfg.RateLimit.TenantClaim)
+	outbox.OnPublished(notificationHandler.MarkPublished)
+	if len(cfg.Encryption.Keys) > 0 {
+		// Validated in config.Validate
+		keyring, err := fieldcrypt.NewKeyring(cfg.Encryption.Keys, cfg.Encryption.ActiveKeyID)
+		if err != nil {
+			log.Fatalf("Invalid variable encryption keys: %v", err)
+		}
+		notificationHandler.SetVariableEncryption(keyring)
+		log.Printf("✓ Sensitive variable encryption enabled (active key %s)", cfg.Encryption.ActiveKeyID)
+	}
+	if cfg.Webhooks.Enabled {
+		emitter := webhooks.NewEmitter(redisClient, cfg.Webhooks.Timeout(), cfg.Webhooks.MaxAttempts, cfg.Webhooks.BaseDelay(), cfg.Webhooks.MaxDelay())
+		notificationHandler.SetWebhookEmitter(emitter)
+		workers.Go(func() { emitter.Run(workerCtx) })
+		log.Printf("✓ Lifecycle webhooks enabled (max %d attempts)", cfg.Webhooks.MaxAttempts)
+	}
+	workers.Go(func() { outbox.Run(workerCtx) })
+
+	if cfg.Retry.SchedulerEnabled {
+		scheduler := queue.NewRetryScheduler(rabbitMQ, redisClient, cfg.Retry.BaseDelay(), cfg.Retry.MaxDelay())
+		scheduler.SetAlertThreshold(cfg.Retry.AlertThreshold)
+		workers.Go(func() { scheduler.Run(workerCtx) })
+		workers.Go(func() {
+			if err := scheduler.ConsumeFailed(workerCtx); err != nil && workerCtx.Err() == nil {
+				log.Printf("Failed-queue consumer stopped: %v", err)
+			}
+		})
+		log.Printf("✓ Retry scheduler started (base delay %s, max %s)", cfg.Retry.BaseDelay(), cfg.Retry.MaxDelay())
+	}
+
+	if cfg.Events.Enabled {
+		startEventsConsumer(workerCtx, &workers, cfg.Events, rabbitMQ, redisClient, notificationHandler)
+	}
+	if cfg.StatusUpdates.Enabled {
+		startStatusConsumer(workerCtx, &workers, cfg.StatusUpdates, rabbitMQ, redisClient, notificationHandler)
+	}
+	adminHandler := handlers.NewAdminHandler(redisClient, denylist, notificationHandler, rabbitMQ)
+	adminHandler.SetBackground(workerCtx, &workers)
+	userHandler := handlers.NewUserHandler(cfg.UserService.URL, redisClient, cfg.Proxy, userServiceBreaker)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(cfg.Auth.JWTSecret, cfg.Auth.AccessSecret, cfg.UserService.URL)
-	rateLimiter := middleware.NewRateLimiter(redisClient, 100, time.Minute)
+	authMiddleware := middleware.NewAuthMiddleware(cfg.Auth.JWTSecret, cfg.Auth.AccessSecret, userServiceClient, cfg.Auth.RequiredClaims, cfg.Auth.ClaimNames, cfg.Auth.ValidationFallback)
+	createNotificationChain := []gin.HandlerFunc{middleware.DecompressGzip(cfg.Server.MaxDecompressedBodyBytes)}
+	if cfg.Server.NotificationSchemaFile != "" {
+		schema, err := middleware.LoadSchema(cfg.Server.NotificationSchemaFile)
+		if err != nil {
+			log.Fatalf("Failed to load notification schema: %v", err)
+		}
+		createNotificationChain = append(createNotificationChain, middleware.ValidateSchema(schema, cfg.Server.MaxDecompressedBodyBytes))
+		log.Printf("✓ Validating notification requests against %s", cfg.Server.NotificationSchemaFile)
+	}
+	createNotificationChain = append(createNotificationChain, notificationHandler.CreateNotifiation)
+
+	identity, err := middleware.NewIdentityResolver(cfg.RateLimit.Identity, cfg.RateLimit.IPv4PrefixBits, cfg.RateLimit.IPv6PrefixBits, cfg.RateLimit.TenantClaim)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limiting: %v", err)
+	}
+	rateLimiter := middleware.NewRateLimiter(redisClient, int64(cfg.RateLimit.MaxRequests), int64(cfg.RateLimit.MaxReadRequests), cfg.RateLimit.Window(), int64(cfg.RateLimit.Burst), identity)
+	rateLimiter.SetStandardHeaders(cfg.RateLimit.StandardHeaders)
+	rateLimiter.SetMaxRetryAfter(cfg.RateLimit.MaxRetryAfter())
+	rateLimiter.SetExcludedPaths(cfg.RateLimit.ExcludedPaths)
 
 	log.Printf("✓ User Service integration configured at: %s", cfg.UserService.URL)
 
-	router := gin.Default()
+	// gin.New, not gin.Default: our own logging and recovery replace gin's,
+	// which would log every request twice
+	router := gin.New()
 
-	// Global middleware
-	router.Use(corsMiddleware())
+	// Global middleware, outermost first
+	router.Use(middleware.RequestID())
+	// Outside Recovery and CORS so panics and preflights are logged too,
+	// with their request ID
 	router.Use(logginMiddleware())
+	// Outside LocalizeErrors so problem details carry translated titles
+	router.Use(middleware.ProblemDetails(cfg.Server.ProblemTypeBaseURI))
+	// Outside Recovery so panics still get a localized 500
+	router.Use(middleware.LocalizeErrors())
+	router.Use(middleware.Recovery())
+	router.Use(corsMiddleware())
+	router.Use(middleware.RequestTimeout(cfg.Server.MaxRequestTimeout()))
+	if len(cfg.Server.DeprecatedRoutes) > 0 {
+		// Validated in config.Validate
+		sunsets, _ := cfg.Server.DeprecatedRouteSunsets()
+		router.Use(middleware.Deprecation(sunsets))
+	}
+
+	// Admin-signed per-request flags for QA; ignored unless configured
+	var featureFlags *flags.Signer
+	if cfg.Auth.FeatureFlagSecret != "" {
+		featureFlags = flags.NewSigner(cfg.Auth.FeatureFlagSecret, cfg.Auth.FeatureFlagTTL())
+		router.Use(middleware.FeatureFlags(featureFlags))
+	}
 
 	// Public routes
 	router.GET("/health", healthHandler.CheckHealth)
+	router.GET("/health/live", healthHandler.Live)
+	router.GET("/health/providers", healthHandler.ProviderHealth)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
@@ -79,13 +225,14 @@ func main() {
 		}
 
 		// User routes - proxied to User Service (User Service handles auth via verifyToken middleware)
-		// We apply rate limiting at gateway level but let User Service handle authentication
+		// We apply rate limiting at gateway level but let User Service handle authentication,
+		// except on the cached GETs, which are authenticated before the cache is consulted
 		users := v1.Group("/users")
 		users.Use(rateLimiter.RateLimit())
 		{
 			users.GET("/profile", userHandler.ProxyToUserService)
-			users.GET("/profile/:id", userHandler.ProxyToUserService)
-			users.GET("/preference/:id", userHandler.ProxyToUserService)
+			users.GET("/profile/:id", authMiddleware.RequireAuth(), userHandler.ProxyToUserService)
+			users.GET("/preference/:id", authMiddleware.RequireAuth(), userHandler.ProxyToUserService)
 			users.PATCH("/preference/:id", userHandler.ProxyToUserService)
 			users.POST("/preference/:id", userHandler.ProxyToUserService)
 			users.POST("/push-token", userHandler.ProxyToUserService)
@@ -98,52 +245,225 @@ func main() {
 		notifications.Use(authMiddleware.RequireAuth())
 		notifications.Use(rateLimiter.RateLimit())
 		{
-			notifications.POST("", notificationHandler.CreateNotifiation)
+			notifications.POST("", createNotificationChain...)
+			notifications.POST("/batch", middleware.DecompressGzip(cfg.Server.MaxDecompressedBodyBytes), notificationHandler.CreateNotificationBatch)
+			notifications.POST("/test", middleware.DecompressGzip(cfg.Server.MaxDecompressedBodyBytes), notificationHandler.CreateTestNotification)
+			notifications.GET("/summary", notificationHandler.GetNotificationSummary)
 			notifications.GET("/:id", notificationHandler.GetNotificationStatus)
+			notifications.POST("/:id/read", notificationHandler.MarkNotificationRead)
 			notifications.GET("", notificationHandler.ListNotifications)
 		}
+
+		// Lifecycle webhook subscriptions
+		if cfg.Webhooks.Enabled {
+			webhookHandler := handlers.NewWebhookHandler(redisClient, cfg.Webhooks.MaxSubscriptionsPerUser)
+			hooks := v1.Group("/webhooks")
+			hooks.Use(authMiddleware.RequireAuth())
+			hooks.Use(rateLimiter.RateLimit())
+			{
+				hooks.POST("", webhookHandler.CreateWebhook)
+				hooks.GET("", webhookHandler.ListWebhooks)
+				hooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+			}
+		}
+
+		// Signed read links - the link itself authorizes one notification
+		if cfg.Auth.ReadLinkSecret != "" {
+			readLinks := links.NewSigner(cfg.Auth.ReadLinkSecret, cfg.Auth.ReadLinkTTL())
+			readLinkHandler := handlers.NewReadLinkHandler(redisClient, readLinks, cfg.Auth.ReadLinkTTL())
+			notifications.POST("/:id/link", readLinkHandler.CreateReadLink)
+
+			shared := v1.Group("/shared/notifications")
+			shared.Use(middleware.RequireSignedLink(readLinks))
+			shared.Use(rateLimiter.RateLimit())
+			{
+				shared.GET("/:id", notificationHandler.GetNotificationStatus)
+			}
+		}
+
+		// Admin routes - operational tooling, admin role required
+		admin := v1.Group("/admin")
+		admin.Use(authMiddleware.RequireAuth())
+		admin.Use(middleware.RequireRole("admin"))
+		{
+			admin.GET("/notifications/search", adminHandler.SearchNotifications)
+			admin.POST("/notifications/replay", adminHandler.ReplayNotifications)
+			admin.GET("/notifications/replay/:id", adminHandler.GetReplayJob)
+			admin.GET("/queues/:name/peek", adminHandler.PeekQueue)
+			admin.GET("/denylist", adminHandler.ListDenylist)
+			admin.PUT("/denylist/:user_id", adminHandler.BlockUser)
+			admin.DELETE("/denylist/:user_id", adminHandler.UnblockUser)
+			admin.GET("/loglevel", adminHandler.GetLogLevel)
+			admin.PUT("/loglevel", adminHandler.SetLogLevel)
+			if featureFlags != nil {
+				admin.POST("/feature-flags/sign", handlers.NewFeatureFlagHandler(featureFlags).SignFeatureFlags)
+			}
+		}
 	}
 
 
 	srv := &http.Server{
 		Addr: fmt.Sprintf(":%s", cfg.Server.Port),
 		Handler: router,
-		ReadTimeout: 10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout: cfg.Server.ReadTimeout(),
+		WriteTimeout: cfg.Server.WriteTimeout(),
 		IdleTimeout: 0 * time.Second,
 	}
 
 
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", srv.Addr, err)
+	}
+	if cfg.Server.MaxConnsPerIP > 0 {
+		listener = netutil.NewPerIPLimitListener(listener, cfg.Server.MaxConnsPerIP)
+	}
+
 	go func() {
 		log.Printf("🚀 API Gateway starting on port %s (env: %s)", cfg.Server.Port, cfg.Server.Environment)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
 
+	// Prime connections while /health reports "starting". The RabbitMQ
+	// topology was declared by NewRabbitMQClient; tokens are HMAC-signed, so
+	// there is no JWKS to fetch.
+	go func() {
+		warmup(workerCtx, cfg.Server.WarmupTimeout(),
+			warmupStep{"rabbitmq", rabbitMQ.Probe},
+			warmupStep{"redis", redisClient.HealthCheck},
+			warmupStep{"user_service", userServiceClient.HealthCheck},
+		)
+		healthHandler.MarkReady()
+	}()
+
+	go watchReload(cfg, rateLimiter, notificationHandler)
+
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	stopWorkers()
 
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout())
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
+	// In-flight requests are done; workers may still be finishing a message
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("Background workers did not stop in time")
+	}
+
 	log.Println("✓ Server exited gracefully")
 }
 
 
+// startEventsConsumer translates inbound domain events into notifications.
+func startEventsConsumer(ctx context.Context, workers *sync.WaitGroup, cfg config.EventsConfig, rabbitMQ *queue.RabbitMQClient, redisClient *cache.RedisClient, notificationHandler *handlers.NotificationHndler) {
+	consumer, err := rabbitMQ.NewRetryConsumer(queue.RetryConsumerConfig{
+		Queue:             cfg.Queue,
+		RoutingKey:        cfg.RoutingKey,
+		VisibilityTimeout: cfg.VisibilityTimeout(),
+		MaxRetries:        cfg.MaxRetries,
+	}, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to initialize events consumer: %v", err)
+	}
+
+	eventsConsumer := events.NewConsumer(cfg.Mappings, notificationHandler)
+	workers.Go(func() {
+		defer consumer.Close()
+		if err := consumer.Consume(ctx, eventsConsumer.Handle); err != nil && ctx.Err() == nil {
+			log.Printf("Events consumer stopped: %v", err)
+		}
+	})
+	log.Printf("✓ Events consumer started on %s (%d mappings)", cfg.Queue, len(cfg.Mappings))
+}
+
+
+func startStatusConsumer(ctx context.Context, workers *sync.WaitGroup, cfg config.StatusUpdatesConfig, rabbitMQ *queue.RabbitMQClient, redisClient *cache.RedisClient, notificationHandler *handlers.NotificationHndler) {
+	consumer, err := rabbitMQ.NewRetryConsumer(queue.RetryConsumerConfig{
+		Queue:             cfg.Queue,
+		RoutingKey:        cfg.RoutingKey,
+		VisibilityTimeout: cfg.VisibilityTimeout(),
+		MaxRetries:        cfg.MaxRetries,
+	}, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to initialize status consumer: %v", err)
+	}
+
+	statusConsumer := status.NewConsumer(notificationHandler)
+	workers.Go(func() {
+		defer consumer.Close()
+		if err := consumer.Consume(ctx, statusConsumer.Handle); err != nil && ctx.Err() == nil {
+			log.Printf("Status consumer stopped: %v", err)
+		}
+	})
+	log.Printf("✓ Status consumer started on %s", cfg.Queue)
+}
+
+
+// watchReload re-reads the configuration on SIGHUP and swaps the
+// hot-reloadable parts into the running middleware and handlers.
+func watchReload(cfg *config.Config, rateLimiter *middleware.RateLimiter, notificationHandler *handlers.NotificationHndler) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		next, err := config.Load()
+		if err != nil {
+			log.Printf("Config reload failed, keeping current config: %v", err)
+			continue
+		}
+
+		if changed := cfg.NonReloadableChanges(next); len(changed) > 0 {
+			log.Printf("Config reload: ignoring changes to %v (restart required)", changed)
+		}
+
+		rateLimiter.SetLimits(int64(next.RateLimit.MaxRequests), int64(next.RateLimit.MaxReadRequests), next.RateLimit.Window(), int64(next.RateLimit.Burst))
+		rateLimiter.SetStandardHeaders(next.RateLimit.StandardHeaders)
+		rateLimiter.SetMaxRetryAfter(next.RateLimit.MaxRetryAfter())
+		rateLimiter.SetExcludedPaths(next.RateLimit.ExcludedPaths)
+		// Validated by config.Load, so this cannot fail
+		if identity, err := middleware.NewIdentityResolver(next.RateLimit.Identity, next.RateLimit.IPv4PrefixBits, next.RateLimit.IPv6PrefixBits, next.RateLimit.TenantClaim); err == nil {
+			rateLimiter.SetIdentityResolver(identity)
+		}
+		if !cfg.StatusUpdates.Enabled && (next.Notifications.MaxInFlightPerUser > 0 || next.Notifications.MaxQueuedBytesPerUser > 0) {
+			// Enabling the consumer needs a restart, and without it the
+			// counters would never be released
+			log.Printf("Config reload: per-user in-flight caps stay disabled until a restart with status updates enabled")
+			next.Notifications.MaxInFlightPerUser = 0
+			next.Notifications.MaxQueuedBytesPerUser = 0
+		}
+		notificationHandler.UpdateConfig(next.Notifications)
+		notificationHandler.SetTenantClaim(next.RateLimit.TenantClaim)
+
+		log.Printf("✓ Config reloaded (rate limit: %d writes, %d reads/%s, templates allowed: %d, routes: %d)",
+			next.RateLimit.MaxRequests, next.RateLimit.MaxReadRequests, next.RateLimit.Window(), len(next.Notifications.TemplateAllowlist), len(next.Notifications.Routes))
+	}
+}
+
+
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Idempotency-Key")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Content-Encoding, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Idempotency-Key, X-Request-ID, X-Request-Timeout, X-Feature-Flags")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Location, Deprecation, Sunset")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -177,12 +497,13 @@ func logginMiddleware() gin.HandlerFunc {
 			path = path + "?" + raw
 		}
 
-		log.Printf("[%s] %s %s | %d | %v | %s",
+		log.Printf("[%s] %s %s | %d | %v | %s | %s",
 			method,
 			path,
 			clientIP,
 			statusCode,
 			latency,
+			middleware.GetRequestID(c),
 			c.Errors.String(),
 		)
 	}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// warmupStep is one connection or cache to prime before reporting ready
+type warmupStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// warmup runs every step concurrently within timeout and logs the outcome.
+// Failures are logged but don't block readiness; /health reports the
+// dependency itself. It returns the names of the steps that failed.
+func warmup(ctx context.Context, timeout time.Duration, steps ...warmupStep) []string {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var (
+		mu     sync.Mutex
+		failed []string
+		wg     sync.WaitGroup
+	)
+	for _, step := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stepStart := time.Now()
+			if err := step.run(ctx); err != nil {
+				log.Printf("⚠ Warmup %s failed after %s: %v", step.name, time.Since(stepStart).Round(time.Millisecond), err)
+				mu.Lock()
+				failed = append(failed, step.name)
+				mu.Unlock()
+				return
+			}
+			log.Printf("✓ Warmup %s done in %s", step.name, time.Since(stepStart).Round(time.Millisecond))
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("✓ Warmup finished in %s (%d/%d steps ok)", time.Since(start).Round(time.Millisecond), len(steps)-len(failed), len(steps))
+	return failed
+}
@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+)
+
+const (
+	EventNotificationCreated       = "notification.created"
+	EventNotificationStatusChanged = "notification.status_changed"
+)
+
+// Event is the analytics record emitted for notification lifecycle changes
+type Event struct {
+	EventType      string    `json:"event_type"`
+	NotificationID string    `json:"notification_id"`
+	UserID         string    `json:"user_id,omitempty"`
+	Type           string    `json:"type,omitempty"`
+	TemplateID     string    `json:"template_id,omitempty"`
+	Priority       string    `json:"priority,omitempty"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// Exporter ships analytics events. Emit must never block or fail delivery.
+type Exporter interface {
+	Emit(ctx context.Context, event Event)
+	Close() error
+}
+
+// NopExporter is used when no analytics sink is configured
+type NopExporter struct{}
+
+func (NopExporter) Emit(context.Context, Event) {}
+
+func (NopExporter) Close() error { return nil }
+
+// messageWriter is the part of *kafka.Writer the exporter uses
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaExporter writes events to a Kafka topic asynchronously, keyed by
+// notification ID so a notification's events stay ordered.
+type KafkaExporter struct {
+	writer messageWriter
+}
+
+func NewKafkaExporter(brokers []string, topic string) *KafkaExporter {
+	return &KafkaExporter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			Async:        true,
+			BatchTimeout: 100 * time.Millisecond,
+			Completion:   exportCompleted,
+		},
+	}
+}
+
+// exportCompleted reports the outcome of an async batch
+func exportCompleted(messages []kafka.Message, err error) {
+	if err != nil {
+		log.Printf("Failed to export %d analytics events: %v", len(messages), err)
+		metrics.AnalyticsExportFailures.Add(float64(len(messages)))
+	}
+}
+
+func (e *KafkaExporter) Emit(ctx context.Context, event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	value, err := json.Marshal(event)
+	if err != nil {
+		metrics.AnalyticsExportFailures.Inc()
+		return
+	}
+
+	// Async writes return immediately; failures surface in Completion
+	if err := e.writer.WriteMessages(ctx, kafka.Message{Key: []byte(event.NotificationID), Value: value}); err != nil {
+		log.Printf("Failed to export analytics event for %s: %v", event.NotificationID, err)
+		metrics.AnalyticsExportFailures.Inc()
+	}
+}
+
+func (e *KafkaExporter) Close() error {
+	return e.writer.Close()
+}
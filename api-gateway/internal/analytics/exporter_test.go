@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/segmentio/kafka-go"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+)
+
+// memWriter records messages, failing every write with err when set
+type memWriter struct {
+	messages []kafka.Message
+	err      error
+	closed   bool
+}
+
+func (w *memWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *memWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := counter.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestKafkaExporterEmit(t *testing.T) {
+	writer := &memWriter{}
+	e := &KafkaExporter{writer: writer}
+	at := time.Date(2025, 11, 11, 10, 30, 0, 0, time.UTC)
+
+	e.Emit(context.Background(), Event{EventType: EventNotificationCreated, NotificationID: "n1", UserID: "user-1", Type: "email", Status: "pending", Timestamp: at})
+	e.Emit(context.Background(), Event{EventType: EventNotificationStatusChanged, NotificationID: "n1", Status: "sent", PreviousStatus: "pending"})
+
+	if len(writer.messages) != 2 {
+		t.Fatalf("wrote %d messages, want 2", len(writer.messages))
+	}
+	for i, msg := range writer.messages {
+		if string(msg.Key) != "n1" {
+			t.Errorf("message %d: key %q, want the notification ID", i, msg.Key)
+		}
+	}
+
+	var created, changed Event
+	if err := json.Unmarshal(writer.messages[0].Value, &created); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(writer.messages[1].Value, &changed); err != nil {
+		t.Fatal(err)
+	}
+	if created.EventType != EventNotificationCreated || created.UserID != "user-1" || created.Status != "pending" || !created.Timestamp.Equal(at) {
+		t.Errorf("created event = %+v", created)
+	}
+	if changed.EventType != EventNotificationStatusChanged || changed.PreviousStatus != "pending" || changed.Status != "sent" {
+		t.Errorf("status change event = %+v", changed)
+	}
+	if changed.Timestamp.IsZero() {
+		t.Error("missing timestamp was not filled in")
+	}
+
+	if err := e.Close(); err != nil || !writer.closed {
+		t.Errorf("Close = %v, writer closed %v", err, writer.closed)
+	}
+}
+
+func TestKafkaExporterFailsSoft(t *testing.T) {
+	e := &KafkaExporter{writer: &memWriter{err: errors.New("broker unavailable")}}
+
+	before := counterValue(t, metrics.AnalyticsExportFailures)
+	// Emit has no error to return; a failed write must only be counted
+	e.Emit(context.Background(), Event{EventType: EventNotificationCreated, NotificationID: "n1"})
+	if got := counterValue(t, metrics.AnalyticsExportFailures) - before; got != 1 {
+		t.Errorf("export failures rose by %v, want 1", got)
+	}
+}
+
+func TestExportCompleted(t *testing.T) {
+	messages := []kafka.Message{{Key: []byte("n1")}, {Key: []byte("n2")}, {Key: []byte("n3")}}
+
+	before := counterValue(t, metrics.AnalyticsExportFailures)
+	exportCompleted(messages, nil)
+	if got := counterValue(t, metrics.AnalyticsExportFailures) - before; got != 0 {
+		t.Errorf("successful batch counted %v failures", got)
+	}
+	exportCompleted(messages, errors.New("leader not available"))
+	if got := counterValue(t, metrics.AnalyticsExportFailures) - before; got != 3 {
+		t.Errorf("failed batch counted %v failures, want 3", got)
+	}
+}
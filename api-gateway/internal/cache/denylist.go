@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const denylistKey = "denylist:users"
+
+// Denylist is the Redis-backed set of blocked user IDs. Lookups are served
+// from a local snapshot refreshed every ttl, so changes made on another
+// instance take effect within ttl.
+type Denylist struct {
+	redis *RedisClient
+	ttl   time.Duration
+
+	mu        sync.RWMutex
+	users     map[string]struct{}
+	refreshed time.Time
+}
+
+func NewDenylist(redis *RedisClient, ttl time.Duration) *Denylist {
+	return &Denylist{
+		redis: redis,
+		ttl:   ttl,
+	}
+}
+
+// Blocked reports whether userID is denylisted. Redis failures fall back to
+// the last snapshot.
+func (d *Denylist) Blocked(ctx context.Context, userID string) (bool, error) {
+	d.mu.RLock()
+	fresh := d.users != nil && time.Since(d.refreshed) < d.ttl
+	_, blocked := d.users[userID]
+	d.mu.RUnlock()
+	if fresh {
+		return blocked, nil
+	}
+
+	if err := d.refresh(ctx); err != nil {
+		return blocked, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, blocked = d.users[userID]
+	return blocked, nil
+}
+
+func (d *Denylist) List(ctx context.Context) ([]string, error) {
+	return d.redis.client.SMembers(ctx, denylistKey).Result()
+}
+
+func (d *Denylist) Add(ctx context.Context, userID string) error {
+	if err := d.redis.client.SAdd(ctx, denylistKey, userID).Err(); err != nil {
+		return err
+	}
+	return d.refresh(ctx)
+}
+
+func (d *Denylist) Remove(ctx context.Context, userID string) error {
+	if err := d.redis.client.SRem(ctx, denylistKey, userID).Err(); err != nil {
+		return err
+	}
+	return d.refresh(ctx)
+}
+
+func (d *Denylist) refresh(ctx context.Context) error {
+	members, err := d.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		users[m] = struct{}{}
+	}
+
+	d.mu.Lock()
+	d.users = users
+	d.refreshed = time.Now()
+	d.mu.Unlock()
+	return nil
+}
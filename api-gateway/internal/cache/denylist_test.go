@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDenylist(t *testing.T) {
+	r, _ := testRedisClient(t, time.Now())
+	ctx := context.Background()
+	d := NewDenylist(r, time.Hour)
+
+	must(t, d.Add(ctx, "user-1"))
+	must(t, d.Add(ctx, "user-2"))
+	must(t, d.Remove(ctx, "user-2"))
+
+	for user, want := range map[string]bool{"user-1": true, "user-2": false, "user-3": false} {
+		if blocked, err := d.Blocked(ctx, user); err != nil || blocked != want {
+			t.Errorf("Blocked(%s) = %v, %v; want %v", user, blocked, err, want)
+		}
+	}
+	users, err := d.List(ctx)
+	if err != nil || !slices.Equal(users, []string{"user-1"}) {
+		t.Errorf("List = %v, %v; want [user-1]", users, err)
+	}
+}
+
+func TestDenylistSnapshot(t *testing.T) {
+	r, mr := testRedisClient(t, time.Now())
+	ctx := context.Background()
+	local := NewDenylist(r, 50*time.Millisecond)
+	other := NewDenylist(r, time.Hour)
+
+	if blocked, err := local.Blocked(ctx, "user-1"); err != nil || blocked {
+		t.Fatalf("Blocked before any block = %v, %v", blocked, err)
+	}
+
+	// Another instance's change shows up once the snapshot is stale
+	must(t, other.Add(ctx, "user-1"))
+	if blocked, _ := local.Blocked(ctx, "user-1"); blocked {
+		t.Error("fresh snapshot already saw another instance's block")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if blocked, err := local.Blocked(ctx, "user-1"); err != nil || !blocked {
+		t.Fatalf("Blocked after the snapshot expired = %v, %v; want true", blocked, err)
+	}
+
+	// With Redis down the last snapshot still answers
+	time.Sleep(60 * time.Millisecond)
+	mr.Close()
+	blocked, err := local.Blocked(ctx, "user-1")
+	if err == nil {
+		t.Error("Blocked with Redis down reported no error")
+	}
+	if !blocked {
+		t.Error("Blocked with Redis down dropped the last snapshot")
+	}
+}
@@ -3,27 +3,82 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 
+// ErrNotificationNotFound is returned when no status record exists
+var ErrNotificationNotFound = errors.New("notification not found")
+
+
+// ErrClosed is returned by operations on a closed client, e.g. work that
+// outlived shutdown. It is transient from the caller's point of view.
+var ErrClosed = errors.New("redis client is closed")
+
+
+// closedHook replaces go-redis' closed-client error with ErrClosed
+type closedHook struct{}
+
+
+func (closedHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+
+func (closedHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return translateClosed(next(ctx, cmd))
+	}
+}
+
+
+func (closedHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			if errors.Is(cmd.Err(), redis.ErrClosed) {
+				cmd.SetErr(ErrClosed)
+			}
+		}
+		return translateClosed(err)
+	}
+}
+
+
+func translateClosed(err error) error {
+	if errors.Is(err, redis.ErrClosed) {
+		return ErrClosed
+	}
+	return err
+}
+
+
 type RedisClient struct {
 	client *redis.Client
+	// replica, when set, serves the polling reads; see read
+	replica *redis.Client
+	// replicaDownUntil (unix nanos) skips a replica that just failed
+	replicaDownUntil atomic.Int64
 }
 
 
+// replicaRetryInterval is how long reads go to the primary after the
+// replica fails
+const replicaRetryInterval = 10 * time.Second
+
+
 func NewRedisClient(url string, db int) (*RedisClient, error) {
-	opts, err := redis.ParseURL(url)
+	opts, err := redisOptions(url, db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL::: %w", err)
+		return nil, err
 	}
 
-	opts.DB = db
-
 	client := redis.NewClient(opts)
 
 
@@ -34,13 +89,88 @@ func NewRedisClient(url string, db int) (*RedisClient, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	client.AddHook(closedHook{})
+
 	log.Println("✓ Redis client connected successfully")
 	return &RedisClient{client: client}, nil
 }
 
 
+// UseReplica routes the polling reads (status lookups, summaries, admin
+// search results and proxy cache hits) to a read replica. Reads that feed
+// a write, such as idempotency checks and status updates, stay on the
+// primary. An unreachable replica is not fatal: reads fall back to the
+// primary until it answers. It must be called before the server starts.
+func (r *RedisClient) UseReplica(url string, db int) error {
+	opts, err := redisOptions(url, db)
+	if err != nil {
+		return err
+	}
+
+	replica := redis.NewClient(opts)
+	replica.AddHook(closedHook{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := replica.Ping(ctx).Err(); err != nil {
+		log.Printf("⚠ Redis replica unreachable, reading from the primary until it is: %v", err)
+		r.replicaDownUntil.Store(time.Now().Add(replicaRetryInterval).UnixNano())
+	} else {
+		log.Println("✓ Redis replica connected successfully")
+	}
+	r.replica = replica
+	return nil
+}
+
+
+// read runs a read-only command on the replica when one is configured and
+// healthy, falling back to the primary if it fails. fn must return
+// redis.Nil, not a translated error, for missing keys.
+func (r *RedisClient) read(ctx context.Context, fn func(redis.Cmdable) error) error {
+	if r.replica != nil && time.Now().UnixNano() >= r.replicaDownUntil.Load() {
+		err := fn(r.replica)
+		if err == nil || err == redis.Nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Redis replica read failed, using the primary for %v: %v", replicaRetryInterval, err)
+		r.replicaDownUntil.Store(time.Now().Add(replicaRetryInterval).UnixNano())
+	}
+	return fn(r.client)
+}
+
+
+func redisOptions(url string, db int) (*redis.Options, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL::: %w", err)
+	}
+
+	opts.DB = db
+	// Honor context deadlines on reads and writes, not just the fixed
+	// socket timeouts, so callers can bound individual commands
+	opts.ContextTimeoutEnabled = true
+	return opts, nil
+}
+
+
+// idempotencyAccessKey scores every idempotency key by last access, so the
+// cache can be bounded by evicting the least recently used keys.
+const idempotencyAccessKey = "idempotency:lru"
+
+
+// maxIdempotencyTTL is the longest idempotency TTL; older access entries
+// belong to expired keys
+const maxIdempotencyTTL = 24 * time.Hour
+
+
 func (r *RedisClient) SetIdempotencyKey(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return r.client.Set(ctx, fmt.Sprintf("idempotency:%s", key), value, expiration).Err()
+	now := time.Now()
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("idempotency:%s", key), value, expiration)
+	pipe.ZAdd(ctx, idempotencyAccessKey, redis.Z{Score: float64(now.UnixMilli()), Member: key})
+	pipe.ZRemRangeByScore(ctx, idempotencyAccessKey, "-inf", fmt.Sprintf("(%d", now.Add(-maxIdempotencyTTL).UnixMilli()))
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 
@@ -49,19 +179,184 @@ func (r *RedisClient) GetIdempotencyKey(ctx context.Context, key string) (string
 	if err == redis.Nil {
 		return "", nil
 	}
+	if err == nil {
+		// Refresh recency; XX avoids resurrecting trimmed entries
+		r.client.ZAddXX(ctx, idempotencyAccessKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: key})
+	}
 	return val, err
 }
 
 
+func idempotencyReservationsKey(userID string) string {
+	return fmt.Sprintf("idempotency:reservations:%s", userID)
+}
+
+
+// reserveIdempotencyScript drops expired reservations, then adds one unless
+// the user is at the cap. Members are notification IDs scored by expiry (ms).
+// Returns 1 when reserved.
+var reserveIdempotencyScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expiresAt = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], expiresAt, ARGV[4])
+if redis.call("PTTL", KEYS[1]) < expiresAt - now then
+	redis.call("PEXPIRE", KEYS[1], expiresAt - now)
+end
+return 1
+`)
+
+
+// ReserveIdempotency records an idempotency reservation for a user's
+// notification, reporting false when the user already holds maxReservations.
+func (r *RedisClient) ReserveIdempotency(ctx context.Context, userID, notificationID string, ttl time.Duration, maxReservations int64) (bool, error) {
+	now := time.Now()
+	reserved, err := reserveIdempotencyScript.Run(ctx, r.client, []string{idempotencyReservationsKey(userID)},
+		now.UnixMilli(), now.Add(ttl).UnixMilli(), maxReservations, notificationID).Int()
+	return reserved == 1, err
+}
+
+
+// ReleaseIdempotency frees a notification's reservation; releasing one that
+// was never made or has expired is a no-op.
+func (r *RedisClient) ReleaseIdempotency(ctx context.Context, userID, notificationID string) error {
+	return r.client.ZRem(ctx, idempotencyReservationsKey(userID), notificationID).Err()
+}
+
+
+// batchPending marks a batch key whose batch is still being processed
+const batchPending = "pending"
+
+
+// ErrBatchInProgress means another request holds the batch key
+var ErrBatchInProgress = errors.New("batch is still being processed")
+
+
+func batchResultKey(key string) string {
+	return fmt.Sprintf("batch:%s", key)
+}
+
+
+// ClaimBatch reserves a batch idempotency key for ttl. It returns "" when
+// the caller now owns the key, the stored result when the batch already
+// completed, or ErrBatchInProgress while another request is processing it.
+func (r *RedisClient) ClaimBatch(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	claimed, err := r.client.SetNX(ctx, batchResultKey(key), batchPending, ttl).Result()
+	if err != nil || claimed {
+		return "", err
+	}
+	stored, err := r.client.Get(ctx, batchResultKey(key)).Result()
+	if err == redis.Nil || stored == batchPending {
+		// A nil here means the claim lapsed in between; the owner is
+		// presumed gone, but let the client retry rather than race it
+		return "", ErrBatchInProgress
+	}
+	return stored, err
+}
+
+
+// StoreBatchResult replaces a claimed batch key with the batch's result
+func (r *RedisClient) StoreBatchResult(ctx context.Context, key, result string, ttl time.Duration) error {
+	return r.client.Set(ctx, batchResultKey(key), result, ttl).Err()
+}
+
+
+// trimIdempotencyScript evicts the least recently used keys beyond the cap
+// and returns {evicted, size}.
+var trimIdempotencyScript = redis.NewScript(`
+local excess = redis.call("ZCARD", KEYS[1]) - tonumber(ARGV[1])
+if excess <= 0 then
+	return {0, redis.call("ZCARD", KEYS[1])}
+end
+local victims = redis.call("ZPOPMIN", KEYS[1], excess)
+for i = 1, #victims, 2 do
+	redis.call("DEL", "idempotency:" .. victims[i])
+end
+return {excess, redis.call("ZCARD", KEYS[1])}
+`)
+
+
+// TrimIdempotencyKeys bounds the idempotency cache to maxKeys entries,
+// returning how many were evicted and the resulting size.
+func (r *RedisClient) TrimIdempotencyKeys(ctx context.Context, maxKeys int64) (int64, int64, error) {
+	res, err := trimIdempotencyScript.Run(ctx, r.client, []string{idempotencyAccessKey}, maxKeys).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return res[0], res[1], nil
+}
+
+
 func (r *RedisClient) SetNotificationStatus(ctx context.Context, notificationID string, status interface{}, expiration time.Duration) error {
 	return  r.client.Set(ctx, fmt.Sprintf("notification:%s", notificationID), status, expiration).Err()
 }
 
 
+func notificationIDKey(notificationID string) string {
+	return fmt.Sprintf("notification_id:%s", notificationID)
+}
+
+
+// reserveNotificationIDScript claims KEYS[2] unless the status record
+// KEYS[1] exists or another request already claimed it
+var reserveNotificationIDScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+if redis.call("SET", KEYS[2], "1", "NX", "PX", ARGV[1]) then
+	return 1
+end
+return 0
+`)
+
+
+// ReserveNotificationID claims a client-chosen notification ID for ttl,
+// reporting false when the ID already has a status record or is claimed
+// by another request.
+func (r *RedisClient) ReserveNotificationID(ctx context.Context, notificationID string, ttl time.Duration) (bool, error) {
+	keys := []string{fmt.Sprintf("notification:%s", notificationID), notificationIDKey(notificationID)}
+	reserved, err := reserveNotificationIDScript.Run(ctx, r.client, keys, ttl.Milliseconds()).Int()
+	return reserved == 1, err
+}
+
+
+// ReleaseNotificationID frees an ID claimed by a request that then failed.
+func (r *RedisClient) ReleaseNotificationID(ctx context.Context, notificationID string) error {
+	return r.client.Del(ctx, notificationIDKey(notificationID)).Err()
+}
+
+
+// DeleteNotificationStatus removes a status record written for a
+// notification that then failed to queue.
+func (r *RedisClient) DeleteNotificationStatus(ctx context.Context, notificationID string) error {
+	return r.client.Del(ctx, fmt.Sprintf("notification:%s", notificationID)).Err()
+}
+
+
+// GetNotificationStatus reads a status record, from the replica if there
+// is one. Read-modify-write callers use GetNotificationStatusForUpdate.
 func (r *RedisClient) GetNotificationStatus(ctx context.Context, notificationID string) (string, error) {
+	var val string
+	err := r.read(ctx, func(c redis.Cmdable) (err error) {
+		val, err = c.Get(ctx, fmt.Sprintf("notification:%s", notificationID)).Result()
+		return err
+	})
+	if err == redis.Nil {
+		return "", ErrNotificationNotFound
+	}
+	return val, err
+}
+
+
+// GetNotificationStatusForUpdate reads a status record from the primary,
+// so a replica lagging behind can't undo a recent write.
+func (r *RedisClient) GetNotificationStatusForUpdate(ctx context.Context, notificationID string) (string, error) {
 	val, err := r.client.Get(ctx, fmt.Sprintf("notification:%s", notificationID)).Result()
 	if err == redis.Nil {
-		return "", fmt.Errorf("notification not found")
+		return "", ErrNotificationNotFound
 	}
 	return val, err
 }
@@ -84,12 +379,714 @@ func (r *RedisClient) IncrementRateLimit(ctx context.Context, userID string, win
 }
 
 
+// gcraScript implements the generic cell rate algorithm. The key holds the
+// theoretical arrival time (TAT) in µs, so rates above 1000/s keep their
+// exact interval; a request is allowed while the TAT stays within burst+1
+// emission intervals of now. Redis' clock is used so every gateway instance
+// agrees. The TAT is formatted explicitly because Lua would write a number
+// that large with only 14 significant digits. Returns {allowed, remaining,
+// retry_after_us, reset_after_us}.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local newTat = tat + interval
+local allowAt = newTat - interval * capacity
+if now < allowAt then
+	return {0, 0, allowAt - now, tat - now}
+end
+
+redis.call('SET', KEYS[1], string.format('%.0f', newTat), 'PX', math.ceil((newTat - now) / 1000))
+return {1, math.floor((now - allowAt) / interval), 0, newTat - now}
+`)
+
+
+// GCRAResult is the outcome of a GCRA rate limit check
+type GCRAResult struct {
+	Allowed    bool
+	Remaining  int64
+	RetryAfter time.Duration
+	// ResetAfter is when the bucket is full again
+	ResetAfter time.Duration
+}
+
+
+// AllowGCRA admits a request at a sustained rate of one per interval, with
+// up to burst extra requests at once.
+func (r *RedisClient) AllowGCRA(ctx context.Context, key string, interval time.Duration, burst int64) (GCRAResult, error) {
+	vals, err := gcraScript.Run(ctx, r.client, []string{fmt.Sprintf("ratelimit:gcra:%s", key)},
+		max(interval.Microseconds(), 1), burst+1).Int64Slice()
+	if err != nil {
+		return GCRAResult{}, err
+	}
+	return GCRAResult{
+		Allowed:    vals[0] == 1,
+		Remaining:  vals[1],
+		RetryAfter: time.Duration(vals[2]) * time.Microsecond,
+		ResetAfter: time.Duration(vals[3]) * time.Microsecond,
+	}, nil
+}
+
+
+// IncrementInFlight reserves an in-flight slot for a user and returns the new
+// count. The TTL is refreshed on every reservation so a counter leaked by lost
+// status updates eventually resets.
+func (r *RedisClient) IncrementInFlight(ctx context.Context, userID string, ttl time.Duration) (int64, error) {
+	key := fmt.Sprintf("inflight:%s", userID)
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+
+// decrementScript never takes a counter below zero
+var decrementScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+
+// DecrementInFlight releases a user's in-flight slot
+func (r *RedisClient) DecrementInFlight(ctx context.Context, userID string) error {
+	return decrementScript.Run(ctx, r.client, []string{fmt.Sprintf("inflight:%s", userID)}).Err()
+}
+
+
+func queuedBytesKey(userID string) string {
+	return fmt.Sprintf("queued_bytes:%s", userID)
+}
+
+
+// reserveBytesScript adds ARGV[1] bytes unless that would pass ARGV[2]. The
+// TTL is refreshed like the in-flight counter's, so leaks eventually reset.
+var reserveBytesScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local n = tonumber(ARGV[1])
+if current + n > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], n)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+
+// ReserveQueuedBytes counts n bytes against a user's budget of max, and
+// reports false, reserving nothing, if they don't fit.
+func (r *RedisClient) ReserveQueuedBytes(ctx context.Context, userID string, n, max int64, ttl time.Duration) (bool, error) {
+	reserved, err := reserveBytesScript.Run(ctx, r.client, []string{queuedBytesKey(userID)}, n, max, ttl.Milliseconds()).Int()
+	return reserved == 1, err
+}
+
+
+// releaseBytesScript never takes the counter below zero
+var releaseBytesScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local n = math.min(current, tonumber(ARGV[1]))
+if n > 0 then
+	return redis.call('DECRBY', KEYS[1], n)
+end
+return current
+`)
+
+
+// ReleaseQueuedBytes returns n bytes to a user's budget
+func (r *RedisClient) ReleaseQueuedBytes(ctx context.Context, userID string, n int64) error {
+	return releaseBytesScript.Run(ctx, r.client, []string{queuedBytesKey(userID)}, n).Err()
+}
+
+
+// NextQueueSequence numbers a notification published with routingKey. The
+// counter only grows, so its distance from the latest number is how many
+// notifications were published after it.
+func (r *RedisClient) NextQueueSequence(ctx context.Context, routingKey string) (int64, error) {
+	return r.client.Incr(ctx, fmt.Sprintf("queue_seq:%s", routingKey)).Result()
+}
+
+
+// QueueSequence returns the latest number handed out for routingKey, 0 if
+// none has been.
+func (r *RedisClient) QueueSequence(ctx context.Context, routingKey string) (int64, error) {
+	var seq int64
+	err := r.read(ctx, func(c redis.Cmdable) (err error) {
+		seq, err = c.Get(ctx, fmt.Sprintf("queue_seq:%s", routingKey)).Int64()
+		return err
+	})
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return seq, err
+}
+
+
+const (
+	auditStream = "audit:notifications"
+	// auditMaxLen bounds the audit log; older entries are trimmed
+	auditMaxLen = 100000
+)
+
+
+// AppendAudit adds an entry to the notification audit log. Stream IDs are
+// millisecond timestamps, so the log can be read back by time range.
+func (r *RedisClient) AppendAudit(ctx context.Context, entry string) error {
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: auditStream,
+		MaxLen: auditMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"entry": entry},
+	}).Err()
+}
+
+
+// ReadAudit returns up to count audit entries after cursor (exclusive) and
+// no later than to. Pass "" to start at from. The returned cursor is ""
+// once the range is exhausted.
+func (r *RedisClient) ReadAudit(ctx context.Context, from, to time.Time, cursor string, count int64) ([]string, string, error) {
+	start := fmt.Sprintf("%d", from.UnixMilli())
+	if cursor != "" {
+		start = "(" + cursor
+	}
+
+	messages, err := r.client.XRangeN(ctx, auditStream, start, fmt.Sprintf("%d", to.UnixMilli()), count).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if entry, ok := m.Values["entry"].(string); ok {
+			entries = append(entries, entry)
+		}
+	}
+	next := ""
+	if int64(len(messages)) == count {
+		next = messages[len(messages)-1].ID
+	}
+	return entries, next, nil
+}
+
+
+// SetLastDelivery records when a notification in group was delivered to a user
+func (r *RedisClient) SetLastDelivery(ctx context.Context, userID, group string, at time.Time, ttl time.Duration) error {
+	return r.client.Set(ctx, fmt.Sprintf("delivered:%s:%s", userID, group), at.UnixMilli(), ttl).Err()
+}
+
+
+// GetLastDelivery returns the last delivery time for a user and group, or
+// the zero time if none is recorded.
+func (r *RedisClient) GetLastDelivery(ctx context.Context, userID, group string) (time.Time, error) {
+	ms, err := r.client.Get(ctx, fmt.Sprintf("delivered:%s:%s", userID, group)).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+
+const notificationIndexAll = "idx:notification:all"
+
+
+// NotificationIndexKey names the sorted set indexing notifications by a
+// field value (user_id, template_id or status), scored by creation time.
+func NotificationIndexKey(field, value string) string {
+	return fmt.Sprintf("idx:notification:%s:%s", field, value)
+}
+
+
+// notificationSummaryKey holds a user's notifications in one status (or
+// SummaryUnreadField), scored by when their status record expires. Counting
+// only unexpired members keeps the summary in step with the records that
+// still exist.
+func notificationSummaryKey(userID, status string) string {
+	return fmt.Sprintf("summary:status:%s:%s", userID, status)
+}
+
+
+// notificationSummaryStatusesKey lists the statuses a user has summary sets for
+func notificationSummaryStatusesKey(userID string) string {
+	return fmt.Sprintf("summary:statuses:%s", userID)
+}
+
+
+// SummaryUnreadField counts delivered notifications not yet marked read
+const SummaryUnreadField = "unread"
+
+
+// addToSummary queues adding a notification to one of the user's summary
+// sets, dropping members whose records have expired. The set itself expires
+// after retention without writes, which outlives every member.
+func addToSummary(ctx context.Context, pipe redis.Pipeliner, userID, set, notificationID string, ttl, retention time.Duration) {
+	now := time.Now()
+	key := notificationSummaryKey(userID, set)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: notificationID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("%d", now.UnixMilli()))
+	pipe.Expire(ctx, key, retention)
+}
+
+
+// IndexNotification adds a notification to the search indexes and the
+// user's summary, and prunes index entries older than retention. ttl is the
+// status record's.
+func (r *RedisClient) IndexNotification(ctx context.Context, notificationID, userID, templateID, status string, createdAt time.Time, ttl, retention time.Duration) error {
+	score := float64(createdAt.UnixMilli())
+	cutoff := fmt.Sprintf("(%d", time.Now().Add(-retention).UnixMilli())
+	statusesKey := notificationSummaryStatusesKey(userID)
+
+	pipe := r.client.TxPipeline()
+	addToSummary(ctx, pipe, userID, status, notificationID, ttl, retention)
+	pipe.SAdd(ctx, statusesKey, status)
+	pipe.Expire(ctx, statusesKey, retention)
+	for _, key := range []string{
+		notificationIndexAll,
+		NotificationIndexKey("user_id", userID),
+		NotificationIndexKey("template_id", templateID),
+		NotificationIndexKey("status", status),
+	} {
+		pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: notificationID})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", cutoff)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+
+// ReindexNotificationStatus moves a notification between status indexes and
+// summary sets. ttl is the updated status record's.
+func (r *RedisClient) ReindexNotificationStatus(ctx context.Context, notificationID, userID, oldStatus, newStatus string, createdAt time.Time, ttl, retention time.Duration) error {
+	statusesKey := notificationSummaryStatusesKey(userID)
+	pipe := r.client.TxPipeline()
+	pipe.ZRem(ctx, NotificationIndexKey("status", oldStatus), notificationID)
+	pipe.ZAdd(ctx, NotificationIndexKey("status", newStatus), redis.Z{Score: float64(createdAt.UnixMilli()), Member: notificationID})
+	pipe.ZRem(ctx, notificationSummaryKey(userID, oldStatus), notificationID)
+	addToSummary(ctx, pipe, userID, newStatus, notificationID, ttl, retention)
+	pipe.SAdd(ctx, statusesKey, newStatus)
+	pipe.Expire(ctx, statusesKey, retention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+
+// UnindexNotification removes a notification from the search indexes and
+// the user's summary, for a status record that was deleted.
+func (r *RedisClient) UnindexNotification(ctx context.Context, notificationID, userID, templateID, status string) error {
+	pipe := r.client.TxPipeline()
+	for _, key := range []string{
+		notificationIndexAll,
+		NotificationIndexKey("user_id", userID),
+		NotificationIndexKey("template_id", templateID),
+		NotificationIndexKey("status", status),
+		notificationSummaryKey(userID, status),
+	} {
+		pipe.ZRem(ctx, key, notificationID)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+
+// MarkNotificationUnread counts a delivered notification as unread until it
+// is marked read or its status record expires after ttl
+func (r *RedisClient) MarkNotificationUnread(ctx context.Context, userID, notificationID string, ttl, retention time.Duration) error {
+	pipe := r.client.TxPipeline()
+	addToSummary(ctx, pipe, userID, SummaryUnreadField, notificationID, ttl, retention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+
+// MarkNotificationRead stops counting a notification as unread and reports
+// whether it was unread before.
+func (r *RedisClient) MarkNotificationRead(ctx context.Context, userID, notificationID string) (bool, error) {
+	removed, err := r.client.ZRem(ctx, notificationSummaryKey(userID, SummaryUnreadField), notificationID).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed == 1, nil
+}
+
+
+// GetNotificationSummary returns a user's counts by status plus
+// SummaryUnreadField, counting only notifications whose status records
+// haven't expired. Statuses with no notifications are omitted.
+func (r *RedisClient) GetNotificationSummary(ctx context.Context, userID string) (map[string]int64, error) {
+	now := fmt.Sprintf("(%d", time.Now().UnixMilli())
+	counts := make(map[string]int64)
+	err := r.read(ctx, func(c redis.Cmdable) error {
+		statuses, err := c.SMembers(ctx, notificationSummaryStatusesKey(userID)).Result()
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, SummaryUnreadField)
+
+		pipe := c.Pipeline()
+		cmds := make([]*redis.IntCmd, len(statuses))
+		for i, status := range statuses {
+			cmds[i] = pipe.ZCount(ctx, notificationSummaryKey(userID, status), now, "+inf")
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		for i, status := range statuses {
+			if n := cmds[i].Val(); n > 0 {
+				counts[status] = n
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+
+// SearchNotifications returns notification IDs present in every given index
+// and created within [from, to], newest first, plus the total match count.
+func (r *RedisClient) SearchNotifications(ctx context.Context, indexes []string, from, to time.Time, offset, count int64) ([]string, int64, error) {
+	key := notificationIndexAll
+	if len(indexes) == 1 {
+		key = indexes[0]
+	} else if len(indexes) > 1 {
+		// Intersect into a short-lived scratch key; MIN keeps creation time
+		key = fmt.Sprintf("idx:notification:search:%d", time.Now().UnixNano())
+		if err := r.client.ZInterStore(ctx, key, &redis.ZStore{Keys: indexes, Aggregate: "MIN"}).Err(); err != nil {
+			return nil, 0, err
+		}
+		defer r.client.Del(context.WithoutCancel(ctx), key)
+	}
+
+	rangeBy := &redis.ZRangeBy{
+		Min:    fmt.Sprintf("%d", from.UnixMilli()),
+		Max:    fmt.Sprintf("%d", to.UnixMilli()),
+		Offset: offset,
+		Count:  count,
+	}
+	total, err := r.client.ZCount(ctx, key, rangeBy.Min, rangeBy.Max).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, err := r.client.ZRevRangeByScore(ctx, key, rangeBy).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	return ids, total, nil
+}
+
+
+// GetNotificationStatuses fetches several status records at once. Missing
+// records are returned as "".
+func (r *RedisClient) GetNotificationStatuses(ctx context.Context, notificationIDs []string) ([]string, error) {
+	if len(notificationIDs) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(notificationIDs))
+	for i, id := range notificationIDs {
+		keys[i] = fmt.Sprintf("notification:%s", id)
+	}
+
+	var vals []interface{}
+	err := r.read(ctx, func(c redis.Cmdable) (err error) {
+		vals, err = c.MGet(ctx, keys...).Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]string, len(vals))
+	for i, v := range vals {
+		if str, ok := v.(string); ok {
+			statuses[i] = str
+		}
+	}
+	return statuses, nil
+}
+
+
+// GetCachedResponse returns a cached proxy response for path and variant, or
+// "" on a miss.
+func (r *RedisClient) GetCachedResponse(ctx context.Context, path, variant string) (string, error) {
+	var val string
+	err := r.read(ctx, func(c redis.Cmdable) (err error) {
+		val, err = c.Get(ctx, fmt.Sprintf("proxycache:%s:%s", path, variant)).Result()
+		return err
+	})
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+
+// SetCachedResponse stores a proxy response and indexes it under path so all
+// variants can be invalidated together.
+func (r *RedisClient) SetCachedResponse(ctx context.Context, path, variant string, value interface{}, ttl time.Duration) error {
+	key := fmt.Sprintf("proxycache:%s:%s", path, variant)
+	index := fmt.Sprintf("proxycache:index:%s", path)
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, key, value, ttl)
+	pipe.SAdd(ctx, index, key)
+	pipe.Expire(ctx, index, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+
+// InvalidateCachedResponses drops every cached variant of the given paths.
+func (r *RedisClient) InvalidateCachedResponses(ctx context.Context, paths ...string) error {
+	for _, path := range paths {
+		index := fmt.Sprintf("proxycache:index:%s", path)
+		keys, err := r.client.SMembers(ctx, index).Result()
+		if err != nil {
+			return err
+		}
+		if err := r.client.Del(ctx, append(keys, index)...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+
+// GetCachedPreference returns a user's cached notification preferences as
+// JSON, or "" on a miss.
+func (r *RedisClient) GetCachedPreference(ctx context.Context, userID string) (string, error) {
+	val, err := r.client.Get(ctx, fmt.Sprintf("preference:%s", userID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+
+func (r *RedisClient) SetCachedPreference(ctx context.Context, userID, value string, ttl time.Duration) error {
+	return r.client.Set(ctx, fmt.Sprintf("preference:%s", userID), value, ttl).Err()
+}
+
+
+// InvalidateCachedPreference drops a user's cached preferences after they
+// change.
+func (r *RedisClient) InvalidateCachedPreference(ctx context.Context, userID string) error {
+	return r.client.Del(ctx, fmt.Sprintf("preference:%s", userID)).Err()
+}
+
+
+const outboxKey = "outbox:notifications"
+
+
+// PushOutbox appends an entry to the notification outbox.
+func (r *RedisClient) PushOutbox(ctx context.Context, entry string) error {
+	return r.client.LPush(ctx, outboxKey, entry).Err()
+}
+
+
+// PeekOutbox returns the oldest outbox entry without removing it.
+func (r *RedisClient) PeekOutbox(ctx context.Context) (string, error) {
+	val, err := r.client.LIndex(ctx, outboxKey, -1).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+
+func (r *RedisClient) RemoveOutbox(ctx context.Context, entry string) error {
+	return r.client.LRem(ctx, outboxKey, -1, entry).Err()
+}
+
+
+func (r *RedisClient) OutboxLength(ctx context.Context) (int64, error) {
+	return r.client.LLen(ctx, outboxKey).Result()
+}
+
+
+const (
+	retryScheduleKey = "retry:scheduled"
+	retryParkedKey   = "retry:parked"
+)
+
+
+// popDueScript removes and returns due entries atomically so concurrent
+// workers never take the same one twice.
+var popDueScript = redis.NewScript(`
+local entries = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+if #entries > 0 then
+	redis.call("ZREM", KEYS[1], unpack(entries))
+end
+return entries
+`)
+
+
+func (r *RedisClient) ScheduleRetry(ctx context.Context, entry string, at time.Time) error {
+	return r.client.ZAdd(ctx, retryScheduleKey, redis.Z{Score: float64(at.UnixMilli()), Member: entry}).Err()
+}
+
+
+// claimDueScript returns due entries and re-scores them ARGV[3] ms into the
+// future, leasing them to the caller until it removes them
+var claimDueScript = redis.NewScript(`
+local entries = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+local leaseUntil = tonumber(ARGV[1]) + tonumber(ARGV[3])
+for _, entry in ipairs(entries) do
+	redis.call("ZADD", KEYS[1], leaseUntil, entry)
+end
+return entries
+`)
+
+
+func (r *RedisClient) ClaimDueRetries(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]string, error) {
+	return claimDueScript.Run(ctx, r.client, []string{retryScheduleKey}, now.UnixMilli(), limit, lease.Milliseconds()).StringSlice()
+}
+
+
+func (r *RedisClient) CompleteRetry(ctx context.Context, entry string) error {
+	return r.client.ZRem(ctx, retryScheduleKey, entry).Err()
+}
+
+
+func (r *RedisClient) MarkRetryAlerted(ctx context.Context, notificationID string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, fmt.Sprintf("retry:alerted:%s", notificationID), 1, ttl).Result()
+}
+
+
+func (r *RedisClient) ParkRetry(ctx context.Context, entry string) error {
+	return r.client.LPush(ctx, retryParkedKey, entry).Err()
+}
+
+
+const (
+	webhookScheduleKey = "webhooks:scheduled"
+	webhookDeadKey     = "webhooks:dead"
+)
+
+
+// ErrReplayJobNotFound is returned for unknown or expired replay jobs
+var ErrReplayJobNotFound = errors.New("replay job not found")
+
+
+// SetReplayJob stores a background replay's progress for ttl
+func (r *RedisClient) SetReplayJob(ctx context.Context, jobID, job string, ttl time.Duration) error {
+	return r.client.Set(ctx, fmt.Sprintf("replay:job:%s", jobID), job, ttl).Err()
+}
+
+
+func (r *RedisClient) GetReplayJob(ctx context.Context, jobID string) (string, error) {
+	val, err := r.client.Get(ctx, fmt.Sprintf("replay:job:%s", jobID)).Result()
+	if err == redis.Nil {
+		return "", ErrReplayJobNotFound
+	}
+	return val, err
+}
+
+
+// ErrWebhookNotFound is returned when no such subscription exists
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+
+
+func webhookSubscriptionsKey(owner string) string {
+	return fmt.Sprintf("webhooks:subscriptions:%s", owner)
+}
+
+
+func (r *RedisClient) SaveWebhookSubscription(ctx context.Context, owner, id, entry string) error {
+	return r.client.HSet(ctx, webhookSubscriptionsKey(owner), id, entry).Err()
+}
+
+
+func (r *RedisClient) GetWebhookSubscription(ctx context.Context, owner, id string) (string, error) {
+	val, err := r.client.HGet(ctx, webhookSubscriptionsKey(owner), id).Result()
+	if err == redis.Nil {
+		return "", ErrWebhookNotFound
+	}
+	return val, err
+}
+
+
+func (r *RedisClient) ListWebhookSubscriptions(ctx context.Context, owner string) ([]string, error) {
+	return r.client.HVals(ctx, webhookSubscriptionsKey(owner)).Result()
+}
+
+
+func (r *RedisClient) CountWebhookSubscriptions(ctx context.Context, owner string) (int64, error) {
+	return r.client.HLen(ctx, webhookSubscriptionsKey(owner)).Result()
+}
+
+
+// DeleteWebhookSubscription reports whether the subscription existed
+func (r *RedisClient) DeleteWebhookSubscription(ctx context.Context, owner, id string) (bool, error) {
+	n, err := r.client.HDel(ctx, webhookSubscriptionsKey(owner), id).Result()
+	return n > 0, err
+}
+
+
+func (r *RedisClient) ScheduleWebhook(ctx context.Context, entry string, at time.Time) error {
+	return r.client.ZAdd(ctx, webhookScheduleKey, redis.Z{Score: float64(at.UnixMilli()), Member: entry}).Err()
+}
+
+
+func (r *RedisClient) PopDueWebhooks(ctx context.Context, now time.Time, limit int64) ([]string, error) {
+	return popDueScript.Run(ctx, r.client, []string{webhookScheduleKey}, now.UnixMilli(), limit).StringSlice()
+}
+
+
+func (r *RedisClient) DeadLetterWebhook(ctx context.Context, entry string) error {
+	return r.client.LPush(ctx, webhookDeadKey, entry).Err()
+}
+
+
+// CompleteLease marks a leased queue message as processed.
+func (r *RedisClient) CompleteLease(ctx context.Context, leaseID string, ttl time.Duration) error {
+	return r.client.Set(ctx, fmt.Sprintf("lease:%s", leaseID), "done", ttl).Err()
+}
+
+
+func (r *RedisClient) IsLeaseCompleted(ctx context.Context, leaseID string) (bool, error) {
+	n, err := r.client.Exists(ctx, fmt.Sprintf("lease:%s", leaseID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+
+// ProviderHealthKey is the hash delivery workers report provider health
+// to, one JSON-encoded models.ProviderHealth per provider name
+const ProviderHealthKey = "provider:health"
+
+
+// ProviderHealthReports returns the raw worker reports keyed by provider
+func (r *RedisClient) ProviderHealthReports(ctx context.Context) (map[string]string, error) {
+	return r.client.HGetAll(ctx, ProviderHealthKey).Result()
+}
+
+
 func (r *RedisClient) HealthCheck(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
 }
 
 
 func (r *RedisClient) Close() error {
+	if r.replica != nil {
+		if err := r.replica.Close(); err != nil {
+			log.Printf("Error closing Redis replica client: %v", err)
+		}
+	}
 	if r.client != nil {
 		if err := r.client.Close(); err != nil {
 			log.Printf("Error closing Redis client: %v", err)
@@ -0,0 +1,305 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testRedisClient connects to a miniredis whose clock is frozen at now, so
+// scripts reading TIME see exactly what the test sets
+func testRedisClient(t *testing.T, now time.Time) (*RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	mr.SetTime(now)
+	r, err := NewRedisClient("redis://"+mr.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, mr
+}
+
+func TestAllowGCRA(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		burst    int64
+		// advance is the time between the initial burst and the refill
+		advance        time.Duration
+		wantBurst      int
+		wantRetryAfter time.Duration
+		wantRefill     int
+	}{
+		{
+			name:           "burst then sustained rate",
+			interval:       600 * time.Millisecond,
+			burst:          2,
+			advance:        1200 * time.Millisecond,
+			wantBurst:      3,
+			wantRetryAfter: 600 * time.Millisecond,
+			wantRefill:     2,
+		},
+		{
+			name:           "sub-millisecond interval",
+			interval:       200 * time.Microsecond,
+			burst:          4,
+			advance:        time.Millisecond,
+			wantBurst:      5,
+			wantRetryAfter: 200 * time.Microsecond,
+			wantRefill:     5,
+		},
+		{
+			name:           "fractional millisecond interval",
+			interval:       1500 * time.Microsecond,
+			burst:          1,
+			advance:        3 * time.Millisecond,
+			wantBurst:      2,
+			wantRetryAfter: 1500 * time.Microsecond,
+			wantRefill:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			r, mr := testRedisClient(t, now)
+			ctx := context.Background()
+
+			allowed := func() (int, GCRAResult) {
+				var n int
+				for {
+					result, err := r.AllowGCRA(ctx, "user-1", tt.interval, tt.burst)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !result.Allowed {
+						return n, result
+					}
+					n++
+				}
+			}
+
+			n, denied := allowed()
+			if n != tt.wantBurst {
+				t.Errorf("burst admitted %d, want %d", n, tt.wantBurst)
+			}
+			if denied.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("RetryAfter = %s, want %s", denied.RetryAfter, tt.wantRetryAfter)
+			}
+
+			mr.SetTime(now.Add(tt.advance))
+			if n, _ := allowed(); n != tt.wantRefill {
+				t.Errorf("after %s admitted %d, want %d", tt.advance, n, tt.wantRefill)
+			}
+		})
+	}
+}
+
+func TestNotificationSummary(t *testing.T) {
+	const hour = time.Hour
+	created := time.Now()
+
+	tests := []struct {
+		name string
+		// apply changes a fresh store; every notification starts pending
+		// with a one-hour status record
+		apply func(t *testing.T, r *RedisClient)
+		want  map[string]int64
+	}{
+		{
+			name:  "created",
+			apply: func(t *testing.T, r *RedisClient) {},
+			want:  map[string]int64{"pending": 3},
+		},
+		{
+			name: "transitions",
+			apply: func(t *testing.T, r *RedisClient) {
+				must(t, r.ReindexNotificationStatus(context.Background(), "n1", "user-1", "pending", "sent", created, hour, hour))
+				must(t, r.MarkNotificationUnread(context.Background(), "user-1", "n1", hour, hour))
+				must(t, r.ReindexNotificationStatus(context.Background(), "n2", "user-1", "pending", "failed", created, hour, hour))
+			},
+			want: map[string]int64{"pending": 1, "sent": 1, "failed": 1, SummaryUnreadField: 1},
+		},
+		{
+			name: "read twice",
+			apply: func(t *testing.T, r *RedisClient) {
+				must(t, r.ReindexNotificationStatus(context.Background(), "n1", "user-1", "pending", "sent", created, hour, hour))
+				must(t, r.MarkNotificationUnread(context.Background(), "user-1", "n1", hour, hour))
+				for range 2 {
+					if _, err := r.MarkNotificationRead(context.Background(), "user-1", "n1"); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			want: map[string]int64{"pending": 2, "sent": 1},
+		},
+		{
+			name: "duplicate sent update",
+			apply: func(t *testing.T, r *RedisClient) {
+				for range 2 {
+					must(t, r.ReindexNotificationStatus(context.Background(), "n1", "user-1", "pending", "sent", created, hour, hour))
+					must(t, r.MarkNotificationUnread(context.Background(), "user-1", "n1", hour, hour))
+				}
+			},
+			want: map[string]int64{"pending": 2, "sent": 1, SummaryUnreadField: 1},
+		},
+		{
+			name: "deleted",
+			apply: func(t *testing.T, r *RedisClient) {
+				must(t, r.UnindexNotification(context.Background(), "n3", "user-1", "welcome", "pending"))
+			},
+			want: map[string]int64{"pending": 2},
+		},
+		{
+			name: "status records expired",
+			apply: func(t *testing.T, r *RedisClient) {
+				must(t, r.ReindexNotificationStatus(context.Background(), "n1", "user-1", "pending", "sent", created, 10*time.Millisecond, hour))
+				must(t, r.MarkNotificationUnread(context.Background(), "user-1", "n1", 10*time.Millisecond, hour))
+				time.Sleep(20 * time.Millisecond)
+			},
+			want: map[string]int64{"pending": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := testRedisClient(t, time.Now())
+			ctx := context.Background()
+			for _, id := range []string{"n1", "n2", "n3"} {
+				must(t, r.IndexNotification(ctx, id, "user-1", "welcome", "pending", created, hour, hour))
+			}
+			tt.apply(t, r)
+
+			got, err := r.GetNotificationSummary(ctx, "user-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("summary = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchNotifications(t *testing.T) {
+	const week = 7 * 24 * time.Hour
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	r, _ := testRedisClient(t, time.Now())
+	ctx := context.Background()
+	for _, n := range []struct {
+		id, user, template, status string
+		created                    time.Time
+	}{
+		{"n1", "user-1", "welcome", "pending", at(0)},
+		{"n2", "user-1", "reset", "pending", at(10)},
+		{"n3", "user-2", "welcome", "pending", at(20)},
+		{"n4", "user-1", "welcome", "pending", at(30)},
+	} {
+		must(t, r.IndexNotification(ctx, n.id, n.user, n.template, n.status, n.created, week, week))
+	}
+	must(t, r.ReindexNotificationStatus(ctx, "n4", "user-1", "pending", "failed", at(30), week, week))
+
+	user1 := NotificationIndexKey("user_id", "user-1")
+	welcome := NotificationIndexKey("template_id", "welcome")
+	pending := NotificationIndexKey("status", "pending")
+
+	tests := []struct {
+		name      string
+		indexes   []string
+		from, to  time.Time
+		offset    int64
+		count     int64
+		wantIDs   []string
+		wantTotal int64
+	}{
+		{name: "all, newest first", from: at(0), to: at(60), count: 10, wantIDs: []string{"n4", "n3", "n2", "n1"}, wantTotal: 4},
+		{name: "one index", indexes: []string{user1}, from: at(0), to: at(60), count: 10, wantIDs: []string{"n4", "n2", "n1"}, wantTotal: 3},
+		{name: "indexes are ANDed", indexes: []string{user1, welcome}, from: at(0), to: at(60), count: 10, wantIDs: []string{"n4", "n1"}, wantTotal: 2},
+		{name: "reindexed status", indexes: []string{user1, welcome, pending}, from: at(0), to: at(60), count: 10, wantIDs: []string{"n1"}, wantTotal: 1},
+		{name: "time window is inclusive", from: at(10), to: at(20), count: 10, wantIDs: []string{"n3", "n2"}, wantTotal: 2},
+		{name: "paged", from: at(0), to: at(60), offset: 1, count: 2, wantIDs: []string{"n3", "n2"}, wantTotal: 4},
+		{name: "no match", indexes: []string{NotificationIndexKey("user_id", "user-3")}, from: at(0), to: at(60), count: 10, wantTotal: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, total, err := r.SearchNotifications(ctx, tt.indexes, tt.from, tt.to, tt.offset, tt.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ids, tt.wantIDs) || total != tt.wantTotal {
+				t.Errorf("SearchNotifications = %v (total %d), want %v (total %d)", ids, total, tt.wantIDs, tt.wantTotal)
+			}
+		})
+	}
+
+	// Intersections use scratch keys that must not pile up
+	keys, err := r.client.Keys(ctx, "idx:notification:search:*").Result()
+	if err != nil || len(keys) != 0 {
+		t.Errorf("scratch keys left behind: %v (%v)", keys, err)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErrClosed(t *testing.T) {
+	calls := []struct {
+		name string
+		call func(r *RedisClient) error
+	}{
+		{name: "command", call: func(r *RedisClient) error {
+			_, err := r.GetNotificationStatusForUpdate(context.Background(), "n1")
+			return err
+		}},
+		{name: "replica read", call: func(r *RedisClient) error {
+			_, err := r.GetNotificationStatus(context.Background(), "n1")
+			return err
+		}},
+		{name: "pipeline", call: func(r *RedisClient) error {
+			_, err := r.IncrementRateLimit(context.Background(), "user-1", time.Minute)
+			return err
+		}},
+		{name: "script", call: func(r *RedisClient) error {
+			_, err := r.ReserveNotificationID(context.Background(), "n1", time.Minute)
+			return err
+		}},
+	}
+
+	for _, tt := range calls {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mr := testRedisClient(t, time.Now())
+			must(t, r.UseReplica("redis://"+mr.Addr(), 0))
+			if err := tt.call(r); err != nil && !errors.Is(err, ErrNotificationNotFound) {
+				t.Fatalf("open client = %v", err)
+			}
+
+			must(t, r.Close())
+			if err := tt.call(r); !errors.Is(err, ErrClosed) {
+				t.Errorf("after Close = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestErrClosedOnlyForClosedClient(t *testing.T) {
+	r, mr := testRedisClient(t, time.Now())
+	mr.Close()
+
+	_, err := r.GetNotificationStatusForUpdate(context.Background(), "n1")
+	if err == nil || errors.Is(err, ErrClosed) || errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("with Redis down = %v, want a connection error other than ErrClosed", err)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tobey0x/api-gateway/internal/netutil"
+)
+
+// ErrAttachmentURL means an attachment value isn't an http(s) URL
+var ErrAttachmentURL = errors.New("attachment must be an http or https URL")
+
+// ErrAttachmentHost means an attachment URL, or a redirect from it,
+// resolved to a loopback, private, link-local or otherwise non-public
+// address, which the gateway refuses to contact
+var ErrAttachmentHost = errors.New("attachment host is not a public address")
+
+// maxAttachmentRedirects bounds the redirects followed by a HEAD
+const maxAttachmentRedirects = 5
+
+// AttachmentChecker sizes URL attachments with a HEAD request, so oversized
+// ones can be refused before they are queued. Callers choose the URL, so
+// every connection, including each redirect's, is checked after DNS
+// resolution and refused unless the address is public.
+type AttachmentChecker struct {
+	httpClient *http.Client
+}
+
+// NewAttachmentChecker makes HEAD requests bounded by the caller's context
+func NewAttachmentChecker() *AttachmentChecker {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: netutil.PublicAddressOnly,
+	}
+	return &AttachmentChecker{httpClient: &http.Client{
+		Transport: &http.Transport{
+			// No proxy: the dialer must see the attachment host itself
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: checkAttachmentRedirect,
+	}}
+}
+
+// checkAttachmentRedirect keeps redirects on http(s) and bounds them; the
+// dialer vets the address each one connects to
+func checkAttachmentRedirect(req *http.Request, via []*http.Request) error {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return ErrAttachmentURL
+	}
+	if len(via) >= maxAttachmentRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxAttachmentRedirects)
+	}
+	return nil
+}
+
+// Size returns the attachment's Content-Length, or -1 when the server
+// doesn't send one. Non-2xx responses are errors. Non-public hosts wrap
+// ErrAttachmentHost.
+func (a *AttachmentChecker) Size(ctx context.Context, rawURL string) (int64, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 0, ErrAttachmentURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, netutil.ErrNonPublicAddress) {
+			return 0, ErrAttachmentHost
+		}
+		return 0, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("attachment returned status %d", resp.StatusCode)
+	}
+	return resp.ContentLength, nil
+}
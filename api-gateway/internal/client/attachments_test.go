@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheckAttachmentRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		hops    int
+		wantErr bool
+	}{
+		{name: "https", target: "https://cdn.example.com/a.pdf", hops: 1},
+		{name: "non-http scheme", target: "file:///etc/passwd", hops: 1, wantErr: true},
+		{name: "too many hops", target: "https://cdn.example.com/a.pdf", hops: maxAttachmentRedirects, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.target)
+			via := make([]*http.Request, tt.hops)
+			err := checkAttachmentRedirect(&http.Request{URL: u}, via)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAttachmentRedirect = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSizeRefusesInternalHosts(t *testing.T) {
+	probed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = true
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	// By address, and by a name that resolves to loopback
+	for _, rawURL := range []string{srv.URL + "/a.pdf", "http://localhost:" + u.Port() + "/a.pdf"} {
+		_, err := NewAttachmentChecker().Size(context.Background(), rawURL)
+		if !errors.Is(err, ErrAttachmentHost) {
+			t.Errorf("Size(%s) = %v, want ErrAttachmentHost", rawURL, err)
+		}
+	}
+	if probed {
+		t.Error("internal host was contacted")
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		want    int64
+		wantErr error
+	}{
+		{
+			name: "content length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "2048")
+			},
+			want: 2048,
+		},
+		{
+			name: "chunked",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Transfer-Encoding", "chunked")
+			},
+			want: -1,
+		},
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr: errors.New("attachment returned status 404"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			// The test server is on loopback, so the address guard is left out
+			checker := &AttachmentChecker{httpClient: srv.Client()}
+			got, err := checker.Size(context.Background(), srv.URL+"/a.pdf")
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Fatalf("Size error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Size = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewAttachmentChecker().Size(context.Background(), "ftp://example.com/a.pdf"); !errors.Is(err, ErrAttachmentURL) {
+		t.Errorf("Size(ftp) = %v, want ErrAttachmentURL", err)
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tobey0x/api-gateway/internal/metrics"
+)
+
+// ErrCircuitOpen is returned while the breaker is rejecting calls
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker opens after a run of consecutive failures and lets a single
+// probe through once resetTimeout has elapsed.
+type CircuitBreaker struct {
+	mu           sync.Mutex
+	name         string
+	threshold    int
+	resetTimeout time.Duration
+	state        BreakerState
+	failures     int
+	openedAt     time.Time
+	probing      bool
+}
+
+func NewCircuitBreaker(name string, threshold int, resetTimeout time.Duration) *CircuitBreaker {
+	metrics.CircuitBreakerState.WithLabelValues(name).Set(float64(StateClosed))
+	return &CircuitBreaker{
+		name:         name,
+		threshold:    threshold,
+		resetTimeout: resetTimeout,
+	}
+}
+
+// Allow reports whether a call may proceed
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.resetTimeout {
+			return ErrCircuitOpen
+		}
+		b.transition(StateHalfOpen)
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != StateClosed {
+		b.transition(StateClosed)
+	}
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.transition(StateOpen)
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// RetryAfter is how long until an open breaker admits a probe
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(0, b.resetTimeout-time.Since(b.openedAt))
+}
+
+func (b *CircuitBreaker) transition(to BreakerState) {
+	from := b.state
+	b.state = to
+
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(to))
+	metrics.CircuitBreakerTransitions.WithLabelValues(b.name, from.String(), to.String()).Inc()
+	log.Printf("Circuit breaker %s: %s -> %s", b.name, from, to)
+}
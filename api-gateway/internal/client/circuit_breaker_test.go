@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+)
+
+func metricValue(t *testing.T, m prometheus.Metric) float64 {
+	t.Helper()
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Gauge != nil {
+		return out.GetGauge().GetValue()
+	}
+	return out.GetCounter().GetValue()
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	name := t.Name()
+	b := NewCircuitBreaker(name, 2, 20*time.Millisecond)
+	state := metrics.CircuitBreakerState.WithLabelValues(name)
+	opened := metrics.CircuitBreakerTransitions.WithLabelValues(name, "closed", "open")
+	reopened := metrics.CircuitBreakerTransitions.WithLabelValues(name, "half-open", "open")
+	closed := metrics.CircuitBreakerTransitions.WithLabelValues(name, "half-open", "closed")
+	// Counters are process-wide, so compare against their starting values
+	openedBefore, reopenedBefore, closedBefore := metricValue(t, opened), metricValue(t, reopened), metricValue(t, closed)
+
+	// A success resets the run of failures
+	b.Failure()
+	b.Success()
+	b.Failure()
+	if b.State() != StateClosed || b.Allow() != nil {
+		t.Fatalf("state = %s after a broken run of failures, want closed", b.State())
+	}
+
+	b.Failure()
+	if b.State() != StateOpen || metricValue(t, state) != float64(StateOpen) || metricValue(t, opened) != openedBefore+1 {
+		t.Fatalf("state = %s after reaching the threshold, want open", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow while open = %v, want ErrCircuitOpen", err)
+	}
+	if wait := b.RetryAfter(); wait <= 0 || wait > 20*time.Millisecond {
+		t.Errorf("RetryAfter = %s, want within the reset timeout", wait)
+	}
+
+	// After the timeout one probe is let through and a failed probe reopens
+	time.Sleep(25 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe Allow = %v", err)
+	}
+	if b.State() != StateHalfOpen || metricValue(t, state) != float64(StateHalfOpen) {
+		t.Errorf("state = %s while probing, want half-open", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second call while probing = %v, want ErrCircuitOpen", err)
+	}
+	b.Failure()
+	if b.State() != StateOpen || metricValue(t, reopened) != reopenedBefore+1 {
+		t.Fatalf("state = %s after a failed probe, want open", b.State())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe Allow = %v", err)
+	}
+	b.Success()
+	if b.State() != StateClosed || metricValue(t, state) != float64(StateClosed) || metricValue(t, closed) != closedBefore+1 {
+		t.Errorf("state = %s after a successful probe, want closed", b.State())
+	}
+	if b.RetryAfter() != 0 {
+		t.Errorf("RetryAfter = %s while closed, want 0", b.RetryAfter())
+	}
+}
+
+func TestUserServiceClientUsesBreaker(t *testing.T) {
+	var calls atomic.Int32
+	userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer userService.Close()
+
+	c := NewUserServiceClient(userService.URL, NewCircuitBreaker(t.Name(), 2, time.Minute))
+	ctx := context.Background()
+	for range 2 {
+		if _, err := c.GetUserProfile(ctx, "user-1", ""); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("GetUserProfile = %v, want an upstream error", err)
+		}
+	}
+	if _, err := c.GetUserProfile(ctx, "user-1", ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("GetUserProfile after the threshold = %v, want ErrCircuitOpen", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("user service called %d times, want 2", got)
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrUnavailable means the User Service could not answer: it was
+// unreachable, returned a 5xx, or its circuit breaker is open.
+var ErrUnavailable = errors.New("user service unavailable")
+
+const (
+	// maxErrorBodyRead bounds how much of an error body is read at all
+	maxErrorBodyRead = 64 << 10
+	// maxErrorDetail bounds the detail embedded in the returned error
+	maxErrorDetail = 256
+)
+
+var (
+	htmlTagPattern    = regexp.MustCompile(`(?s)<script.*?</script>|<style.*?</style>|<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// upstreamError builds an error for a non-OK User Service response. JSON
+// bodies contribute their message field; anything else (e.g. an HTML error
+// page from a proxy) is stripped of markup and truncated so infra details
+// don't leak into gateway errors.
+func upstreamError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyRead))
+	return fmt.Errorf("user service returned status %d: %s", resp.StatusCode, sanitizeErrorBody(resp.Header.Get("Content-Type"), body))
+}
+
+func sanitizeErrorBody(contentType string, body []byte) string {
+	if strings.Contains(contentType, "json") || json.Valid(body) {
+		var payload struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		if err := json.Unmarshal(body, &payload); err == nil {
+			if payload.Message != "" {
+				return truncate(payload.Message, maxErrorDetail)
+			}
+			if payload.Error != "" {
+				return truncate(payload.Error, maxErrorDetail)
+			}
+		}
+	}
+
+	text := htmlTagPattern.ReplaceAllString(string(body), " ")
+	text = strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+	if text == "" {
+		return "empty response body"
+	}
+	return truncate(text, maxErrorDetail)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizeErrorBody(t *testing.T) {
+	long := strings.Repeat("é", maxErrorDetail+10)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{name: "json message", contentType: "application/json", body: `{"message":"user not found","error":"E404"}`, want: "user not found"},
+		{name: "json error", contentType: "application/json; charset=utf-8", body: `{"error":"bad token"}`, want: "bad token"},
+		{name: "json without content type", body: `{"message":"user not found"}`, want: "user not found"},
+		{name: "json without a message", contentType: "application/json", body: `{"code":7}`, want: `{"code":7}`},
+		{
+			name:        "html page",
+			contentType: "text/html",
+			body:        "<html><head><style>body{color:red}</style><script>track()</script></head>\n<body><h1>502   Bad Gateway</h1><hr>nginx/1.25.3</body></html>",
+			want:        "502 Bad Gateway nginx/1.25.3",
+		},
+		{name: "plain text", contentType: "text/plain", body: "  upstream\n\tconnect error  ", want: "upstream connect error"},
+		{name: "empty", contentType: "text/html", body: "<html></html>", want: "empty response body"},
+		{name: "long text truncated on runes", contentType: "text/plain", body: long, want: long[:2*maxErrorDetail] + "..."},
+		{name: "long json message truncated", contentType: "application/json", body: `{"message":"` + long + `"}`, want: long[:2*maxErrorDetail] + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeErrorBody(tt.contentType, []byte(tt.body)); got != tt.want {
+				t.Errorf("sanitizeErrorBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorFromHTMLPage(t *testing.T) {
+	userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<html><body><h1>Not Found</h1>" + strings.Repeat("<p>internal detail</p>", 10000) + "</body></html>"))
+	}))
+	defer userService.Close()
+
+	c := NewUserServiceClient(userService.URL, NewCircuitBreaker(t.Name(), 5, time.Minute))
+	_, err := c.GetUserProfile(context.Background(), "user-1", "")
+	if err == nil {
+		t.Fatal("GetUserProfile succeeded on a 404")
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "user service returned status 404: Not Found internal detail") {
+		t.Errorf("error = %q", msg)
+	}
+	if strings.Contains(msg, "<") || len(msg) > maxErrorDetail+100 {
+		t.Errorf("error kept markup or was not truncated: %d bytes", len(msg))
+	}
+}
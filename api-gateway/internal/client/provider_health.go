@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// ProviderProber checks delivery providers' health URLs. Any 2xx response
+// counts as healthy.
+type ProviderProber struct {
+	urls       map[string]string
+	httpClient *http.Client
+}
+
+// NewProviderProber probes urls, keyed by provider name, each bounded by
+// timeout.
+func NewProviderProber(urls map[string]string, timeout time.Duration) *ProviderProber {
+	return &ProviderProber{
+		urls: urls,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Name identifies the prober in provider health responses
+func (p *ProviderProber) Name() string {
+	return "probe"
+}
+
+// ProviderHealth probes every provider concurrently. Failures mark the
+// provider degraded rather than failing the whole check.
+func (p *ProviderProber) ProviderHealth(ctx context.Context) (map[string]models.ProviderHealth, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]models.ProviderHealth, len(p.urls))
+	)
+	for name, url := range p.urls {
+		wg.Go(func() {
+			health := models.ProviderHealth{Status: models.ProviderHealthy, Source: p.Name(), CheckedAt: time.Now()}
+			if err := p.probe(ctx, url); err != nil {
+				health.Status = models.ProviderDegraded
+				health.Detail = err.Error()
+			}
+			mu.Lock()
+			results[name] = health
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (p *ProviderProber) probe(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("provider returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 )
@@ -14,18 +13,37 @@ import (
 type UserServiceClient struct {
 	baseURL    string
 	httpClient *http.Client
+	breaker    *CircuitBreaker
 }
 
-// NewUserServiceClient creates a new User Service client
-func NewUserServiceClient(baseURL string) *UserServiceClient {
+// NewUserServiceClient creates a new User Service client. The breaker may be
+// shared with other callers of the User Service so they fail fast together.
+func NewUserServiceClient(baseURL string, breaker *CircuitBreaker) *UserServiceClient {
 	return &UserServiceClient{
 		baseURL: baseURL,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		breaker: breaker,
 	}
 }
 
+// do executes req through the circuit breaker. Transport errors and 5xx
+// responses count as failures.
+func (c *UserServiceClient) do(req *http.Request) (*http.Response, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		c.breaker.Failure()
+	} else {
+		c.breaker.Success()
+	}
+	return resp, err
+}
+
 // UserProfile represents the user profile structure from User Service
 type UserProfile struct {
 	ID        string                `json:"id"`
@@ -73,18 +91,20 @@ func (c *UserServiceClient) GetUserProfile(ctx context.Context, userID string, a
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	// The profile-by-id route is public, so the token is optional
+	if accessToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("user service returned status %d: %s", resp.StatusCode, string(body))
+		return nil, upstreamError(resp)
 	}
 
 	var response UserServiceResponse
@@ -118,15 +138,14 @@ func (c *UserServiceClient) GetUserPreference(ctx context.Context, userID string
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("user service returned status %d: %s", resp.StatusCode, string(body))
+		return nil, upstreamError(resp)
 	}
 
 	var response UserServiceResponse
@@ -161,9 +180,9 @@ func (c *UserServiceClient) ValidateToken(ctx context.Context, accessToken strin
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, fmt.Errorf("%w: failed to make request: %v", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -171,9 +190,11 @@ func (c *UserServiceClient) ValidateToken(ctx context.Context, accessToken strin
 		return nil, fmt.Errorf("invalid or expired token")
 	}
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, upstreamError(resp))
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("user service returned status %d: %s", resp.StatusCode, string(body))
+		return nil, upstreamError(resp)
 	}
 
 	var response UserServiceResponse
@@ -222,15 +243,14 @@ func (c *UserServiceClient) RefreshToken(ctx context.Context, refreshToken strin
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("user service returned status %d: %s", resp.StatusCode, string(body))
+		return nil, upstreamError(resp)
 	}
 
 	var response UserServiceResponse
@@ -260,7 +280,7 @@ func (c *UserServiceClient) HealthCheck(ctx context.Context) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to make request: %w", err)
 	}
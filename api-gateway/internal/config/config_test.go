@@ -0,0 +1,485 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr string
+	}{
+		{name: "defaults", mutate: func(c *Config) {}},
+		{name: "compression enabled", mutate: func(c *Config) { c.RabbitMQ.CompressThresholdBytes = 1024 }},
+		{name: "alert threshold at max retries", mutate: func(c *Config) { c.Retry.AlertThreshold = 3 }},
+		{
+			name:    "alert threshold above max retries",
+			mutate:  func(c *Config) { c.Retry.AlertThreshold = 4 },
+			wantErr: "retry.alert_threshold must be in 0..3",
+		},
+		{
+			name:    "negative compression threshold",
+			mutate:  func(c *Config) { c.RabbitMQ.CompressThresholdBytes = -1 },
+			wantErr: "rabbitmq.compress_threshold_bytes must be >= 0",
+		},
+		{
+			name:    "zero decompressed body limit",
+			mutate:  func(c *Config) { c.Server.MaxDecompressedBodyBytes = 0 },
+			wantErr: "server.max_decompressed_body_bytes must be > 0",
+		},
+		{name: "trusted health network", mutate: func(c *Config) { c.Health.TrustedCIDRs = []string{"10.0.0.0/8", "fd00::/8"} }},
+		{
+			name:    "malformed health network",
+			mutate:  func(c *Config) { c.Health.TrustedCIDRs = []string{"10.0.0.1"} },
+			wantErr: "health.trusted_cidrs",
+		},
+		{name: "retention override", mutate: func(c *Config) { c.Notifications.RetentionSeconds = map[string]int{"email": 3600} }},
+		{
+			name:    "zero retention",
+			mutate:  func(c *Config) { c.Notifications.RetentionSeconds = map[string]int{"push": 0} },
+			wantErr: "notifications.retention_seconds.push must be > 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaults()
+			tt.mutate(c)
+			err := c.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFileServerTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+	}{
+		{
+			name:     "json",
+			file:     "config.json",
+			contents: `{"server": {"read_timeout_seconds": 15, "write_timeout_seconds": 20, "shutdown_timeout_seconds": 30}}`,
+		},
+		{
+			name:     "yaml",
+			file:     "config.yaml",
+			contents: "server:\n  read_timeout_seconds: 15\n  write_timeout_seconds: 20\n  shutdown_timeout_seconds: 30\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := defaults()
+			if err := loadFile(path, c); err != nil {
+				t.Fatalf("loadFile() = %v", err)
+			}
+			if got := c.Server.ReadTimeout(); got != 15*time.Second {
+				t.Errorf("ReadTimeout() = %s, want 15s", got)
+			}
+			if got := c.Server.WriteTimeout(); got != 20*time.Second {
+				t.Errorf("WriteTimeout() = %s, want 20s", got)
+			}
+			if got := c.Server.ShutdownTimeout(); got != 30*time.Second {
+				t.Errorf("ShutdownTimeout() = %s, want 30s", got)
+			}
+		})
+	}
+}
+
+func TestLoadFileEncryptionKeys(t *testing.T) {
+	const key = "MDEyMzQ1Njc4OWFiY2RlZg=="
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+	}{
+		{
+			name:     "json",
+			file:     "config.json",
+			contents: `{"encryption": {"keys": {"k1": "` + key + `"}, "active_key_id": "k1"}}`,
+		},
+		{
+			name:     "yaml",
+			file:     "config.yaml",
+			contents: "encryption:\n  keys:\n    k1: " + key + "\n  active_key_id: k1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := defaults()
+			if err := loadFile(path, c); err != nil {
+				t.Fatalf("loadFile() = %v", err)
+			}
+			if got := c.Encryption.Keys["k1"]; got != key || c.Encryption.ActiveKeyID != "k1" {
+				t.Errorf("encryption = %+v, want key k1 active", c.Encryption)
+			}
+			if err := c.Validate(); err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "server:\n  port: \"9000\"\n  read_timeout_seconds: 15\nredis:\n  url: redis://file:6379\n",
+		"config.json": `{"server": {"port": "9000", "read_timeout_seconds": 15}, "redis": {"url": "redis://file:6379"}}`,
+	}
+	tests := []struct {
+		name            string
+		file            bool
+		env             map[string]string
+		wantPort        string
+		wantReadTimeout time.Duration
+		wantRedisURL    string
+	}{
+		{name: "defaults", wantPort: "8080", wantReadTimeout: 10 * time.Second, wantRedisURL: defaults().Redis.URL},
+		{name: "file only", file: true, wantPort: "9000", wantReadTimeout: 15 * time.Second, wantRedisURL: "redis://file:6379"},
+		{
+			name:            "env only",
+			env:             map[string]string{"PORT": "9100", "SERVER_READ_TIMEOUT_SECONDS": "20", "REDIS_URL": "redis://env:6379"},
+			wantPort:        "9100",
+			wantReadTimeout: 20 * time.Second,
+			wantRedisURL:    "redis://env:6379",
+		},
+		{
+			name:            "env wins over file",
+			file:            true,
+			env:             map[string]string{"PORT": "9100", "REDIS_URL": "redis://env:6379"},
+			wantPort:        "9100",
+			wantReadTimeout: 15 * time.Second,
+			wantRedisURL:    "redis://env:6379",
+		},
+	}
+
+	for name, contents := range files {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				// Load reads .env from the working directory
+				t.Chdir(t.TempDir())
+				t.Setenv("CONFIG_FILE", "")
+				for _, key := range []string{"PORT", "SERVER_READ_TIMEOUT_SECONDS", "SERVER_READ_TIMEOUT", "REDIS_URL"} {
+					t.Setenv(key, "")
+					os.Unsetenv(key)
+				}
+				if tt.file {
+					path := filepath.Join(t.TempDir(), name)
+					if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+						t.Fatal(err)
+					}
+					t.Setenv("CONFIG_FILE", path)
+				}
+				for key, value := range tt.env {
+					t.Setenv(key, value)
+				}
+
+				c, err := Load()
+				if err != nil {
+					t.Fatalf("Load() = %v", err)
+				}
+				if c.Server.Port != tt.wantPort {
+					t.Errorf("port = %q, want %q", c.Server.Port, tt.wantPort)
+				}
+				if got := c.Server.ReadTimeout(); got != tt.wantReadTimeout {
+					t.Errorf("ReadTimeout() = %s, want %s", got, tt.wantReadTimeout)
+				}
+				if c.Redis.URL != tt.wantRedisURL {
+					t.Errorf("redis url = %q, want %q", c.Redis.URL, tt.wantRedisURL)
+				}
+			})
+		}
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		env      map[string]string
+		wantErr  string
+	}{
+		{name: "unsupported extension", file: "config.toml", contents: "port = 1", wantErr: "unsupported config file extension"},
+		{name: "malformed yaml", file: "config.yaml", contents: "server: [", wantErr: "failed to parse"},
+		{name: "malformed json", file: "config.json", contents: `{"server":`, wantErr: "failed to parse"},
+		{name: "invalid file value", file: "config.json", contents: `{"server": {"port": "http"}}`, wantErr: "server.port must be numeric"},
+		{name: "invalid env value", file: "config.json", contents: `{}`, env: map[string]string{"PORT": "http"}, wantErr: "server.port must be numeric"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("PORT", "")
+			os.Unsetenv("PORT")
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("CONFIG_FILE", path)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetEnvAsInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		set   bool
+		want  int
+	}{
+		{name: "unset", want: 10},
+		{name: "valid", value: "25", set: true, want: 25},
+		{name: "invalid", value: "25s", set: true, want: 10},
+		{name: "empty", value: "", set: true, want: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.set {
+				t.Setenv("CONFIG_TEST_INT", tt.value)
+			}
+			if got := getEnvAsInt("CONFIG_TEST_INT", 10); got != tt.want {
+				t.Errorf("getEnvAsInt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusTTL(t *testing.T) {
+	n := NotificationConfig{
+		RetentionSeconds:         map[string]int{"email": 3600, "push": 60},
+		PriorityRetentionPercent: map[string]int{"high": 200, "low": 1},
+	}
+
+	tests := []struct {
+		notificationType string
+		priority         string
+		want             time.Duration
+	}{
+		{notificationType: "email", priority: "normal", want: time.Hour},
+		{notificationType: "push", priority: "normal", want: time.Minute},
+		{notificationType: "sms", priority: "normal", want: DefaultStatusRetention},
+		{notificationType: "email", priority: "high", want: 2 * time.Hour},
+		{notificationType: "email", priority: "low", want: MinStatusRetention},
+	}
+	for _, tt := range tests {
+		if got := n.StatusTTL(tt.notificationType, tt.priority); got != tt.want {
+			t.Errorf("StatusTTL(%s, %s) = %s, want %s", tt.notificationType, tt.priority, got, tt.want)
+		}
+	}
+
+	// Index entries must outlive every status record they point at
+	if got, want := n.MaxStatusTTL(), 2*DefaultStatusRetention; got != want {
+		t.Errorf("MaxStatusTTL = %s, want %s", got, want)
+	}
+	long := NotificationConfig{RetentionSeconds: map[string]int{"email": 30 * 24 * 3600}}
+	if got, want := long.MaxStatusTTL(), 30*24*time.Hour; got != want {
+		t.Errorf("MaxStatusTTL with a long override = %s, want %s", got, want)
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		wantStart  time.Duration
+		wantEnd    time.Duration
+		wantOK     bool
+		wantErr    bool
+	}{
+		{name: "unset"},
+		{name: "overnight", start: "22:00", end: "07:30", wantStart: 22 * time.Hour, wantEnd: 7*time.Hour + 30*time.Minute, wantOK: true},
+		{name: "daytime", start: "12:00", end: "13:00", wantStart: 12 * time.Hour, wantEnd: 13 * time.Hour, wantOK: true},
+		{name: "only start", start: "22:00", wantErr: true},
+		{name: "not HH:MM", start: "10pm", end: "07:00", wantErr: true},
+		{name: "out of range", start: "24:00", end: "07:00", wantErr: true},
+		{name: "empty window", start: "07:00", end: "07:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NotificationConfig{QuietHoursStart: tt.start, QuietHoursEnd: tt.end}
+			start, end, ok, err := n.QuietHours()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QuietHours() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if start != tt.wantStart || end != tt.wantEnd || ok != tt.wantOK {
+				t.Errorf("QuietHours() = %s, %s, %v; want %s, %s, %v", start, end, ok, tt.wantStart, tt.wantEnd, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadRetentionFromEnv(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("NOTIFICATION_RETENTION_SECONDS", "email=3600,push=60")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Notifications.StatusTTL("push", "normal"); got != time.Minute {
+		t.Errorf("push retention = %s, want 1m", got)
+	}
+
+	t.Setenv("NOTIFICATION_RETENTION_SECONDS", "email=-5")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "retention_seconds.email") {
+		t.Errorf("Load with a negative retention = %v, want a validation error", err)
+	}
+}
+
+func TestGetEnvAsListAndMap(t *testing.T) {
+	t.Setenv("CONFIG_TEST_LIST", " welcome, ,reset ")
+	if got := getEnvAsList("CONFIG_TEST_LIST", nil); !reflect.DeepEqual(got, []string{"welcome", "reset"}) {
+		t.Errorf("getEnvAsList() = %q", got)
+	}
+	if got := getEnvAsList("CONFIG_TEST_UNSET", []string{"default"}); !reflect.DeepEqual(got, []string{"default"}) {
+		t.Errorf("getEnvAsList() unset = %q", got)
+	}
+
+	t.Setenv("CONFIG_TEST_MAP", "email = email.v2,broken,push=push.v2")
+	want := map[string]string{"email": "email.v2", "push": "push.v2"}
+	if got := getEnvAsMap("CONFIG_TEST_MAP", nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("getEnvAsMap() = %v, want %v", got, want)
+	}
+}
+
+func TestNonReloadableChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{name: "unchanged"},
+		{
+			name: "reloadable sections only",
+			change: func(c *Config) {
+				c.RateLimit.MaxRequests = 5
+				c.Notifications.TemplateAllowlist = []string{"welcome"}
+				c.Notifications.Routes = map[string]string{"email": "email.v2"}
+			},
+		},
+		{name: "server", change: func(c *Config) { c.Server.Port = "9090" }, want: []string{"server"}},
+		{
+			name: "several sections",
+			change: func(c *Config) {
+				c.Auth.JWTSecret = "rotated"
+				c.Redis.DB = 2
+				c.RateLimit.MaxRequests = 5
+			},
+			want: []string{"redis", "auth"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, next := defaults(), defaults()
+			if tt.change != nil {
+				tt.change(next)
+			}
+			if got := current.NonReloadableChanges(next); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NonReloadableChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateAllowedAndRoutingKey(t *testing.T) {
+	open := NotificationConfig{}
+	if !open.TemplateAllowed("anything") {
+		t.Error("empty allowlist rejected a template")
+	}
+	if got := open.RoutingKey("email"); got != "email" {
+		t.Errorf("unrouted RoutingKey = %q, want email", got)
+	}
+
+	restricted := NotificationConfig{
+		TemplateAllowlist: []string{"welcome"},
+		Routes:            map[string]string{"email": "email.v2", "push": ""},
+	}
+	if !restricted.TemplateAllowed("welcome") || restricted.TemplateAllowed("reset") {
+		t.Error("allowlist not applied")
+	}
+	if got := restricted.RoutingKey("email"); got != "email.v2" {
+		t.Errorf("routed RoutingKey = %q, want email.v2", got)
+	}
+	if got := restricted.RoutingKey("push"); got != "push" {
+		t.Errorf("blank route RoutingKey = %q, want push", got)
+	}
+}
+
+func TestGetEnvAsDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		set   bool
+		want  time.Duration
+	}{
+		{name: "unset", want: 10 * time.Second},
+		{name: "valid", value: "1m30s", set: true, want: 90 * time.Second},
+		{name: "sub-second", value: "500ms", set: true, want: 500 * time.Millisecond},
+		{name: "bare number", value: "30", set: true, want: 10 * time.Second},
+		{name: "invalid", value: "soon", set: true, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.set {
+				t.Setenv("CONFIG_TEST_DURATION", tt.value)
+			}
+			if got := getEnvAsDuration("CONFIG_TEST_DURATION", 10*time.Second); got != tt.want {
+				t.Errorf("getEnvAsDuration() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvServerTimeoutDurations(t *testing.T) {
+	t.Setenv("SERVER_READ_TIMEOUT_SECONDS", "20")
+	t.Setenv("SERVER_READ_TIMEOUT", "45s")
+	t.Setenv("SERVER_WRITE_TIMEOUT_SECONDS", "20")
+	t.Setenv("SHUTDOWN_TIMEOUT", "1500ms")
+
+	c := defaults()
+	c.applyEnv()
+	if got := c.Server.ReadTimeout(); got != 45*time.Second {
+		t.Errorf("ReadTimeout() = %s, want the duration form to win with 45s", got)
+	}
+	if got := c.Server.WriteTimeout(); got != 20*time.Second {
+		t.Errorf("WriteTimeout() = %s, want 20s from the seconds form", got)
+	}
+	if got := c.Server.ShutdownTimeout(); got != 2*time.Second {
+		t.Errorf("ShutdownTimeout() = %s, want 1500ms rounded up to 2s", got)
+	}
+}
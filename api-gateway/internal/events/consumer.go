@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/handlers"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// Event is a domain event dropped on the events queue by another service
+type Event struct {
+	// EventID makes redeliveries idempotent when present
+	EventID   string                 `json:"event_id"`
+	EventType string                 `json:"event_type"`
+	UserID    string                 `json:"user_id"`
+	Priority  string                 `json:"priority,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type Enqueuer interface {
+	Enqueue(ctx context.Context, req models.NotificationRequest, opts handlers.EnqueueOptions) (*handlers.EnqueueResult, error)
+}
+
+// Consumer turns inbound events into notifications via the same create path
+// as the HTTP API.
+type Consumer struct {
+	mappings map[string]config.EventMapping
+	enqueuer Enqueuer
+}
+
+func NewConsumer(mappings map[string]config.EventMapping, enqueuer Enqueuer) *Consumer {
+	return &Consumer{
+		mappings: mappings,
+		enqueuer: enqueuer,
+	}
+}
+
+// Map converts an event into a validated notification request
+func (c *Consumer) Map(event Event) (models.NotificationRequest, error) {
+	mapping, ok := c.mappings[event.EventType]
+	if !ok {
+		return models.NotificationRequest{}, fmt.Errorf("no mapping for event type %q", event.EventType)
+	}
+
+	priority := mapping.Priority
+	if event.Priority != "" {
+		priority = event.Priority
+	}
+	if priority == "" {
+		priority = string(models.PriorityNormal)
+	}
+
+	req := models.NotificationRequest{
+		Type:       models.NotificationType(mapping.Type),
+		UserID:     event.UserID,
+		Priority:   models.Priority(priority),
+		TemplateID: mapping.TemplateID,
+		Variables:  event.Data,
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return models.NotificationRequest{}, fmt.Errorf("invalid notification for event %q: %w", event.EventType, err)
+	}
+	return req, nil
+}
+
+// Handle processes one queue message. Unmappable events are dropped since
+// redelivery can't fix them; transient enqueue failures are returned so the
+// message reappears after its visibility timeout.
+func (c *Consumer) Handle(ctx context.Context, body []byte) error {
+	var event Event
+	if err := models.DecodeJSON(body, &event); err != nil {
+		log.Printf("Dropping malformed event: %v", err)
+		return nil
+	}
+
+	req, err := c.Map(event)
+	if err != nil {
+		log.Printf("Dropping event %s: %v", event.EventID, err)
+		return nil
+	}
+
+	opts := handlers.EnqueueOptions{
+		Metadata: models.MessageMetadata{
+			UserAgent: "events-consumer/" + event.EventType,
+			Timestamp: time.Now(),
+		},
+	}
+	if event.EventID != "" {
+		opts.IdempotencyKey = "event:" + event.EventID
+	}
+
+	result, err := c.enqueuer.Enqueue(ctx, req, opts)
+	if err != nil {
+		if handlers.IsRetryable(err) {
+			return err
+		}
+		log.Printf("Dropping event %s: %v", event.EventID, err)
+		return nil
+	}
+
+	log.Printf("✓ Event %s (%s) -> notification %s [%s]", event.EventID, event.EventType, result.Response.NotificationID, result.Response.Status)
+	return nil
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/handlers"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+var testMappings = map[string]config.EventMapping{
+	"user.signed_up":    {Type: "email", TemplateID: "welcome"},
+	"order.shipped":     {Type: "push", TemplateID: "shipped", Priority: "high"},
+	"account.bad_type":  {Type: "sms", TemplateID: "sms"},
+	"account.no_tmpl":   {Type: "email"},
+	"account.bad_prior": {Type: "email", TemplateID: "welcome", Priority: "urgent"},
+}
+
+func TestMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   Event
+		want    models.NotificationRequest
+		wantErr string
+	}{
+		{
+			name:  "default priority",
+			event: Event{EventType: "user.signed_up", UserID: "user-1", Data: map[string]interface{}{"name": "Ada"}},
+			want:  models.NotificationRequest{Type: models.NotificationTypeEmail, UserID: "user-1", Priority: models.PriorityNormal, TemplateID: "welcome", Variables: map[string]interface{}{"name": "Ada"}},
+		},
+		{
+			name:  "mapping priority",
+			event: Event{EventType: "order.shipped", UserID: "user-1"},
+			want:  models.NotificationRequest{Type: models.NotificationTypePush, UserID: "user-1", Priority: models.PriorityHigh, TemplateID: "shipped"},
+		},
+		{
+			name:  "event priority wins",
+			event: Event{EventType: "order.shipped", UserID: "user-1", Priority: "low"},
+			want:  models.NotificationRequest{Type: models.NotificationTypePush, UserID: "user-1", Priority: models.PriorityLow, TemplateID: "shipped"},
+		},
+		{name: "unknown event type", event: Event{EventType: "user.deleted", UserID: "user-1"}, wantErr: "no mapping"},
+		{name: "missing user", event: Event{EventType: "user.signed_up"}, wantErr: "invalid notification"},
+		{name: "invalid event priority", event: Event{EventType: "user.signed_up", UserID: "user-1", Priority: "urgent"}, wantErr: "invalid notification"},
+		{name: "invalid mapping priority", event: Event{EventType: "account.bad_prior", UserID: "user-1"}, wantErr: "invalid notification"},
+		{name: "invalid mapping type", event: Event{EventType: "account.bad_type", UserID: "user-1"}, wantErr: "invalid notification"},
+		{name: "mapping without template", event: Event{EventType: "account.no_tmpl", UserID: "user-1"}, wantErr: "invalid notification"},
+	}
+
+	c := NewConsumer(testMappings, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Map(tt.event)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Map = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != tt.want.Type || got.UserID != tt.want.UserID || got.Priority != tt.want.Priority || got.TemplateID != tt.want.TemplateID {
+				t.Errorf("Map = %+v, want %+v", got, tt.want)
+			}
+			if len(got.Variables) != len(tt.want.Variables) {
+				t.Errorf("variables = %v, want %v", got.Variables, tt.want.Variables)
+			}
+		})
+	}
+}
+
+// stubEnqueuer fails with errs in turn, then succeeds
+type stubEnqueuer struct {
+	errs     []error
+	requests []models.NotificationRequest
+	opts     []handlers.EnqueueOptions
+}
+
+func (s *stubEnqueuer) Enqueue(_ context.Context, req models.NotificationRequest, opts handlers.EnqueueOptions) (*handlers.EnqueueResult, error) {
+	s.requests = append(s.requests, req)
+	s.opts = append(s.opts, opts)
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return &handlers.EnqueueResult{Response: models.NotificationResponse{NotificationID: "n1", Status: models.StatusPending}}, nil
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		enqueueErrs  []error
+		wantErr      bool
+		wantEnqueued int
+		wantKey      string
+	}{
+		{name: "enqueued", body: `{"event_id":"e1","event_type":"user.signed_up","user_id":"user-1"}`, wantEnqueued: 1, wantKey: "event:e1"},
+		{name: "enqueued without event id", body: `{"event_type":"user.signed_up","user_id":"user-1"}`, wantEnqueued: 1},
+		{name: "enqueue failed", body: `{"event_id":"e1","event_type":"user.signed_up","user_id":"user-1"}`, enqueueErrs: []error{errors.New("broker down")}, wantErr: true, wantEnqueued: 1, wantKey: "event:e1"},
+		{name: "malformed", body: `{"event_type":`},
+		{name: "unmapped", body: `{"event_id":"e1","event_type":"user.deleted","user_id":"user-1"}`},
+		{name: "invalid", body: `{"event_id":"e1","event_type":"user.signed_up"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enqueuer := &stubEnqueuer{errs: tt.enqueueErrs}
+			err := NewConsumer(testMappings, enqueuer).Handle(context.Background(), []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Handle = %v, want error %v", err, tt.wantErr)
+			}
+			if len(enqueuer.requests) != tt.wantEnqueued {
+				t.Fatalf("enqueued %d times, want %d", len(enqueuer.requests), tt.wantEnqueued)
+			}
+			if tt.wantEnqueued > 0 && enqueuer.opts[0].IdempotencyKey != tt.wantKey {
+				t.Errorf("idempotency key = %q, want %q", enqueuer.opts[0].IdempotencyKey, tt.wantKey)
+			}
+		})
+	}
+}
+
+// The retry consumer completes a message's lease, its ack, only when the
+// handler returns nil, so Handle must not return nil before the
+// notification is enqueued
+func TestHandleAcksOnlyAfterEnqueue(t *testing.T) {
+	enqueuer := &stubEnqueuer{errs: []error{errors.New("broker down"), errors.New("broker down")}}
+	c := NewConsumer(testMappings, enqueuer)
+	body := []byte(`{"event_id":"e1","event_type":"user.signed_up","user_id":"user-1"}`)
+
+	for delivery, wantAck := range []bool{false, false, true} {
+		err := c.Handle(context.Background(), body)
+		if acked := err == nil; acked != wantAck {
+			t.Fatalf("delivery %d: acked = %v, want %v (%v)", delivery+1, acked, wantAck, err)
+		}
+		if len(enqueuer.requests) != delivery+1 {
+			t.Fatalf("delivery %d: enqueued %d times", delivery+1, len(enqueuer.requests))
+		}
+	}
+	for i, opts := range enqueuer.opts {
+		if opts.IdempotencyKey != "event:e1" {
+			t.Errorf("attempt %d: idempotency key %q, want event:e1 so redeliveries dedupe", i+1, opts.IdempotencyKey)
+		}
+	}
+}
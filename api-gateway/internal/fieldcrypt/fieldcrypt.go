@@ -0,0 +1,159 @@
+// Package fieldcrypt encrypts individual notification variables with
+// AES-GCM so sensitive values stay opaque in the queue, the audit log and
+// anywhere else the message rests, and only holders of the key can read
+// them.
+//
+// An encrypted value is the string "enc:v1:<key id>:<base64url(nonce |
+// ciphertext)>", where the plaintext is the value's JSON encoding and the
+// key ID is the additional authenticated data. Keys are looked up by ID on
+// decrypt, so rotating the active key leaves older values readable as long
+// as their key stays in the keyring.
+package fieldcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix marks an encrypted value
+const Prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrMalformed  = errors.New("malformed encrypted value")
+)
+
+// Keyring encrypts with its active key and decrypts with any of its keys
+type Keyring struct {
+	aeads  map[string]cipher.AEAD
+	active string
+}
+
+// NewKeyring builds a keyring from base64-encoded 16, 24 or 32 byte AES
+// keys by ID. active names the key new values are encrypted with.
+func NewKeyring(keys map[string]string, active string) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", active)
+	}
+	k := &Keyring{aeads: make(map[string]cipher.AEAD, len(keys)), active: active}
+	for id, encoded := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %q must be non-empty and must not contain ':'", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not valid base64: %w", id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// IsEncrypted reports whether v is a value produced by Encrypt
+func IsEncrypted(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && strings.HasPrefix(s, Prefix)
+}
+
+// Encrypt seals v's JSON encoding with the active key
+func (k *Keyring) Encrypt(v interface{}) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal value: %w", err)
+	}
+	aead := k.aeads[k.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(k.active))
+	return Prefix + k.active + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt with whichever key sealed it.
+// Numbers come back as json.Number, as elsewhere in the gateway.
+func (k *Keyring) Decrypt(s string) (interface{}, error) {
+	rest, ok := strings.CutPrefix(s, Prefix)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, ErrMalformed
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with key %s: %w", id, err)
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(plaintext))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal value: %w", err)
+	}
+	return v, nil
+}
+
+// EncryptVariables returns a copy of variables with the named keys
+// encrypted. Missing names and values that are already encrypted are left
+// alone, so re-enqueueing an encrypted request doesn't encrypt twice.
+func (k *Keyring) EncryptVariables(variables map[string]interface{}, names []string) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(variables))
+	for name, v := range variables {
+		out[name] = v
+	}
+	for _, name := range names {
+		v, ok := out[name]
+		if !ok || IsEncrypted(v) {
+			continue
+		}
+		encrypted, err := k.Encrypt(v)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		out[name] = encrypted
+	}
+	return out, nil
+}
+
+// DecryptVariables returns a copy of variables with every encrypted value
+// decrypted; it is what a worker holding the keys runs before rendering.
+func (k *Keyring) DecryptVariables(variables map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(variables))
+	for name, v := range variables {
+		if s, ok := v.(string); ok && IsEncrypted(s) {
+			decrypted, err := k.Decrypt(s)
+			if err != nil {
+				return nil, fmt.Errorf("variable %s: %w", name, err)
+			}
+			v = decrypted
+		}
+		out[name] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,195 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	key1 = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	key2 = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func testKeyring(t *testing.T, keys map[string]string, active string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(keys, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := testKeyring(t, map[string]string{"k1": key1}, "k1")
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{name: "string", value: "123-45-6789", want: "123-45-6789"},
+		{name: "number", value: 42, want: json.Number("42")},
+		{name: "large integer", value: int64(1) << 60, want: json.Number("1152921504606846976")},
+		{name: "bool", value: true, want: true},
+		{name: "object", value: map[string]interface{}{"street": "1 Main St"}, want: map[string]interface{}{"street": "1 Main St"}},
+		{name: "null", value: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := k.Encrypt(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encrypted, Prefix+"k1:") || !IsEncrypted(encrypted) {
+				t.Errorf("encrypted value %q lacks the %sk1: prefix", encrypted, Prefix)
+			}
+			got, err := k.Decrypt(encrypted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decrypt = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptUsesFreshNonces(t *testing.T) {
+	k := testKeyring(t, map[string]string{"k1": key1}, "k1")
+	a, _ := k.Encrypt("secret")
+	b, _ := k.Encrypt("secret")
+	if a == b {
+		t.Error("encrypting the same value twice gave the same ciphertext")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := testKeyring(t, map[string]string{"k1": key1}, "k1")
+	encryptedOld, err := old.Encrypt("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testKeyring(t, map[string]string{"k1": key1, "k2": key2}, "k2")
+	encryptedNew, err := rotated.Encrypt("after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encryptedNew, Prefix+"k2:") {
+		t.Errorf("new value %q not encrypted with the active key k2", encryptedNew)
+	}
+
+	for encrypted, want := range map[string]string{encryptedOld: "before", encryptedNew: "after"} {
+		got, err := rotated.Decrypt(encrypted)
+		if err != nil || got != want {
+			t.Errorf("Decrypt(%q) = %v, %v; want %q", encrypted, got, err, want)
+		}
+	}
+
+	// Once k1 is retired, values it sealed can no longer be read
+	retired := testKeyring(t, map[string]string{"k2": key2}, "k2")
+	if _, err := retired.Decrypt(encryptedOld); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with retired key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	k := testKeyring(t, map[string]string{"k1": key1, "k2": key1}, "k1")
+	encrypted, err := k.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := strings.TrimPrefix(encrypted, Prefix+"k1:")
+	sealed, _ := base64.RawURLEncoding.DecodeString(encoded)
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr error
+	}{
+		{name: "unknown key id", value: Prefix + "k9:" + encoded, wantErr: ErrUnknownKey},
+		// k2 holds the same key bytes, so only the AAD differs
+		{name: "key id swapped", value: Prefix + "k2:" + encoded},
+		{name: "tampered ciphertext", value: Prefix + "k1:" + base64.RawURLEncoding.EncodeToString(tampered)},
+		{name: "truncated", value: Prefix + "k1:" + base64.RawURLEncoding.EncodeToString(sealed[:4]), wantErr: ErrMalformed},
+		{name: "not base64", value: Prefix + "k1:***", wantErr: ErrMalformed},
+		{name: "no key id", value: Prefix + encoded, wantErr: ErrMalformed},
+		{name: "no prefix", value: "secret", wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := k.Decrypt(tt.value)
+			if err == nil {
+				t.Fatalf("Decrypt = %v, want an error", got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decrypt = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewKeyringRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   map[string]string
+		active string
+	}{
+		{name: "active key missing", keys: map[string]string{"k1": key1}, active: "k2"},
+		{name: "colon in id", keys: map[string]string{"k:1": key1}, active: "k:1"},
+		{name: "not base64", keys: map[string]string{"k1": "not base64!"}, active: "k1"},
+		{name: "wrong key length", keys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}, active: "k1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.keys, tt.active); err == nil {
+				t.Error("NewKeyring accepted an invalid keyring")
+			}
+		})
+	}
+}
+
+func TestEncryptVariables(t *testing.T) {
+	k := testKeyring(t, map[string]string{"k1": key1}, "k1")
+	already, err := k.Encrypt("already")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variables := map[string]interface{}{"name": "Ada", "ssn": "123-45-6789", "token": already}
+
+	encrypted, err := k.EncryptVariables(variables, []string{"ssn", "token", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted["name"] != "Ada" {
+		t.Errorf("unlisted variable changed to %v", encrypted["name"])
+	}
+	if !IsEncrypted(encrypted["ssn"]) {
+		t.Errorf("ssn = %v, want encrypted", encrypted["ssn"])
+	}
+	if encrypted["token"] != already {
+		t.Errorf("already encrypted token re-encrypted to %v", encrypted["token"])
+	}
+	if _, ok := encrypted["missing"]; ok {
+		t.Error("missing variable was added")
+	}
+	if variables["ssn"] != "123-45-6789" {
+		t.Error("EncryptVariables modified its input")
+	}
+
+	decrypted, err := k.DecryptVariables(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"name": "Ada", "ssn": "123-45-6789", "token": "already"}
+	if !reflect.DeepEqual(decrypted, want) {
+		t.Errorf("DecryptVariables = %v, want %v", decrypted, want)
+	}
+}
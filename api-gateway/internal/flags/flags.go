@@ -0,0 +1,136 @@
+package flags
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxFlags bounds how many flags one header may carry
+const MaxFlags = 20
+
+var (
+	ErrInvalidSignature = errors.New("invalid feature flag signature")
+	ErrExpired          = errors.New("feature flags have expired")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// Signer issues and checks X-Feature-Flags values of the form
+//
+//	flag-a,flag-b;expires=<unix>;sig=<hex hmac>
+//
+// The HMAC covers the sorted flags and the expiry, so flags can't be added,
+// removed or extended without the secret.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewSigner(secret string, ttl time.Duration) *Signer {
+	return &Signer{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// Sign returns a header value enabling names until now plus the TTL, and
+// that expiry.
+func (s *Signer) Sign(names []string, now time.Time) (string, time.Time, error) {
+	names, err := normalize(names)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := now.Add(s.ttl).Truncate(time.Second)
+	payload := canonical(names, expires.Unix())
+	return payload + ";sig=" + s.signature(payload), expires, nil
+}
+
+// Verify parses a header value and returns its flags if the signature is
+// valid and it hasn't expired.
+func (s *Signer) Verify(value string, now time.Time) ([]string, error) {
+	payload, sig, ok := strings.Cut(strings.TrimSpace(value), ";sig=")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	list, rawExpires, ok := strings.Cut(payload, ";expires=")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	names, err := normalize(strings.Split(list, ","))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	// Only the canonical form is accepted, so one flag set has one value
+	if canonical(names, expires) != payload {
+		return nil, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signature(payload))) {
+		return nil, ErrInvalidSignature
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return nil, ErrExpired
+	}
+	return names, nil
+}
+
+func (s *Signer) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalize validates names and returns them sorted and deduplicated
+func normalize(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one flag is required")
+	}
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid flag name %q", name)
+		}
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > MaxFlags {
+		return nil, fmt.Errorf("at most %d flags are allowed", MaxFlags)
+	}
+	return out, nil
+}
+
+func canonical(names []string, expires int64) string {
+	return strings.Join(names, ",") + ";expires=" + strconv.FormatInt(expires, 10)
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying the request's enabled flags
+func NewContext(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, contextKey{}, names)
+}
+
+// Enabled reports whether a verified flag was sent with the request
+func Enabled(ctx context.Context, name string) bool {
+	names, _ := ctx.Value(contextKey{}).([]string)
+	return slices.Contains(names, name)
+}
+
+// FromContext returns the request's enabled flags, sorted
+func FromContext(ctx context.Context) []string {
+	names, _ := ctx.Value(contextKey{}).([]string)
+	return names
+}
@@ -0,0 +1,86 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := NewSigner("secret", time.Hour)
+	value, expires, err := signer.Sign([]string{"new-editor", "beta", "beta"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(time.Hour); !expires.Equal(want) {
+		t.Errorf("Sign expiry = %s, want %s", expires, want)
+	}
+
+	tests := []struct {
+		name      string
+		value     string
+		at        time.Time
+		signer    *Signer
+		wantFlags []string
+		wantErr   error
+	}{
+		{name: "valid", value: value, at: now, signer: signer, wantFlags: []string{"beta", "new-editor"}},
+		{name: "expired", value: value, at: expires.Add(time.Second), signer: signer, wantErr: ErrExpired},
+		{name: "other secret", value: value, at: now, signer: NewSigner("other", time.Hour), wantErr: ErrInvalidSignature},
+		{name: "flag added", value: "admin," + value, at: now, signer: signer, wantErr: ErrInvalidSignature},
+		{name: "flag removed", value: strings.TrimPrefix(value, "beta,"), at: now, signer: signer, wantErr: ErrInvalidSignature},
+		{name: "not canonical", value: strings.Replace(value, "beta,new-editor", "new-editor,beta", 1), at: now, signer: signer, wantErr: ErrInvalidSignature},
+		{name: "no signature", value: "beta;expires=9999999999", at: now, signer: signer, wantErr: ErrInvalidSignature},
+		{name: "garbage", value: "not a flag header", at: now, signer: signer, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.signer.Verify(tt.value, tt.at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.wantFlags) {
+				t.Errorf("Verify flags = %v, want %v", got, tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestSignRejectsInvalidNames(t *testing.T) {
+	tooMany := make([]string, MaxFlags+1)
+	for i := range tooMany {
+		tooMany[i] = "flag-" + string(rune('a'+i))
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+	}{
+		{name: "empty", names: nil},
+		{name: "uppercase", names: []string{"Beta"}},
+		{name: "separator", names: []string{"beta;sig=x"}},
+		{name: "too many", names: tooMany},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := NewSigner("secret", time.Hour).Sign(tt.names, time.Now()); err == nil {
+				t.Errorf("Sign(%v) succeeded", tt.names)
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := NewContext(context.Background(), []string{"beta"})
+	if !Enabled(ctx, "beta") || Enabled(ctx, "other") {
+		t.Errorf("Enabled reports %v", FromContext(ctx))
+	}
+	if Enabled(context.Background(), "beta") {
+		t.Error("flag enabled without one in the context")
+	}
+}
@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/logging"
+	"github.com/tobey0x/api-gateway/internal/models"
+	"github.com/tobey0x/api-gateway/internal/queue"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	defaultReplayLimit = 100
+	maxReplayLimit     = 500
+	// replayInterval paces re-enqueues to 50 per second
+	replayInterval = 20 * time.Millisecond
+	// syncReplayLimit is the most matches replayed within the request;
+	// larger replays run as a background job
+	syncReplayLimit = 50
+	// replayJobTTL is how long a background replay's progress is kept
+	replayJobTTL = 24 * time.Hour
+	// replayProgressEvery is how many entries a background replay handles
+	// between progress saves
+	replayProgressEvery = 25
+
+	defaultPeekLimit = 10
+	maxPeekLimit     = 50
+	// peekTimeout bounds how long a peek holds messages unacked
+	peekTimeout = 5 * time.Second
+)
+
+// AdminHandler serves operational endpoints restricted to admins
+type AdminHandler struct {
+	redis         *cache.RedisClient
+	denylist      *cache.Denylist
+	notifications *NotificationHndler
+	rabbitMQ      *queue.RabbitMQClient
+
+	// Background replays run under jobsCtx and are tracked by jobs
+	jobsCtx         context.Context
+	jobs            *sync.WaitGroup
+	syncReplayLimit int
+}
+
+func NewAdminHandler(redis *cache.RedisClient, denylist *cache.Denylist, notifications *NotificationHndler, rabbitMQ *queue.RabbitMQClient) *AdminHandler {
+	return &AdminHandler{
+		redis:           redis,
+		denylist:        denylist,
+		notifications:   notifications,
+		rabbitMQ:        rabbitMQ,
+		jobsCtx:         context.Background(),
+		jobs:            &sync.WaitGroup{},
+		syncReplayLimit: syncReplayLimit,
+	}
+}
+
+// SetBackground runs background replays under ctx and tracks them in wg,
+// so they stop with the server's other workers
+func (h *AdminHandler) SetBackground(ctx context.Context, wg *sync.WaitGroup) {
+	h.jobsCtx = ctx
+	h.jobs = wg
+}
+
+type replayRequest struct {
+	From       time.Time `json:"from" binding:"required"`
+	To         time.Time `json:"to" binding:"required"`
+	UserID     string    `json:"user_id"`
+	TemplateID string    `json:"template_id"`
+	Type       string    `json:"type"`
+	Limit      int       `json:"limit"`
+	// IncludeFailed replays notifications that ended failed as well
+	IncludeFailed bool `json:"include_failed"`
+}
+
+// Background replay job states
+const (
+	replayRunning     = "running"
+	replayCompleted   = "completed"
+	replayInterrupted = "interrupted"
+)
+
+type replayResult struct {
+	JobID           string   `json:"job_id,omitempty"`
+	State           string   `json:"state"`
+	Matched         int      `json:"matched"`
+	Replayed        int      `json:"replayed"`
+	Skipped         int      `json:"skipped"`
+	Duplicates      int      `json:"duplicates"`
+	Failed          int      `json:"failed"`
+	NotificationIDs []string `json:"notification_ids"`
+}
+
+// ReplayNotifications handles POST /api/v1/admin/notifications/replay
+//
+// Matching audit log entries are re-enqueued with the idempotency key
+// "replay:<original id>", so replaying a window twice never sends twice.
+// Notifications that already reached a terminal status are skipped, except
+// failed ones when include_failed is set. Small replays finish within the
+// request; larger ones answer 202 with a job to poll.
+func (h *AdminHandler) ReplayNotifications(c *gin.Context) {
+	var req replayRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !req.To.After(req.From) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("to must be after from"))
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultReplayLimit
+	}
+	req.Limit = min(req.Limit, maxReplayLimit)
+
+	ctx := c.Request.Context()
+	var entries []models.AuditEntry
+	cursor := ""
+	for len(entries) < req.Limit {
+		page, next, err := h.redis.ReadAudit(ctx, req.From, req.To, cursor, int64(maxReplayLimit))
+		if err != nil {
+			c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to read audit log", err))
+			return
+		}
+		for _, raw := range page {
+			var entry models.AuditEntry
+			if models.DecodeJSON([]byte(raw), &entry) != nil || !replayMatches(req, entry) {
+				continue
+			}
+			if entries = append(entries, entry); len(entries) == req.Limit {
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	result := &replayResult{State: replayRunning, Matched: len(entries), NotificationIDs: []string{}}
+	if len(entries) <= h.syncReplayLimit {
+		if err := h.replay(ctx, req, entries, result, nil); err != nil {
+			c.JSON(http.StatusServiceUnavailable, models.ErrorResponse("Replay interrupted", err))
+			return
+		}
+		result.State = replayCompleted
+		c.JSON(http.StatusOK, models.SuccessResponse("Replay completed", result))
+		return
+	}
+
+	result.JobID = uuid.New().String()
+	if err := h.saveReplayJob(ctx, result); err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to start replay", err))
+		return
+	}
+	c.Header("Location", "/api/v1/admin/notifications/replay/"+result.JobID)
+	c.JSON(http.StatusAccepted, models.SuccessResponse("Replay started", result))
+
+	// Started only after the response is written, since the job mutates result
+	h.jobs.Go(func() {
+		progress := func() {
+			if err := h.saveReplayJob(context.WithoutCancel(h.jobsCtx), result); err != nil {
+				log.Printf("Failed to save progress of replay job %s: %v", result.JobID, err)
+			}
+		}
+		if err := h.replay(h.jobsCtx, req, entries, result, progress); err != nil {
+			result.State = replayInterrupted
+		} else {
+			result.State = replayCompleted
+		}
+		progress()
+	})
+}
+
+// replay re-enqueues entries into result, paced by replayInterval, calling
+// progress every replayProgressEvery entries. It stops early only when ctx
+// is done.
+func (h *AdminHandler) replay(ctx context.Context, req replayRequest, entries []models.AuditEntry, result *replayResult, progress func()) error {
+	ticker := time.NewTicker(replayInterval)
+	defer ticker.Stop()
+
+	for i, entry := range entries {
+		if progress != nil && i > 0 && i%replayProgressEvery == 0 {
+			progress()
+		}
+
+		replayable, err := h.replayable(ctx, req, entry.NotificationID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Replay of notification %s failed: %v", entry.NotificationID, err)
+			result.Failed++
+			continue
+		}
+		if !replayable {
+			result.Skipped++
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		enqueued, err := h.notifications.Enqueue(ctx, entry.Request, EnqueueOptions{
+			IdempotencyKey: "replay:" + entry.NotificationID,
+			Admin:          true,
+			ReplayOf:       entry.NotificationID,
+			Metadata: models.MessageMetadata{
+				UserAgent: "admin-replay",
+				Timestamp: time.Now(),
+			},
+		})
+		switch {
+		case err != nil:
+			log.Printf("Replay of notification %s failed: %v", entry.NotificationID, err)
+			result.Failed++
+		case enqueued.Duplicate:
+			result.Duplicates++
+		default:
+			result.Replayed++
+			result.NotificationIDs = append(result.NotificationIDs, enqueued.Response.NotificationID)
+		}
+	}
+	return nil
+}
+
+// replayable reports whether the original notification should be sent
+// again. Ones whose status record is gone are skipped, since whether they
+// were delivered is unknown.
+func (h *AdminHandler) replayable(ctx context.Context, req replayRequest, notificationID string) (bool, error) {
+	raw, err := h.redis.GetNotificationStatus(ctx, notificationID)
+	if errors.Is(err, cache.ErrNotificationNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var record models.NotificationStatus
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return false, err
+	}
+	status := models.NormalizeStatus(record.Status)
+	if status == models.StatusFailed {
+		return req.IncludeFailed, nil
+	}
+	return !models.IsTerminalStatus(status), nil
+}
+
+func (h *AdminHandler) saveReplayJob(ctx context.Context, result *replayResult) error {
+	job, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return h.redis.SetReplayJob(ctx, result.JobID, string(job), replayJobTTL)
+}
+
+// GetReplayJob handles GET /api/v1/admin/notifications/replay/:id
+func (h *AdminHandler) GetReplayJob(c *gin.Context) {
+	job, err := h.redis.GetReplayJob(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, cache.ErrReplayJobNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("Replay job not found", err))
+		return
+	}
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to load replay job", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("Replay job retrieved", json.RawMessage(job)))
+}
+
+// replayMatches applies the request filters. Entries that are themselves
+// replays are skipped so overlapping windows don't replay twice.
+func replayMatches(req replayRequest, entry models.AuditEntry) bool {
+	if entry.ReplayOf != "" {
+		return false
+	}
+	if req.UserID != "" && entry.Request.UserID != req.UserID {
+		return false
+	}
+	if req.TemplateID != "" && entry.Request.TemplateID != req.TemplateID {
+		return false
+	}
+	if req.Type != "" && string(entry.Request.Type) != req.Type {
+		return false
+	}
+	return true
+}
+
+// SearchNotifications handles GET /api/v1/admin/notifications/search
+//
+// Filters (user_id, template_id, status) are ANDed; from/to are RFC3339 and
+// default to the last 7 days.
+func (h *AdminHandler) SearchNotifications(c *gin.Context) {
+	page, limit, err := parsePaging(c, defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid pagination", err))
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid from timestamp", err))
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid to timestamp", err))
+			return
+		}
+	}
+
+	var indexes []string
+	for _, field := range []string{"user_id", "template_id", "status"} {
+		if v := c.Query(field); v != "" {
+			indexes = append(indexes, cache.NotificationIndexKey(field, v))
+		}
+	}
+
+	ids, total, err := h.redis.SearchNotifications(c.Request.Context(), indexes, from, to, int64((page-1)*limit), int64(limit))
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to search notifications", err))
+		return
+	}
+
+	raw, err := h.redis.GetNotificationStatuses(c.Request.Context(), ids)
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to load notifications", err))
+		return
+	}
+
+	results := make([]models.NotificationStatus, 0, len(raw))
+	for _, r := range raw {
+		var status models.NotificationStatus
+		// Index entries can outlive their status record
+		if r == "" || json.Unmarshal([]byte(r), &status) != nil {
+			continue
+		}
+		results = append(results, status)
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponseWithMeta(
+		"Notifications retrieved",
+		results,
+		models.CalculatePagination(int(total), page, limit),
+	))
+}
+
+type logLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// GetLogLevel handles GET /api/v1/admin/loglevel
+func (h *AdminHandler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, models.SuccessResponse("Log level retrieved", gin.H{"level": logging.Level()}))
+}
+
+// SetLogLevel handles PUT /api/v1/admin/loglevel
+//
+// The change applies to this instance only and lasts until restart, when
+// LOG_LEVEL applies again.
+func (h *AdminHandler) SetLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	previous := logging.Level()
+	if err := logging.SetLevel(req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid log level", err))
+		return
+	}
+	// Warn so the change is visible at any level but error
+	slog.Warn("Log level changed", "from", previous, "to", logging.Level())
+	c.JSON(http.StatusOK, models.SuccessResponse("Log level updated", gin.H{"level": logging.Level()}))
+}
+
+// ListDenylist handles GET /api/v1/admin/denylist
+func (h *AdminHandler) ListDenylist(c *gin.Context) {
+	users, err := h.denylist.List(c.Request.Context())
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to load denylist", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("Denylist retrieved", users))
+}
+
+// BlockUser handles PUT /api/v1/admin/denylist/:user_id
+func (h *AdminHandler) BlockUser(c *gin.Context) {
+	userID := c.Param("user_id")
+	if err := h.denylist.Add(c.Request.Context(), userID); err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to block user", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("User blocked", gin.H{"user_id": userID}))
+}
+
+// UnblockUser handles DELETE /api/v1/admin/denylist/:user_id
+func (h *AdminHandler) UnblockUser(c *gin.Context) {
+	userID := c.Param("user_id")
+	if err := h.denylist.Remove(c.Request.Context(), userID); err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to unblock user", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("User unblocked", gin.H{"user_id": userID}))
+}
+
+// peekedMessage is one queued message as shown by PeekQueue. Bodies that
+// aren't notification messages are returned raw with the decode error.
+type peekedMessage struct {
+	Redelivered bool                        `json:"redelivered"`
+	Message     *models.NotificationMessage `json:"message,omitempty"`
+	Raw         string                      `json:"raw,omitempty"`
+	Error       string                      `json:"error,omitempty"`
+}
+
+// PeekQueue handles GET /api/v1/admin/queues/:name/peek
+//
+// Messages are read and immediately requeued, so they stay in the queue
+// but workers will see them as redelivered.
+func (h *AdminHandler) PeekQueue(c *gin.Context) {
+	limit := defaultPeekLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("limit must be a positive integer"))
+			return
+		}
+		limit = min(n, maxPeekLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), peekTimeout)
+	defer cancel()
+
+	peeked, err := h.rabbitMQ.Peek(ctx, c.Param("name"), limit)
+	if errors.Is(err, queue.ErrQueueNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("Queue not found", err))
+		return
+	}
+	if err != nil {
+		c.JSON(publishErrorStatus(err), models.ErrorResponse("Failed to peek queue", err))
+		return
+	}
+
+	messages := make([]peekedMessage, 0, len(peeked))
+	for _, p := range peeked {
+		entry := peekedMessage{Redelivered: p.Redelivered}
+		if msg, _, err := queue.DecodeFailedMessage(p.Body); err != nil {
+			entry.Raw = string(p.Body)
+			entry.Error = err.Error()
+		} else {
+			entry.Message = &msg
+		}
+		messages = append(messages, entry)
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Queue messages retrieved", messages))
+}
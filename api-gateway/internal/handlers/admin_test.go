@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// testReplay enqueues one notification per status, leaving each status
+// record as given, and returns an admin handler and router over them
+func testReplay(t *testing.T, statuses []string) (*AdminHandler, *gin.Engine) {
+	t.Helper()
+	h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	ctx := context.Background()
+
+	for _, status := range statuses {
+		enqueued, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := enqueued.Response.NotificationID
+		if status == "" {
+			if err := redisClient.DeleteNotificationStatus(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		record := models.NotificationStatus{NotificationID: id, UserID: "user-1", Status: status}
+		if err := redisClient.SetNotificationStatus(ctx, id, record, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := NewAdminHandler(redisClient, nil, h, nil)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/replay", admin.ReplayNotifications)
+	router.GET("/replay/:id", admin.GetReplayJob)
+	return admin, router
+}
+
+func postReplay(t *testing.T, router *gin.Engine, includeFailed bool) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{
+		"from":           time.Now().Add(-time.Hour),
+		"to":             time.Now().Add(time.Hour),
+		"include_failed": includeFailed,
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/replay", bytes.NewReader(body)))
+	return w
+}
+
+func decodeReplayResult(t *testing.T, body []byte) replayResult {
+	t.Helper()
+	var resp struct {
+		Data replayResult `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return resp.Data
+}
+
+func TestReplaySkipsTerminalNotifications(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        string
+		includeFailed bool
+		wantReplayed  int
+	}{
+		{name: "pending", status: models.StatusPending, wantReplayed: 1},
+		{name: "retry", status: models.StatusRetry, wantReplayed: 1},
+		{name: "sent", status: models.StatusSent},
+		{name: "delivered", status: models.StatusDelivered},
+		{name: "expired", status: models.StatusExpired},
+		{name: "failed", status: models.StatusFailed},
+		{name: "failed with include_failed", status: models.StatusFailed, includeFailed: true, wantReplayed: 1},
+		{name: "status record gone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, router := testReplay(t, []string{tt.status})
+
+			w := postReplay(t, router, tt.includeFailed)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			result := decodeReplayResult(t, w.Body.Bytes())
+			if result.Matched != 1 || result.Replayed != tt.wantReplayed || result.Skipped != 1-tt.wantReplayed {
+				t.Errorf("matched %d, replayed %d, skipped %d; want 1, %d, %d",
+					result.Matched, result.Replayed, result.Skipped, tt.wantReplayed, 1-tt.wantReplayed)
+			}
+			if result.State != replayCompleted {
+				t.Errorf("state = %q, want %q", result.State, replayCompleted)
+			}
+		})
+	}
+}
+
+func TestReplayRunsLargeReplaysInBackground(t *testing.T) {
+	admin, router := testReplay(t, []string{models.StatusPending, models.StatusSent, models.StatusPending})
+	admin.syncReplayLimit = 2
+
+	w := postReplay(t, router, false)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	started := decodeReplayResult(t, w.Body.Bytes())
+	if started.JobID == "" || started.State != replayRunning {
+		t.Fatalf("started job %+v, want a running job", started)
+	}
+	if got, want := w.Header().Get("Location"), "/api/v1/admin/notifications/replay/"+started.JobID; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+
+	admin.jobs.Wait()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/replay/"+started.JobID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("poll status = %d, want 200: %s", w.Code, w.Body)
+	}
+	done := decodeReplayResult(t, w.Body.Bytes())
+	if done.State != replayCompleted || done.Matched != 3 || done.Replayed != 2 || done.Skipped != 1 {
+		t.Errorf("finished job %+v, want completed with 3 matched, 2 replayed, 1 skipped", done)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/replay/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", w.Code)
+	}
+}
+
+func TestSearchNotifications(t *testing.T) {
+	h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	ctx := context.Background()
+	ids := map[string]string{}
+	for _, n := range []struct{ user, template string }{
+		{"user-1", "welcome"},
+		{"user-1", "reset"},
+		{"user-2", "welcome"},
+	} {
+		req := testRequest()
+		req.UserID = n.user
+		req.TemplateID = n.template
+		enqueued, err := h.Enqueue(ctx, req, EnqueueOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[n.user+"/"+n.template] = enqueued.Response.NotificationID
+	}
+
+	admin := NewAdminHandler(redisClient, nil, h, nil)
+	router := gin.New()
+	router.GET("/search", admin.SearchNotifications)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{name: "by user", query: "user_id=user-1", wantStatus: http.StatusOK, wantIDs: []string{ids["user-1/welcome"], ids["user-1/reset"]}},
+		{name: "by user and template", query: "user_id=user-1&template_id=welcome", wantStatus: http.StatusOK, wantIDs: []string{ids["user-1/welcome"]}},
+		{name: "by status", query: "status=" + models.StatusQueuedOutbox, wantStatus: http.StatusOK, wantIDs: []string{ids["user-1/welcome"], ids["user-1/reset"], ids["user-2/welcome"]}},
+		{name: "outside the window", query: "to=" + time.Now().Add(-time.Hour).Format(time.RFC3339), wantStatus: http.StatusOK},
+		{name: "malformed from", query: "from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "malformed to", query: "to=2024-01-01", wantStatus: http.StatusBadRequest},
+		{name: "malformed paging", query: "page=two", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Data []models.NotificationStatus `json:"data"`
+				Meta models.PaginationMeta       `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]bool{}
+			for _, status := range resp.Data {
+				got[status.NotificationID] = true
+			}
+			if len(got) != len(tt.wantIDs) || resp.Meta.Total != len(tt.wantIDs) {
+				t.Errorf("got %d results (total %d), want %d", len(got), resp.Meta.Total, len(tt.wantIDs))
+			}
+			for _, id := range tt.wantIDs {
+				if !got[id] {
+					t.Errorf("missing notification %s", id)
+				}
+			}
+		})
+	}
+}
+
+func TestDenylistBlocksSender(t *testing.T) {
+	h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	admin := NewAdminHandler(redisClient, h.denylist, h, nil)
+
+	router := gin.New()
+	router.PUT("/denylist/:user_id", admin.BlockUser)
+	router.DELETE("/denylist/:user_id", admin.UnblockUser)
+	router.GET("/denylist", admin.ListDenylist)
+	router.POST("/notifications", func(c *gin.Context) {
+		// Stands in for the auth middleware
+		c.Set("user_id", c.GetHeader("X-Sender"))
+	}, h.CreateNotifiation)
+
+	send := func(sender string) int {
+		body, _ := json.Marshal(testRequest())
+		req := httptest.NewRequest(http.MethodPost, "/notifications", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sender", sender)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	call := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d: %s", method, target, w.Code, w.Body)
+		}
+		return w
+	}
+
+	call(http.MethodPut, "/denylist/spammer")
+	if got := send("spammer"); got != http.StatusForbidden {
+		t.Errorf("blocked sender: status = %d, want 403", got)
+	}
+	if got := send("user-2"); got != http.StatusAccepted {
+		t.Errorf("other sender: status = %d, want 202", got)
+	}
+
+	var listed struct {
+		Data []string `json:"data"`
+	}
+	if err := json.Unmarshal(call(http.MethodGet, "/denylist").Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Data) != 1 || listed.Data[0] != "spammer" {
+		t.Errorf("denylist = %v, want [spammer]", listed.Data)
+	}
+
+	call(http.MethodDelete, "/denylist/spammer")
+	if got := send("spammer"); got != http.StatusAccepted {
+		t.Errorf("unblocked sender: status = %d, want 202", got)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/middleware"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+const (
+	// batchResultTTL matches the lifetime of single-create idempotency keys
+	batchResultTTL = 24 * time.Hour
+	// batchClaimTTL bounds how long a crashed batch blocks its key. Items
+	// carry their own idempotency keys, so a retry after it lapses doesn't
+	// re-publish what was already accepted.
+	batchClaimTTL = 5 * time.Minute
+)
+
+// CreateNotificationBatch handles POST /api/v1/notifications/batch
+//
+// Each item runs through the same create path as a single create and gets
+// its own result. With X-Idempotency-Key, the batch response is stored and
+// replays of the key return it unchanged without publishing anything.
+func (h *NotificationHndler) CreateNotificationBatch(c *gin.Context) {
+	var req models.BatchNotificationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if senderID, ok := middleware.GetUserID(c); ok {
+		blocked, err := h.denylist.Blocked(c.Request.Context(), senderID)
+		if err != nil {
+			log.Printf("Denylist lookup failed for user %s: %v", senderID, err)
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, models.ErrorResponseSimple("User is blocked from sending notifications"))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	batchKey := c.GetHeader("X-Idempotency-Key")
+	if batchKey == "" && h.idempotencyKeyRequired(c) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("X-Idempotency-Key header is required"))
+		return
+	}
+	if batchKey != "" {
+		if err := validateIdempotencyKey(batchKey); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid X-Idempotency-Key header", err))
+			return
+		}
+
+		stored, err := h.redis.ClaimBatch(ctx, batchKey, batchClaimTTL)
+		switch {
+		case errors.Is(err, cache.ErrBatchInProgress):
+			c.JSON(http.StatusConflict, models.ErrorResponseSimple("A batch with this idempotency key is still being processed"))
+			return
+		case err != nil:
+			c.JSON(http.StatusServiceUnavailable, models.ErrorResponse("Failed to check batch idempotency key", err))
+			return
+		case stored != "":
+			var prior models.BatchResponse
+			if err := json.Unmarshal([]byte(stored), &prior); err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to read stored batch result", err))
+				return
+			}
+			c.JSON(http.StatusOK, models.SuccessResponse("Batch already processed (idempotent)", prior))
+			return
+		}
+	}
+
+	opts := EnqueueOptions{
+		AccessToken: bearerToken(c),
+		Admin:       middleware.IsAdmin(c),
+		Tenant:      h.tenant(c),
+		Metadata: models.MessageMetadata{
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Timestamp: time.Now(),
+		},
+	}
+	response := models.BatchResponse{Results: make([]models.BatchItemResult, len(req.Notifications))}
+	for i, item := range req.Notifications {
+		if batchKey != "" {
+			opts.IdempotencyKey = scopedIdempotencyKey(idempotencyScopeBatch, fmt.Sprintf("%s/%d", batchKey, i))
+		}
+		response.Results[i] = h.enqueueBatchItem(ctx, i, item, opts)
+		if response.Results[i].Error == "" {
+			response.Accepted++
+		} else {
+			response.Failed++
+		}
+	}
+
+	if batchKey != "" {
+		encoded, _ := json.Marshal(response)
+		if err := h.redis.StoreBatchResult(ctx, batchKey, string(encoded), batchResultTTL); err != nil {
+			// Items are individually idempotent, so a replay is still safe
+			log.Printf("Failed to store result of batch %s: %v", batchKey, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Batch processed", response))
+}
+
+func (h *NotificationHndler) enqueueBatchItem(ctx context.Context, index int, req models.NotificationRequest, opts EnqueueOptions) models.BatchItemResult {
+	result, err := h.Enqueue(ctx, req, opts)
+	if err != nil {
+		item := models.BatchItemResult{Index: index, Code: http.StatusInternalServerError, Error: err.Error()}
+		var ee *enqueueError
+		if errors.As(err, &ee) {
+			item.Code = ee.status
+		}
+		return item
+	}
+
+	code := http.StatusAccepted
+	if result.Duplicate || result.Response.Status == models.StatusSuppressed {
+		code = http.StatusOK
+	}
+	return models.BatchItemResult{
+		Index:          index,
+		Code:           code,
+		NotificationID: result.Response.NotificationID,
+		Status:         result.Response.Status,
+	}
+}
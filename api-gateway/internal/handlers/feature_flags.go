@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/flags"
+	"github.com/tobey0x/api-gateway/internal/middleware"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// FeatureFlagHandler issues signed X-Feature-Flags values for QA
+type FeatureFlagHandler struct {
+	signer *flags.Signer
+}
+
+func NewFeatureFlagHandler(signer *flags.Signer) *FeatureFlagHandler {
+	return &FeatureFlagHandler{signer: signer}
+}
+
+type signFlagsRequest struct {
+	Flags []string `json:"flags" binding:"required,min=1"`
+}
+
+type signFlagsResponse struct {
+	Header    string    `json:"header"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SignFeatureFlags handles POST /api/v1/admin/feature-flags/sign
+func (h *FeatureFlagHandler) SignFeatureFlags(c *gin.Context) {
+	var req signFlagsRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	value, expires, err := h.signer.Sign(req.Flags, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid feature flags", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Feature flags signed", signFlagsResponse{
+		Header:    middleware.FeatureFlagsHeader,
+		Value:     value,
+		ExpiresAt: expires,
+	}))
+}
@@ -2,41 +2,156 @@ package handlers
 
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"net/netip"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
 	"github.com/tobey0x/api-gateway/internal/models"
 	"github.com/tobey0x/api-gateway/internal/queue"
 )
 
 
 type HealthHandler struct {
-	rabbitMQ *queue.RabbitMQClient
-	redis    *cache.RedisClient
+	rabbitMQ		*queue.RabbitMQClient
+	redis			*cache.RedisClient
+	token			string
+	trustedNets		[]netip.Prefix
+	// ready is set once startup warmup has finished
+	ready			atomic.Bool
+	// providers feed /health/providers; reports older than
+	// providerStaleAfter count as degraded
+	providers			[]ProviderHealthSource
+	providerStaleAfter	time.Duration
 }
 
 
-func NewHealthHandler(rabbitMQ *queue.RabbitMQClient, redis *cache.RedisClient) *HealthHandler {
-	return &HealthHandler{
+// rabbitMQProbeTimeout bounds the /health round trip on the publishing
+// channel
+const rabbitMQProbeTimeout = 2 * time.Second
+
+
+// providerCheckTimeout bounds a whole /health/providers request, including
+// every URL probe
+const providerCheckTimeout = 5 * time.Second
+
+
+// ProviderHealthSource reports delivery provider health, keyed by provider
+// name. Errors mean the source itself couldn't be read.
+type ProviderHealthSource interface {
+	Name() string
+	ProviderHealth(ctx context.Context) (map[string]models.ProviderHealth, error)
+}
+
+
+func NewHealthHandler(rabbitMQ *queue.RabbitMQClient, redis *cache.RedisClient, cfg config.HealthConfig) *HealthHandler {
+	h := &HealthHandler{
 		rabbitMQ: rabbitMQ,
 		redis:	  redis,
+		token:	  cfg.Token,
+		providerStaleAfter: cfg.ProviderStaleAfter(),
+	}
+	h.AddProviderSource(workerProviderReports{redis: redis})
+	if len(cfg.ProviderURLs) > 0 {
+		h.AddProviderSource(client.NewProviderProber(cfg.ProviderURLs, providerCheckTimeout))
+	}
+	for _, cidr := range cfg.TrustedCIDRs {
+		// Validated in config.Validate
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			h.trustedNets = append(h.trustedNets, prefix)
+		}
+	}
+	return h
+}
+
+
+// AddProviderSource adds a source to /health/providers. It must be called
+// before the server starts.
+func (h *HealthHandler) AddProviderSource(source ProviderHealthSource) {
+	h.providers = append(h.providers, source)
+}
+
+
+// MarkReady lets /health report dependency status once warmup is done
+func (h *HealthHandler) MarkReady() {
+	h.ready.Store(true)
+}
+
+
+// Live handles GET /health/live, a shallow liveness probe that never
+// exposes dependency details.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+
+// authorized reports whether the caller may see dependency details, either
+// via the X-Health-Token header or by coming from a trusted network.
+func (h *HealthHandler) authorized(c *gin.Context) bool {
+	if h.token == "" && len(h.trustedNets) == 0 {
+		return true
+	}
+	if h.token != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Health-Token")), []byte(h.token)) == 1 {
+		return true
 	}
+	if addr, err := netip.ParseAddr(c.ClientIP()); err == nil {
+		for _, prefix := range h.trustedNets {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 
 func (h *HealthHandler) CheckHealth(c *gin.Context) {
+	if !h.authorized(c) {
+		h.Live(c)
+		return
+	}
+
+	if !h.ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, models.SuccessResponse("Health check completed", models.HealthResponse{
+			Status: "starting",
+			Timestamp: time.Now(),
+			Services: map[string]string{},
+		}))
+		return
+	}
+
 	services := make(map[string]string)
 	overallStatus := "healthy"
 
 
-	if err := h.rabbitMQ.HealthCheck(); err != nil {
+	probeCtx, cancel := context.WithTimeout(c.Request.Context(), rabbitMQProbeTimeout)
+	err := h.rabbitMQ.Probe(probeCtx)
+	cancel()
+	if err != nil {
 		services["rabbitmq"] = "unhealthy: " + err.Error()
 		overallStatus = "degraded"
 	} else {
 		services["rabbitmq"] = "healthy"
 	}
+	services["rabbitmq:broker"] = h.rabbitMQ.ActiveBroker()
+	for routingKey, reason := range h.rabbitMQ.UnavailableChannels() {
+		services["rabbitmq:"+routingKey] = "unavailable: " + reason
+		overallStatus = "degraded"
+	}
+	if reason := h.rabbitMQ.FlowPaused(); reason != "" {
+		services["rabbitmq:flow"] = "paused: " + reason
+		overallStatus = "degraded"
+	}
 
 
 	if err := h.redis.HealthCheck(c.Request.Context()); err != nil {
@@ -59,4 +174,96 @@ func (h *HealthHandler) CheckHealth(c *gin.Context) {
 	}
 
 	c.JSON(statusCode, models.SuccessResponse("Health check completed", healthResponse))
-}
\ No newline at end of file
+}
+
+
+// ProviderHealth handles GET /health/providers
+//
+// It aggregates delivery provider health separately from /health, so
+// dashboards can tell a provider outage from a queue outage. When sources
+// disagree about a provider, the worse status wins. It always answers 200;
+// a provider outage is not a reason to take the gateway out of rotation.
+func (h *HealthHandler) ProviderHealth(c *gin.Context) {
+	if !h.authorized(c) {
+		h.Live(c)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), providerCheckTimeout)
+	defer cancel()
+
+	response := models.ProviderHealthResponse{
+		Status: models.ProviderHealthy,
+		Timestamp: time.Now(),
+		Providers: make(map[string]models.ProviderHealth),
+	}
+	for _, source := range h.providers {
+		reports, err := source.ProviderHealth(ctx)
+		if err != nil {
+			log.Printf("Provider health source %s failed: %v", source.Name(), err)
+			response.Errors = append(response.Errors, fmt.Sprintf("%s: %v", source.Name(), err))
+			response.Status = models.ProviderDegraded
+			continue
+		}
+		for name, report := range reports {
+			if report.Status == models.ProviderHealthy && time.Since(report.CheckedAt) > h.providerStaleAfter {
+				report.Status = models.ProviderDegraded
+				report.Detail = "no report since " + report.CheckedAt.Format(time.RFC3339)
+			}
+			if existing, ok := response.Providers[name]; ok && existing.Status != models.ProviderHealthy {
+				continue
+			}
+			response.Providers[name] = report
+		}
+	}
+	for _, report := range response.Providers {
+		if report.Status != models.ProviderHealthy {
+			response.Status = models.ProviderDegraded
+		}
+	}
+	sort.Strings(response.Errors)
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Provider health check completed", response))
+}
+
+
+// workerProviderReports reads the provider health delivery workers write to
+// Redis. Any status other than healthy counts as degraded.
+type workerProviderReports struct {
+	redis	*cache.RedisClient
+}
+
+
+func (w workerProviderReports) Name() string {
+	return "worker"
+}
+
+
+func (w workerProviderReports) ProviderHealth(ctx context.Context) (map[string]models.ProviderHealth, error) {
+	raw, err := w.redis.ProviderHealthReports(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]models.ProviderHealth, len(raw))
+	for name, value := range raw {
+		var report models.ProviderHealth
+		if err := json.Unmarshal([]byte(value), &report); err != nil {
+			reports[name] = models.ProviderHealth{
+				Status: models.ProviderDegraded,
+				Detail: "invalid report: " + err.Error(),
+				Source: w.Name(),
+			}
+			continue
+		}
+		if report.Status != models.ProviderHealthy {
+			if report.Detail == "" {
+				report.Detail = "reported " + report.Status
+			}
+			report.Status = models.ProviderDegraded
+		}
+		report.Source = w.Name()
+		reports[name] = report
+	}
+	return reports, nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/config"
+)
+
+func TestCheckHealthAuthorization(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.HealthConfig
+		token       string
+		remoteAddr  string
+		wantDetails bool
+	}{
+		{name: "unprotected", wantDetails: true},
+		{name: "valid token", cfg: config.HealthConfig{Token: "s3cret"}, token: "s3cret", wantDetails: true},
+		{name: "wrong token", cfg: config.HealthConfig{Token: "s3cret"}, token: "guess"},
+		{name: "missing token", cfg: config.HealthConfig{Token: "s3cret"}},
+		{name: "trusted network", cfg: config.HealthConfig{TrustedCIDRs: []string{"10.0.0.0/8"}}, remoteAddr: "10.1.2.3:5000", wantDetails: true},
+		{name: "mapped address in trusted network", cfg: config.HealthConfig{TrustedCIDRs: []string{"10.0.0.0/8"}}, remoteAddr: "[::ffff:10.1.2.3]:5000", wantDetails: true},
+		{name: "untrusted network", cfg: config.HealthConfig{TrustedCIDRs: []string{"10.0.0.0/8"}}, remoteAddr: "192.0.2.1:5000"},
+		{
+			name:        "token from an untrusted network",
+			cfg:         config.HealthConfig{Token: "s3cret", TrustedCIDRs: []string{"10.0.0.0/8"}},
+			token:       "s3cret",
+			remoteAddr:  "192.0.2.1:5000",
+			wantDetails: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Not marked ready, so details are the "starting" response and
+			// no dependency is probed
+			h := NewHealthHandler(nil, nil, tt.cfg)
+			router := gin.New()
+			router.GET("/health", h.CheckHealth)
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.token != "" {
+				req.Header.Set("X-Health-Token", tt.token)
+			}
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantDetails {
+				if w.Code != http.StatusServiceUnavailable || resp["data"] == nil {
+					t.Errorf("status %d, body %s; want the detailed starting response", w.Code, w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusOK || resp["status"] != "ok" || len(resp) != 1 {
+				t.Errorf("status %d, body %s; want the shallow liveness response", w.Code, w.Body)
+			}
+		})
+	}
+}
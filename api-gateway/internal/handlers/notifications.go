@@ -2,28 +2,145 @@ package handlers
 
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
+	"github.com/tobey0x/api-gateway/internal/analytics"
 	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/fieldcrypt"
+	"github.com/tobey0x/api-gateway/internal/links"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+	"github.com/tobey0x/api-gateway/internal/middleware"
 	"github.com/tobey0x/api-gateway/internal/models"
 	"github.com/tobey0x/api-gateway/internal/queue"
+	"github.com/tobey0x/api-gateway/internal/templates"
+	"github.com/tobey0x/api-gateway/internal/webhooks"
 )
 
 
+const maxIdempotencyKeyLength = 128
+
+// maxSuppressionWindow bounds suppress_if_delivered_within and is how long
+// deliveries are remembered per dedup group
+const maxSuppressionWindow = 30 * 24 * time.Hour
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+
 type NotificationHndler struct {
 	rabbitMQ	*queue.RabbitMQClient
 	redis		*cache.RedisClient
+	outbox		*queue.Outbox
+	userService	*client.UserServiceClient
+	denylist	*cache.Denylist
+	analytics	analytics.Exporter
+	cfg			atomic.Pointer[config.NotificationConfig]
+	// userIDPattern is cfg's compiled UserIDPattern, nil when unset
+	userIDPattern	atomic.Pointer[regexp.Regexp]
+	// tenantClaim names the JWT claim holding the caller's tenant
+	tenantClaim	atomic.Pointer[string]
+	// webhooks is nil unless lifecycle webhooks are enabled
+	webhooks	*webhooks.Emitter
+	// keyring encrypts sensitive variables; nil unless keys are configured
+	keyring		*fieldcrypt.Keyring
+	attachments	*client.AttachmentChecker
 }
 
 
-func NewNotificationHandler(rabbitMQ *queue.RabbitMQClient, redis *cache.RedisClient) *NotificationHndler {
-	return &NotificationHndler{
+func NewNotificationHandler(rabbitMQ *queue.RabbitMQClient, redis *cache.RedisClient, outbox *queue.Outbox, userService *client.UserServiceClient, denylist *cache.Denylist, exporter analytics.Exporter, cfg config.NotificationConfig) *NotificationHndler {
+	h := &NotificationHndler{
 		rabbitMQ: rabbitMQ,
 		redis: redis,
+		outbox: outbox,
+		userService: userService,
+		denylist: denylist,
+		analytics: exporter,
+		attachments: client.NewAttachmentChecker(),
+	}
+	h.UpdateConfig(cfg)
+	return h
+}
+
+
+// UpdateConfig atomically swaps the settings used by subsequent requests.
+func (h *NotificationHndler) UpdateConfig(cfg config.NotificationConfig) {
+	pattern, err := cfg.UserIDRegexp()
+	if err != nil {
+		// Validate rejects this, so only an unvalidated config gets here
+		log.Printf("Ignoring invalid user ID pattern %q: %v", cfg.UserIDPattern, err)
+	}
+	h.userIDPattern.Store(pattern)
+	h.cfg.Store(&cfg)
+}
+
+
+// SetWebhookEmitter enables lifecycle webhooks. It must be called before
+// the server starts.
+func (h *NotificationHndler) SetWebhookEmitter(emitter *webhooks.Emitter) {
+	h.webhooks = emitter
+}
+
+
+// SetVariableEncryption enables sensitive variable encryption. It must be
+// called before the server starts.
+func (h *NotificationHndler) SetVariableEncryption(keyring *fieldcrypt.Keyring) {
+	h.keyring = keyring
+}
+
+
+// SetTenantClaim sets the JWT claim that identifies the caller's tenant
+// for per-tenant settings.
+func (h *NotificationHndler) SetTenantClaim(claim string) {
+	h.tenantClaim.Store(&claim)
+}
+
+
+// tenant returns the caller's tenant, or "" when none is configured or
+// the token has no tenant claim.
+func (h *NotificationHndler) tenant(c *gin.Context) string {
+	claim := h.tenantClaim.Load()
+	if claim == nil {
+		return ""
+	}
+	return middleware.GetTenant(c, *claim)
+}
+
+
+// idempotencyKeyRequired reports whether the caller must send
+// X-Idempotency-Key, either everywhere or for the caller's tenant.
+func (h *NotificationHndler) idempotencyKeyRequired(c *gin.Context) bool {
+	cfg := h.cfg.Load()
+	if cfg.RequireIdempotencyKey {
+		return true
 	}
+	if len(cfg.RequireIdempotencyKeyTenants) == 0 {
+		return false
+	}
+	tenant := h.tenant(c)
+	return tenant != "" && slices.Contains(cfg.RequireIdempotencyKeyTenants, tenant)
 }
 
 
@@ -32,34 +149,421 @@ func (h *NotificationHndler) CreateNotifiation(c *gin.Context) {
 	var req models.NotificationRequest
 
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request body", err))
+	if !bindJSON(c, &req) {
 		return
 	}
 
 
-	notificationID := uuid.New().String()
+	// Abuse blocking applies to the authenticated sender
+	if senderID, ok := middleware.GetUserID(c); ok {
+		blocked, err := h.denylist.Blocked(c.Request.Context(), senderID)
+		if err != nil {
+			log.Printf("Denylist lookup failed for user %s: %v", senderID, err)
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, models.ErrorResponseSimple("User is blocked from sending notifications"))
+			return
+		}
+	}
 
 
 	idempotentKey := c.GetHeader("X-Idempotency-Key")
+	if idempotentKey == "" && h.idempotencyKeyRequired(c) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("X-Idempotency-Key header is required"))
+		return
+	}
+	if idempotentKey != "" {
+		if err := validateIdempotencyKey(idempotentKey); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid X-Idempotency-Key header", err))
+			return
+		}
+	}
+
+
+	opts := EnqueueOptions{
+		AccessToken: bearerToken(c),
+		Admin: middleware.IsAdmin(c),
+		Tenant: h.tenant(c),
+		Metadata: models.MessageMetadata{
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Timestamp: time.Now(),
+		},
+	}
 	if idempotentKey != "" {
-		
-		existingID, err := h.redis.GetIdempotencyKey(c.Request.Context(), idempotentKey)
+		opts.IdempotencyKey = scopedIdempotencyKey(idempotencyScopeCreate, idempotentKey)
+	}
+	result, err := h.Enqueue(c.Request.Context(), req, opts)
+	if err != nil {
+		writeEnqueueError(c, err)
+		return
+	}
+
+	switch {
+	case result.Duplicate:
+		c.JSON(http.StatusOK, models.SuccessResponse("Notification already processed (idempotent)", result.Response))
+	case result.Response.Status == models.StatusSuppressed:
+		c.JSON(http.StatusOK, models.SuccessResponse("Notification suppressed", result.Response))
+	case result.Untracked:
+		// Published, but there is no status record to point at
+		c.JSON(http.StatusAccepted, models.SuccessResponse("Notification request accepted", result.Response))
+	default:
+		c.Header("Location", "/api/v1/notifications/"+result.Response.NotificationID)
+		c.JSON(http.StatusAccepted, models.SuccessResponse("Notification request accepted", result.Response))
+	}
+}
+
+
+// CreateTestNotification handles POST /api/v1/notifications/test
+//
+// Developers send a notification to themselves to check a template. The
+// recipient is always the caller, whatever user_id says. Test sends skip
+// per-user quotas but still go through rate limiting.
+func (h *NotificationHndler) CreateTestNotification(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Access denied"))
+		return
+	}
+
+	// user_id is forced to the caller, so it is filled in before validation
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request body", err))
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("Request body is required"))
+		return
+	}
+	var req models.NotificationRequest
+	if err := models.DecodeJSON(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request body", err))
+		return
+	}
+	req.UserID = userID
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request body", err))
+		return
+	}
+
+	if blocked, err := h.denylist.Blocked(c.Request.Context(), userID); err != nil {
+		log.Printf("Denylist lookup failed for user %s: %v", userID, err)
+	} else if blocked {
+		c.JSON(http.StatusForbidden, models.ErrorResponseSimple("User is blocked from sending notifications"))
+		return
+	}
+
+	result, err := h.Enqueue(c.Request.Context(), req, EnqueueOptions{
+		AccessToken: bearerToken(c),
+		Admin: middleware.IsAdmin(c),
+		Test: true,
+		Tenant: h.tenant(c),
+		Metadata: models.MessageMetadata{
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Timestamp: time.Now(),
+			Test: true,
+		},
+	})
+	if err != nil {
+		writeEnqueueError(c, err)
+		return
+	}
+
+	if result.Response.Status == models.StatusSuppressed {
+		c.JSON(http.StatusOK, models.SuccessResponse("Notification suppressed", result.Response))
+		return
+	}
+	c.Header("Location", "/api/v1/notifications/"+result.Response.NotificationID)
+	c.JSON(http.StatusAccepted, models.SuccessResponse("Test notification accepted", result.Response))
+}
+
+
+// EnqueueOptions carries the caller-specific inputs of the create path
+type EnqueueOptions struct {
+	IdempotencyKey	string
+	// AccessToken is forwarded to the User Service when available
+	AccessToken		string
+	// Admin unlocks admin-only request fields
+	Admin			bool
+	Metadata		models.MessageMetadata
+	// ReplayOf marks a re-enqueue of an earlier notification
+	ReplayOf		string
+	// Test skips per-user quotas and deduplication for a test send; the
+	// caller also sets Metadata.Test
+	Test			bool
+	// Tenant is the caller's tenant, checked against the tenant's allowed
+	// channels; empty for internal callers
+	Tenant			string
+}
+
+
+type EnqueueResult struct {
+	Response	models.NotificationResponse
+	// Duplicate is set when the idempotency key was already used
+	Duplicate	bool
+	// Untracked is set when the message was published but its status
+	// record could not be written
+	Untracked	bool
+}
+
+
+// enqueueError is a rejection from the create path with its HTTP status
+type enqueueError struct {
+	status	int
+	message	string
+	err		error
+	// violations are returned as a validation error response when set
+	violations	[]middleware.SchemaViolation
+	// retryAfter is sent as Retry-After when set
+	retryAfter	time.Duration
+}
+
+
+func (e *enqueueError) Error() string {
+	if e.err != nil {
+		return e.message + ": " + e.err.Error()
+	}
+	return e.message
+}
+
+
+func (e *enqueueError) Unwrap() error {
+	return e.err
+}
+
+
+// IsRetryable reports whether an Enqueue error is transient
+func IsRetryable(err error) bool {
+	var ee *enqueueError
+	if errors.As(err, &ee) {
+		return ee.status >= http.StatusInternalServerError
+	}
+	return true
+}
+
+
+func writeEnqueueError(c *gin.Context, err error) {
+	var ee *enqueueError
+	if !errors.As(err, &ee) {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to queue notification", err))
+		return
+	}
+	if ee.retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(ee.retryAfter.Seconds()))))
+	}
+	if len(ee.violations) > 0 {
+		c.JSON(ee.status, models.ValidationErrorResponse(ee.violations))
+		return
+	}
+	if ee.err != nil {
+		c.JSON(ee.status, models.ErrorResponse(ee.message, ee.err))
+		return
+	}
+	c.JSON(ee.status, models.ErrorResponseSimple(ee.message))
+}
+
+
+// Enqueue runs a validated request through the create path shared by the
+// HTTP API and the events consumer: template and preference checks,
+// idempotency, publishing (or the outbox) and status tracking.
+func (h *NotificationHndler) Enqueue(ctx context.Context, req models.NotificationRequest, opts EnqueueOptions) (*EnqueueResult, error) {
+	if len(req.ForceChannels) > 0 {
+		return h.enqueueForced(ctx, req, opts)
+	}
+	return h.enqueue(ctx, req, opts)
+}
+
+
+// enqueueForced fans an admin's force_channels request out to one
+// notification per channel, each skipping the user's channel preferences.
+// The result describes the first channel and lists every channel's
+// notification in Channels.
+func (h *NotificationHndler) enqueueForced(ctx context.Context, req models.NotificationRequest, opts EnqueueOptions) (*EnqueueResult, error) {
+	if !opts.Admin {
+		return nil, &enqueueError{status: http.StatusForbidden, message: "force_channels requires admin privileges"}
+	}
+	// type is still required; rather than silently picking one of two
+	// disagreeing fields, it must be among the forced channels
+	if !slices.Contains(req.ForceChannels, req.Type) {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf("type %s must be one of force_channels %v", req.Type, req.ForceChannels)}
+	}
+	channels := make([]models.NotificationType, 0, len(req.ForceChannels))
+	for _, channel := range req.ForceChannels {
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	if limit := h.cfg.Load().MaxFanoutChannels; len(channels) > limit {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf("force_channels lists %d channels, at most %d are allowed", len(channels), limit)}
+	}
+	if req.NotificationID != "" && len(channels) > 1 {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "notification_id cannot be combined with more than one force_channels entry"}
+	}
+
+	var combined *EnqueueResult
+	for _, channel := range channels {
+		// A single forced channel, so replays from the audit log force it too
+		channelReq := req
+		channelReq.Type = channel
+		channelReq.ForceChannels = []models.NotificationType{channel}
+		channelOpts := opts
+		if opts.IdempotencyKey != "" {
+			// "/" can't appear in client keys, so these never collide
+			channelOpts.IdempotencyKey = opts.IdempotencyKey + "/" + string(channel)
+		}
+
+		// Earlier channels are already queued; retrying with the same
+		// idempotency key won't send them twice
+		result, err := h.enqueue(ctx, channelReq, channelOpts)
+		if err != nil {
+			return nil, err
+		}
+		if combined == nil {
+			combined = result
+		}
+		combined.Response.Channels = append(combined.Response.Channels, result.Response)
+	}
+	return combined, nil
+}
+
+
+func (h *NotificationHndler) enqueue(ctx context.Context, req models.NotificationRequest, opts EnqueueOptions) (_ *EnqueueResult, err error) {
+	cfg := h.cfg.Load()
+
+	if pattern := h.userIDPattern.Load(); pattern != nil && !pattern.MatchString(req.UserID) {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "Malformed user_id: " + req.UserID}
+	}
+	if !cfg.ChannelAllowed(opts.Tenant, string(req.Type)) {
+		return nil, &enqueueError{status: http.StatusForbidden, message: fmt.Sprintf("Channel %s is not enabled for tenant %s", req.Type, opts.Tenant)}
+	}
+	if !cfg.TemplateAllowed(req.TemplateID) {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "Template is not allowed: " + req.TemplateID}
+	}
+	if spec, ok := cfg.Templates[req.TemplateID]; ok {
+		if violations := templateVariableViolations(spec, req.Variables); len(violations) > 0 {
+			return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "Variables do not match template " + req.TemplateID, violations: violations}
+		}
+	}
+
+
+	routingKey := cfg.RoutingKey(string(req.Type))
+	if req.RoutingKeyOverride != "" {
+		if !opts.Admin {
+			return nil, &enqueueError{status: http.StatusForbidden, message: "routing_key_override requires admin privileges"}
+		}
+		if !cfg.RoutingKeyOverrideAllowed(req.RoutingKeyOverride) {
+			return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "Routing key override is not allowed: " + req.RoutingKeyOverride}
+		}
+		routingKey = req.RoutingKeyOverride
+	}
+
+
+	if req.SuppressIfDeliveredWithin > 0 && req.DedupGroup == "" {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "suppress_if_delivered_within requires dedup_group"}
+	}
+	if time.Duration(req.SuppressIfDeliveredWithin)*time.Second > maxSuppressionWindow {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf("suppress_if_delivered_within must be at most %d seconds", int(maxSuppressionWindow.Seconds()))}
+	}
+
+
+	variables, err := signLinks(cfg, req)
+	if err != nil {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "Invalid signed_links", err: err}
+	}
+
+	sensitive := sensitiveVariables(cfg, req)
+	if len(sensitive) > 0 && h.keyring == nil {
+		return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "sensitive_variables requires variable encryption to be configured"}
+	}
+
+	var rendered *models.RenderedContent
+	if spec, ok := cfg.Templates[req.TemplateID]; ok && spec.Renders() {
+		// The rendered body would carry the plaintext into the queue
+		if len(sensitive) > 0 {
+			return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "Sensitive variables can't be used with gateway-rendered template " + req.TemplateID}
+		}
+		rendered, err = templates.Render(spec.Subject, spec.Body, spec.HTML, variables)
+		if err != nil {
+			return nil, &enqueueError{status: http.StatusUnprocessableEntity, message: "Failed to render template " + req.TemplateID, err: err}
+		}
+	}
+
+	// The audit log keeps them encrypted too; replays skip values that
+	// already are
+	auditVariables := req.Variables
+	if len(sensitive) > 0 {
+		if variables, err = h.keyring.EncryptVariables(variables, sensitive); err != nil {
+			return nil, &enqueueError{status: http.StatusInternalServerError, message: "Failed to encrypt sensitive variables", err: err}
+		}
+		if auditVariables, err = h.keyring.EncryptVariables(req.Variables, sensitive); err != nil {
+			return nil, &enqueueError{status: http.StatusInternalServerError, message: "Failed to encrypt sensitive variables", err: err}
+		}
+	}
+
+
+	idempotencyKey, idempotencyTTL := opts.IdempotencyKey, 24*time.Hour
+	if idempotencyKey == "" && cfg.ImplicitDedupSeconds > 0 && !opts.Test {
+		idempotencyKey, idempotencyTTL = implicitIdempotencyKey(req), cfg.ImplicitDedupWindow()
+	}
+
+	if idempotencyKey != "" {
+		existingID, err := h.redis.GetIdempotencyKey(ctx, idempotencyKey)
 
 		if err == nil && existingID != "" {
-			c.JSON(http.StatusOK, models.SuccessResponse(
-				"Notification already processed (idempotent)",
-				models.NotificationResponse{
+			slog.Debug("Duplicate notification request", "idempotency_key", idempotencyKey, "notification_id", existingID)
+			return &EnqueueResult{
+				Duplicate: true,
+				Response: models.NotificationResponse{
 					NotificationID: existingID,
 					Type: req.Type,
-					Status: "pending",
+					Status: models.StatusPending,
 					Message: "Notification request accepted (duplicate request)",
 				},
-			))
-			return
+			}, nil
 		}
 
-		_ = h.redis.SetIdempotencyKey(c.Request.Context(), idempotentKey, notificationID, 24*time.Hour)
+	}
+
+	// After the idempotency lookup so replays don't probe the URLs again
+	if err := h.checkAttachments(ctx, cfg, req.Variables); err != nil {
+		return nil, err
+	}
+
+
+	notificationID, err := h.assignNotificationID(ctx, req.NotificationID, cfg.MaxStatusTTL())
+	if err != nil {
+		return nil, err
+	}
+	if req.NotificationID != "" {
+		// Free a client-chosen ID if this request fails, so it can be retried
+		defer func() {
+			if err != nil {
+				h.releaseNotificationID(ctx, notificationID)
+			}
+		}()
+	}
+
+
+	if delivered, ok := h.deliveredWithin(ctx, req); ok {
+		reason := fmt.Sprintf("A %q notification was delivered at %s", req.DedupGroup, delivered.Format(time.RFC3339))
+		return h.suppress(ctx, cfg, req, opts, notificationID, idempotencyKey, idempotencyTTL, reason), nil
+	}
+
+
+	if limit := cfg.ChannelRateLimits[string(req.Type)]; limit > 0 {
+		// One second's worth may arrive at once
+		result, err := h.redis.AllowGCRA(ctx, "channel:"+string(req.Type), time.Second/time.Duration(limit), int64(limit-1))
+		if err != nil {
+			log.Printf("Channel rate limit check failed for %s, allowing: %v", req.Type, err)
+		} else if !result.Allowed {
+			metrics.ChannelThrottled.WithLabelValues(string(req.Type), cfg.ChannelRateLimitAction).Inc()
+			if cfg.ChannelRateLimitAction != config.ChannelRateLimitDeprioritize {
+				return nil, &enqueueError{status: http.StatusServiceUnavailable, message: fmt.Sprintf("The %s channel is at capacity, please retry later", req.Type), retryAfter: result.RetryAfter}
+			}
+			req.Priority = models.PriorityLow
+		}
 	}
 
 
@@ -69,69 +573,1045 @@ func (h *NotificationHndler) CreateNotifiation(c *gin.Context) {
 		UserID: req.UserID,
 		Priority: req.Priority,
 		TemplateID: req.TemplateID,
-		Variables: req.Variables,
-		Metadata: models.MessageMetadata{
-			IPAddress: c.ClientIP(),
-			UserAgent: c.Request.UserAgent(),
-			Timestamp: time.Now(),
-		},
+		Variables: variables,
+		Metadata: opts.Metadata,
 		RetryCount: 0,
-		MaxRetries: 3,
+		MaxRetries: models.DefaultMaxRetries,
+		ScheduledAt: req.ScheduledAt,
+		Rendered: rendered,
 	}
 
 
-	routingKey := string(req.Type)
+	// Reserve before recording the idempotency key so a rejected request
+	// can be retried with the same key
+	reserved := false
+	if cfg.MaxInFlightPerUser > 0 && !opts.Test {
+		inFlight, err := h.redis.IncrementInFlight(ctx, req.UserID, cfg.MaxStatusTTL())
+		if err != nil {
+			log.Printf("In-flight check failed for user %s, allowing: %v", req.UserID, err)
+		} else {
+			reserved = true
+			if inFlight > int64(cfg.MaxInFlightPerUser) {
+				h.releaseInFlight(ctx, req.UserID)
+				return nil, &enqueueError{status: http.StatusTooManyRequests, message: fmt.Sprintf("Too many notifications in flight for user %s (max %d)", req.UserID, cfg.MaxInFlightPerUser)}
+			}
+		}
+	}
 
 
-	if err := h.rabbitMQ.Publish(c.Request.Context(), routingKey, message); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to queue notification", err))
-		return
+	// Bytes are counted as serialized, before any compression on publish
+	var queuedBytes int64
+	if cfg.MaxQueuedBytesPerUser > 0 && !opts.Test {
+		encoded, _ := json.Marshal(message)
+		size := int64(len(encoded))
+		ok, err := h.redis.ReserveQueuedBytes(ctx, req.UserID, size, int64(cfg.MaxQueuedBytesPerUser), cfg.MaxStatusTTL())
+		if err != nil {
+			log.Printf("Queued bytes check failed for user %s, allowing: %v", req.UserID, err)
+		} else if !ok {
+			if reserved {
+				h.releaseInFlight(ctx, req.UserID)
+			}
+			return nil, &enqueueError{status: http.StatusTooManyRequests, message: fmt.Sprintf("Too many queued bytes for user %s (max %d); retry once earlier notifications complete", req.UserID, cfg.MaxQueuedBytesPerUser)}
+		} else {
+			queuedBytes = size
+		}
+	}
+
+
+	idempotencyReserved := false
+	if idempotencyKey != "" && cfg.MaxIdempotencyReservationsPerUser > 0 && !opts.Test {
+		ok, err := h.redis.ReserveIdempotency(ctx, req.UserID, notificationID, idempotencyTTL, int64(cfg.MaxIdempotencyReservationsPerUser))
+		if err != nil {
+			log.Printf("Idempotency reservation check failed for user %s, allowing: %v", req.UserID, err)
+		} else if !ok {
+			if reserved {
+				h.releaseInFlight(ctx, req.UserID)
+			}
+			h.releaseQueuedBytes(ctx, req.UserID, queuedBytes)
+			return nil, &enqueueError{status: http.StatusTooManyRequests, message: fmt.Sprintf("Too many pending idempotency keys for user %s (max %d); retry once earlier notifications complete", req.UserID, cfg.MaxIdempotencyReservationsPerUser)}
+		} else {
+			idempotencyReserved = true
+		}
+	}
+
+	// Forced channels were chosen by an admin and skip preferences,
+	// including quiet hours
+	var deferredUntil *time.Time
+	if len(req.ForceChannels) == 0 {
+		preference := h.userPreference(ctx, cfg, req.UserID, opts.AccessToken)
+		if !channelEnabled(preference, req.Type) {
+			if reserved {
+				h.releaseInFlight(ctx, req.UserID)
+			}
+			if idempotencyReserved {
+				h.releaseIdempotency(ctx, req.UserID, notificationID)
+			}
+			h.releaseQueuedBytes(ctx, req.UserID, queuedBytes)
+			reason := fmt.Sprintf("User has disabled %s notifications", req.Type)
+			return h.suppress(ctx, cfg, req, opts, notificationID, idempotencyKey, idempotencyTTL, reason), nil
+		}
+
+		due := time.Now()
+		if req.ScheduledAt != nil && req.ScheduledAt.After(due) {
+			due = *req.ScheduledAt
+		}
+		if until, ok := quietHoursDeferral(cfg, preference, req, due); ok && !opts.Test {
+			until = until.UTC()
+			deferredUntil = &until
+			req.ScheduledAt = deferredUntil
+			message.ScheduledAt = deferredUntil
+		}
+	}
+
+
+	responseMessage := "Notification queued for processing"
+	if deferredUntil != nil {
+		responseMessage = "Notification deferred until " + deferredUntil.Format(time.RFC3339) + " (quiet hours)"
 	}
 
+	// Numbered just before publishing so the sequence follows queue order;
+	// scheduled notifications don't wait in line, so they aren't numbered
+	var queueSequence int64
+	if cfg.EstimateQueuePosition && !opts.Test && (req.ScheduledAt == nil || !req.ScheduledAt.After(time.Now())) {
+		if seq, err := h.redis.NextQueueSequence(ctx, routingKey); err != nil {
+			log.Printf("Failed to number notification %s for position estimates: %v", notificationID, err)
+		} else {
+			queueSequence = seq
+		}
+	}
 
 	status := models.NotificationStatus{
 		NotificationID: notificationID,
 		Type:           req.Type,
 		UserID:         req.UserID,
-		Status:         "pending",
+		TemplateID:     req.TemplateID,
+		Priority:       req.Priority,
+		DedupGroup:     req.DedupGroup,
+		Status:         models.StatusPending,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
+		ScheduledAt:    req.ScheduledAt,
+		Test:           opts.Test,
+		QueuedBytes:    queuedBytes,
+	}
+	if queueSequence > 0 {
+		status.RoutingKey = routingKey
+		status.QueueSequence = queueSequence
+	}
+	statusTTL := cfg.StatusTTL(string(req.Type), string(req.Priority))
+
+	statusRecorded := false
+	var statusErr error
+	if err := h.rabbitMQ.Publish(ctx, routingKey, message); err != nil {
+		// Buffer through broker outages rather than losing the notification
+		stored := false
+		if queue.ShouldStore(err) {
+			// Its place in line is only known once the outbox publishes it
+			status.Status = models.StatusQueuedOutbox
+			status.RoutingKey = ""
+			status.QueueSequence = 0
+			// Recorded before the entry is stored: the outbox may publish it
+			// and mark it pending at once, which a later write would undo
+			statusErr = h.recordStatus(ctx, status, statusTTL, cfg.MaxStatusTTL())
+			statusRecorded = true
+			if err := h.outbox.Enqueue(ctx, notificationID, routingKey, message); err != nil {
+				log.Printf("Failed to store notification %s in outbox: %v", notificationID, err)
+				if statusErr == nil {
+					if err := h.redis.DeleteNotificationStatus(ctx, notificationID); err != nil {
+						log.Printf("Failed to remove status for unqueued notification %s: %v", notificationID, err)
+					} else if err := h.redis.UnindexNotification(ctx, notificationID, status.UserID, status.TemplateID, status.Status); err != nil {
+						log.Printf("Failed to unindex unqueued notification %s: %v", notificationID, err)
+					}
+				}
+			} else {
+				stored = true
+			}
+		}
+		if !stored {
+			if reserved {
+				h.releaseInFlight(ctx, req.UserID)
+			}
+			if idempotencyReserved {
+				h.releaseIdempotency(ctx, req.UserID, notificationID)
+			}
+			h.releaseQueuedBytes(ctx, req.UserID, queuedBytes)
+			publishErr := &enqueueError{status: publishErrorStatus(err), message: "Failed to queue notification", err: err}
+			if errors.Is(err, queue.ErrFlowPaused) {
+				publishErr.retryAfter = flowRetryAfter
+			}
+			return nil, publishErr
+		}
+		responseMessage = "Notification stored and will be queued once the broker recovers"
+	}
+	statusValue := status.Status
+	slog.Debug("Notification enqueued", "notification_id", notificationID, "user_id", req.UserID, "routing_key", routingKey, "status", statusValue)
+
+	// Recorded only once the notification is queued, so a request that
+	// failed, e.g. with a retryable 503, can be retried with the same key
+	h.setIdempotencyKey(ctx, cfg, idempotencyKey, notificationID, idempotencyTTL)
+
+
+	if !statusRecorded {
+		statusErr = h.recordStatus(ctx, status, statusTTL, cfg.MaxStatusTTL())
+	}
+	untracked := false
+	if statusErr != nil {
+		// Already published, so this must not fail the request
+		log.Printf("Failed to write status for notification %s (published but untracked): %v", notificationID, statusErr)
+		metrics.StatusWriteFailures.WithLabelValues("create").Inc()
+		untracked = true
+		// No record means no terminal update will ever release the slot
+		if reserved {
+			h.releaseInFlight(ctx, req.UserID)
+		}
+		if idempotencyReserved {
+			h.releaseIdempotency(ctx, req.UserID, notificationID)
+		}
+		h.releaseQueuedBytes(ctx, req.UserID, queuedBytes)
+		if cfg.ReportUntracked {
+			statusValue = models.StatusUntracked
+			responseMessage += "; status tracking is unavailable for this notification"
+		}
+	}
+
+	// The original request (before link signing) so replays re-sign
+	auditRequest := req
+	auditRequest.Variables = auditVariables
+	audit, _ := json.Marshal(models.AuditEntry{NotificationID: notificationID, Request: auditRequest, CreatedAt: status.CreatedAt, ReplayOf: opts.ReplayOf})
+	if err := h.redis.AppendAudit(ctx, string(audit)); err != nil {
+		log.Printf("Failed to append notification %s to audit log: %v", notificationID, err)
+	}
+
+	h.analytics.Emit(ctx, analytics.Event{
+		EventType: analytics.EventNotificationCreated,
+		NotificationID: notificationID,
+		UserID: req.UserID,
+		Type: string(req.Type),
+		TemplateID: req.TemplateID,
+		Priority: string(req.Priority),
+		Status: statusValue,
+		Timestamp: status.CreatedAt,
+	})
+	if !untracked {
+		h.emitWebhook(ctx, status, "")
 	}
-	_ = h.redis.SetNotificationStatus(c.Request.Context(), notificationID, status, 7*24*time.Hour)
 
-	c.JSON(http.StatusAccepted, models.SuccessResponse(
-		"Notification request accepted",
-		models.NotificationResponse{
+	return &EnqueueResult{
+		Untracked: untracked,
+		Response: models.NotificationResponse{
 			NotificationID: notificationID,
 			Type:           req.Type,
-			Status:         "pending",
-			Message:        "Notification queued for processing",
+			Status:         statusValue,
+			Message:        responseMessage,
 		},
-	))
+	}, nil
 }
 
 
-// GetNotificationStatus handles GET /api/v1/notifications/:id
-func (h *NotificationHndler) GetNotificationStatus(c *gin.Context) {
-	notificationID := c.Param("id")
+// suppress records a notification that won't be sent, so its ID can be
+// looked up like any other and retries with the same idempotency key get
+// it back. If the record can't be written the response carries no ID
+// rather than one that would 404.
+func (h *NotificationHndler) suppress(ctx context.Context, cfg *config.NotificationConfig, req models.NotificationRequest, opts EnqueueOptions, notificationID, idempotencyKey string, idempotencyTTL time.Duration, reason string) *EnqueueResult {
+	now := time.Now()
+	status := models.NotificationStatus{
+		NotificationID: notificationID,
+		Type:           req.Type,
+		UserID:         req.UserID,
+		TemplateID:     req.TemplateID,
+		Priority:       req.Priority,
+		DedupGroup:     req.DedupGroup,
+		Status:         models.StatusSuppressed,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Test:           opts.Test,
+	}
+	response := models.NotificationResponse{
+		NotificationID: notificationID,
+		Type:           req.Type,
+		Status:         models.StatusSuppressed,
+		Message:        reason,
+	}
 
-	status, err := h.redis.GetNotificationStatus(c.Request.Context(), notificationID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse("Notification not found", err))
+	if err := h.recordStatus(ctx, status, cfg.StatusTTL(string(req.Type), string(req.Priority)), cfg.MaxStatusTTL()); err != nil {
+		log.Printf("Failed to record suppressed notification %s: %v", notificationID, err)
+		metrics.StatusWriteFailures.WithLabelValues("create").Inc()
+		response.NotificationID = ""
+		return &EnqueueResult{Response: response}
+	}
+	h.setIdempotencyKey(ctx, cfg, idempotencyKey, notificationID, idempotencyTTL)
+	return &EnqueueResult{Response: response}
+}
+
+
+// setIdempotencyKey points key, if any, at notificationID
+func (h *NotificationHndler) setIdempotencyKey(ctx context.Context, cfg *config.NotificationConfig, key, notificationID string, ttl time.Duration) {
+	if key == "" {
 		return
 	}
+	_ = h.redis.SetIdempotencyKey(ctx, key, notificationID, ttl)
+	if cfg.IdempotencyMaxKeys > 0 {
+		h.trimIdempotencyKeys(ctx, int64(cfg.IdempotencyMaxKeys))
+	}
+}
 
-	c.JSON(http.StatusOK, models.SuccessResponse("Notification status retrieved", status))
+
+// recordStatus writes a new notification's status record and indexes it.
+// Only the write's error is returned; a failed index is logged.
+func (h *NotificationHndler) recordStatus(ctx context.Context, status models.NotificationStatus, ttl, retention time.Duration) error {
+	if err := h.redis.SetNotificationStatus(ctx, status.NotificationID, status, ttl); err != nil {
+		return err
+	}
+	if err := h.redis.IndexNotification(ctx, status.NotificationID, status.UserID, status.TemplateID, status.Status, status.CreatedAt, ttl, retention); err != nil {
+		log.Printf("Failed to index notification %s: %v", status.NotificationID, err)
+	}
+	return nil
 }
 
 
-// ListNotifications handles GET /api/v1/notifications (placeholder)
+// sensitiveVariables lists the configured and requested sensitive names
+// present in the request's variables.
+func sensitiveVariables(cfg *config.NotificationConfig, req models.NotificationRequest) []string {
+	var names []string
+	for _, name := range slices.Concat(cfg.SensitiveVariables, req.SensitiveVariables) {
+		if _, ok := req.Variables[name]; ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+
+// checkAttachments sizes each configured attachment variable with a HEAD
+// request, all at once, and refuses the request with 422 if one is over
+// MaxAttachmentBytes or isn't on a public host. Sizes that can't be
+// learned, because Content-Length is missing or the HEAD failed, are
+// allowed or refused per config, with one message whatever the cause so
+// responses don't tell callers which hosts the gateway can reach.
+func (h *NotificationHndler) checkAttachments(ctx context.Context, cfg *config.NotificationConfig, variables map[string]interface{}) error {
+	if cfg.MaxAttachmentBytes <= 0 || len(cfg.AttachmentVariables) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.AttachmentPreflightTimeout())
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		rejection *enqueueError
+	)
+	reject := func(err *enqueueError) {
+		mu.Lock()
+		if rejection == nil {
+			rejection = err
+		}
+		mu.Unlock()
+	}
+	for _, name := range cfg.AttachmentVariables {
+		value, ok := variables[name]
+		if !ok {
+			continue
+		}
+		rawURL, ok := value.(string)
+		if !ok {
+			reject(&enqueueError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf("Attachment %s must be a URL string", name)})
+			continue
+		}
+		wg.Go(func() {
+			size, err := h.attachments.Size(ctx, rawURL)
+			switch {
+			case errors.Is(err, client.ErrAttachmentURL), errors.Is(err, client.ErrAttachmentHost):
+				reject(&enqueueError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf("Invalid attachment %s", name), err: err})
+			case err != nil || size < 0:
+				if err == nil {
+					err = fmt.Errorf("no Content-Length")
+				}
+				if !cfg.AllowUnknownAttachmentSize {
+					slog.Debug("Attachment size unknown, rejecting", "variable", name, "error", err)
+					reject(&enqueueError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf("Size of attachment %s could not be determined", name)})
+					return
+				}
+				slog.Debug("Attachment size unknown, allowing", "variable", name, "error", err)
+			case size > int64(cfg.MaxAttachmentBytes):
+				reject(&enqueueError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf("Attachment %s is %d bytes, over the %d byte limit", name, size, cfg.MaxAttachmentBytes)})
+			}
+		})
+	}
+	wg.Wait()
+
+	if rejection != nil {
+		return rejection
+	}
+	return nil
+}
+
+
+// signLinks returns the request variables with every signed_links entry
+// replaced by a signed, expiring URL.
+func signLinks(cfg *config.NotificationConfig, req models.NotificationRequest) (map[string]interface{}, error) {
+	if len(req.SignedLinks) == 0 {
+		return req.Variables, nil
+	}
+	if cfg.LinkSigningSecret == "" {
+		return nil, fmt.Errorf("link signing is not configured")
+	}
+
+	signer := links.NewSigner(cfg.LinkSigningSecret, cfg.LinkTTL())
+	variables := make(map[string]interface{}, len(req.Variables))
+	for k, v := range req.Variables {
+		variables[k] = v
+	}
+	for _, name := range req.SignedLinks {
+		rawURL, ok := variables[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("variable %q must be a URL string", name)
+		}
+		signed, err := signer.Sign(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		variables[name] = signed
+	}
+	return variables, nil
+}
+
+
+// deliveredWithin reports whether a notification in the request's dedup group
+// was delivered to the user within its suppression window. Lookup failures
+// don't suppress.
+func (h *NotificationHndler) deliveredWithin(ctx context.Context, req models.NotificationRequest) (time.Time, bool) {
+	if req.DedupGroup == "" || req.SuppressIfDeliveredWithin <= 0 {
+		return time.Time{}, false
+	}
+
+	delivered, err := h.redis.GetLastDelivery(ctx, req.UserID, req.DedupGroup)
+	if err != nil {
+		log.Printf("Delivery lookup failed for user %s group %s, sending anyway: %v", req.UserID, req.DedupGroup, err)
+		return time.Time{}, false
+	}
+	window := time.Duration(req.SuppressIfDeliveredWithin) * time.Second
+	if delivered.IsZero() || time.Since(delivered) > window {
+		return time.Time{}, false
+	}
+	return delivered, true
+}
+
+
+// assignNotificationID uses the client-provided ID when present and valid,
+// and generates one otherwise. This is the only place IDs are assigned.
+// Client IDs are reserved for ttl, so concurrent requests with the same ID
+// can't both be accepted.
+func (h *NotificationHndler) assignNotificationID(ctx context.Context, clientID string, ttl time.Duration) (string, error) {
+	if clientID == "" {
+		return uuid.New().String(), nil
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return "", &enqueueError{status: http.StatusUnprocessableEntity, message: "notification_id must be a UUID", err: err}
+	}
+	// Normalize so lookups match regardless of the client's casing
+	clientID = id.String()
+
+	reserved, err := h.redis.ReserveNotificationID(ctx, clientID, ttl)
+	if err != nil {
+		return "", &enqueueError{status: http.StatusServiceUnavailable, message: "Failed to check notification ID", err: err}
+	}
+	if !reserved {
+		return "", &enqueueError{status: http.StatusConflict, message: "Notification " + clientID + " already exists"}
+	}
+	return clientID, nil
+}
+
+
+func (h *NotificationHndler) releaseNotificationID(ctx context.Context, notificationID string) {
+	if err := h.redis.ReleaseNotificationID(ctx, notificationID); err != nil {
+		log.Printf("Failed to release notification ID %s: %v", notificationID, err)
+	}
+}
+
+
+func (h *NotificationHndler) trimIdempotencyKeys(ctx context.Context, maxKeys int64) {
+	evicted, size, err := h.redis.TrimIdempotencyKeys(ctx, maxKeys)
+	if err != nil {
+		log.Printf("Failed to trim idempotency cache: %v", err)
+		return
+	}
+	metrics.IdempotencyEvictions.Add(float64(evicted))
+	metrics.IdempotencyCacheSize.Set(float64(size))
+}
+
+
+func (h *NotificationHndler) releaseInFlight(ctx context.Context, userID string) {
+	if err := h.redis.DecrementInFlight(ctx, userID); err != nil {
+		log.Printf("Failed to release in-flight slot for user %s: %v", userID, err)
+	}
+}
+
+
+// releaseQueuedBytes returns n bytes to the user's budget; n is 0 when
+// nothing was reserved.
+func (h *NotificationHndler) releaseQueuedBytes(ctx context.Context, userID string, n int64) {
+	if n <= 0 {
+		return
+	}
+	if err := h.redis.ReleaseQueuedBytes(ctx, userID, n); err != nil {
+		log.Printf("Failed to release %d queued bytes for user %s: %v", n, userID, err)
+	}
+}
+
+
+func (h *NotificationHndler) releaseIdempotency(ctx context.Context, userID, notificationID string) {
+	if err := h.redis.ReleaseIdempotency(ctx, userID, notificationID); err != nil {
+		log.Printf("Failed to release idempotency reservation of %s for user %s: %v", notificationID, userID, err)
+	}
+}
+
+
+// implicitIdempotencyKey derives a key from the user and request body for
+// clients that retry without X-Idempotency-Key.
+func implicitIdempotencyKey(req models.NotificationRequest) string {
+	// Struct fields and map keys marshal in a fixed order
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(append([]byte(req.UserID+"\x00"), body...))
+	return "body:" + hex.EncodeToString(sum[:])
+}
+
+
+// userPreference fetches the user's notification preferences, or nil if
+// they have none. Lookup failures fail open so a User Service outage
+// doesn't block delivery.
+func (h *NotificationHndler) userPreference(ctx context.Context, cfg *config.NotificationConfig, userID, accessToken string) *client.NotificationPreference {
+	ttl := cfg.PreferenceCacheTTL()
+	if ttl > 0 {
+		raw, err := h.redis.GetCachedPreference(ctx, userID)
+		if err != nil {
+			log.Printf("Preference cache read failed for user %s: %v", userID, err)
+		} else if raw != "" {
+			var preference *client.NotificationPreference
+			if err := json.Unmarshal([]byte(raw), &preference); err == nil {
+				return preference
+			}
+		}
+	}
+
+	profile, err := h.userService.GetUserProfile(ctx, userID, accessToken)
+	if err != nil {
+		log.Printf("Preference lookup failed for user %s, sending anyway: %v", userID, err)
+		return nil
+	}
+
+	// Users without preferences are cached too, as null
+	if ttl > 0 {
+		if raw, err := json.Marshal(profile.Preference); err == nil {
+			if err := h.redis.SetCachedPreference(ctx, userID, string(raw), ttl); err != nil {
+				log.Printf("Failed to cache preferences for user %s: %v", userID, err)
+			}
+		}
+	}
+	return profile.Preference
+}
+
+
+// channelEnabled checks the user's preferences; no preferences allows all
+func channelEnabled(preference *client.NotificationPreference, notificationType models.NotificationType) bool {
+	if preference == nil {
+		return true
+	}
+
+	switch notificationType {
+	case models.NotificationTypeEmail:
+		return preference.EmailEnabled
+	case models.NotificationTypePush:
+		return preference.PushEnabled
+	default:
+		return true
+	}
+}
+
+
+// bindJSON binds the request body into obj, answering 400 itself on
+// failure. A missing or whitespace-only body gets a clear "required" error
+// rather than the decoder's bare EOF.
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("Request body is required"))
+		return false
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request body", err))
+	return false
+}
+
+
+// bearerToken returns the caller's access token, if any
+func bearerToken(c *gin.Context) string {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
+
+
+// templateVariableViolations checks variables against the template's
+// declared types. Undeclared variables are allowed.
+func templateVariableViolations(spec config.TemplateSpec, variables map[string]interface{}) []middleware.SchemaViolation {
+	var violations []middleware.SchemaViolation
+	names := make([]string, 0, len(spec.Variables))
+	for name := range spec.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		declared := spec.Variables[name]
+		field := "/variables/" + name
+		value, ok := variables[name]
+		if !ok || value == nil {
+			if declared.Required {
+				violations = append(violations, middleware.SchemaViolation{Field: field, Message: "missing required " + declared.Type + " variable"})
+			}
+			continue
+		}
+		if actual := jsonType(value); actual != declared.Type && !(declared.Type == "number" && actual == "integer") {
+			violations = append(violations, middleware.SchemaViolation{Field: field, Message: fmt.Sprintf("expected %s, got %s", declared.Type, actual)})
+		}
+	}
+	return violations
+}
+
+
+// jsonType names the JSON type of a decoded value; numbers written without
+// a fraction or exponent are "integer".
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+
+// MarkPublished moves a notification out of the outbox state once the
+// outbox worker has published it.
+func (h *NotificationHndler) MarkPublished(ctx context.Context, notificationID string) {
+	raw, err := h.redis.GetNotificationStatusForUpdate(ctx, notificationID)
+	if err != nil {
+		log.Printf("Failed to load status for outbox notification %s: %v", notificationID, err)
+		return
+	}
+
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		log.Printf("Failed to decode status for outbox notification %s: %v", notificationID, err)
+		return
+	}
+	if status.Status != models.StatusQueuedOutbox {
+		return
+	}
+
+	status.Status = models.StatusPending
+	status.UpdatedAt = time.Now()
+	cfg := h.cfg.Load()
+	ttl := cfg.StatusTTL(string(status.Type), string(status.Priority))
+	if err := h.redis.SetNotificationStatus(ctx, notificationID, status, ttl); err != nil {
+		log.Printf("Failed to update status for outbox notification %s: %v", notificationID, err)
+		metrics.StatusWriteFailures.WithLabelValues("outbox").Inc()
+		return
+	}
+	if err := h.redis.ReindexNotificationStatus(ctx, notificationID, status.UserID, models.StatusQueuedOutbox, models.StatusPending, status.CreatedAt, ttl, cfg.MaxStatusTTL()); err != nil {
+		log.Printf("Failed to reindex outbox notification %s: %v", notificationID, err)
+	}
+	h.emitStatusChanged(ctx, status, models.StatusQueuedOutbox)
+}
+
+
+// ApplyStatusUpdate records a worker-reported state change. Updates for
+// unknown notifications or ones already in a terminal state are ignored;
+// Redis failures are returned so the update is redelivered.
+func (h *NotificationHndler) ApplyStatusUpdate(ctx context.Context, update models.StatusUpdate) error {
+	raw, err := h.redis.GetNotificationStatusForUpdate(ctx, update.NotificationID)
+	if errors.Is(err, cache.ErrNotificationNotFound) {
+		log.Printf("Ignoring status update for unknown notification %s", update.NotificationID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load status: %w", err)
+	}
+
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		log.Printf("Ignoring status update for %s, stored status is corrupt: %v", update.NotificationID, err)
+		return nil
+	}
+
+	previous := status.Status
+	if models.IsTerminalStatus(previous) {
+		// Late or duplicate delivery; never move out of a terminal state
+		return nil
+	}
+
+	status.Status = models.NormalizeStatus(update.Status)
+	status.UpdatedAt = update.UpdatedAt
+	if status.UpdatedAt.IsZero() {
+		status.UpdatedAt = time.Now()
+	}
+	if update.ErrorMessage != "" {
+		status.ErrorMessage = &update.ErrorMessage
+	}
+	if update.DeliveredChannel != "" {
+		status.DeliveredChannel = update.DeliveredChannel
+	}
+
+	cfg := h.cfg.Load()
+	ttl := cfg.StatusTTL(string(status.Type), string(status.Priority))
+	if err := h.redis.SetNotificationStatus(ctx, update.NotificationID, status, ttl); err != nil {
+		metrics.StatusWriteFailures.WithLabelValues("update").Inc()
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+	if err := h.redis.ReindexNotificationStatus(ctx, update.NotificationID, status.UserID, previous, status.Status, status.CreatedAt, ttl, cfg.MaxStatusTTL()); err != nil {
+		log.Printf("Failed to reindex notification %s: %v", update.NotificationID, err)
+	}
+
+	if models.IsTerminalStatus(status.Status) && !status.Test {
+		h.releaseInFlight(ctx, status.UserID)
+		if h.cfg.Load().MaxIdempotencyReservationsPerUser > 0 {
+			h.releaseIdempotency(ctx, status.UserID, update.NotificationID)
+		}
+		h.releaseQueuedBytes(ctx, status.UserID, status.QueuedBytes)
+	}
+	if status.Status == models.StatusSent && !status.Test {
+		observeDeliveryLatency(status)
+	}
+	if status.Status == models.StatusSent {
+		if err := h.redis.MarkNotificationUnread(ctx, status.UserID, update.NotificationID, ttl, cfg.MaxStatusTTL()); err != nil {
+			log.Printf("Failed to count notification %s as unread: %v", update.NotificationID, err)
+		}
+	}
+	if status.Status == models.StatusSent && status.DedupGroup != "" {
+		if err := h.redis.SetLastDelivery(ctx, status.UserID, status.DedupGroup, status.UpdatedAt, maxSuppressionWindow); err != nil {
+			log.Printf("Failed to record delivery of %s for group %s: %v", update.NotificationID, status.DedupGroup, err)
+		}
+	}
+	h.emitStatusChanged(ctx, status, previous)
+	h.emitWebhook(ctx, status, previous)
+	return nil
+}
+
+
+// observeDeliveryLatency records how long a sent notification took from
+// enqueue, or from its scheduled time if that was later, to the worker's
+// sent report.
+func observeDeliveryLatency(status models.NotificationStatus) {
+	start := status.CreatedAt
+	if status.ScheduledAt != nil && status.ScheduledAt.After(start) {
+		start = *status.ScheduledAt
+	}
+	if start.IsZero() {
+		return
+	}
+	channel := status.DeliveredChannel
+	if channel == "" {
+		channel = string(status.Type)
+	}
+	latency := status.UpdatedAt.Sub(start)
+	if latency < 0 {
+		// Clock skew between the gateway and the worker
+		latency = 0
+	}
+	metrics.DeliveryLatency.WithLabelValues(channel).Observe(latency.Seconds())
+}
+
+
+func (h *NotificationHndler) emitStatusChanged(ctx context.Context, status models.NotificationStatus, previous string) {
+	h.analytics.Emit(ctx, analytics.Event{
+		EventType: analytics.EventNotificationStatusChanged,
+		NotificationID: status.NotificationID,
+		UserID: status.UserID,
+		Type: string(status.Type),
+		TemplateID: status.TemplateID,
+		Priority: string(status.Priority),
+		Status: status.Status,
+		PreviousStatus: previous,
+		Timestamp: status.UpdatedAt,
+	})
+}
+
+
+// emitWebhook notifies lifecycle webhook subscribers of statuses they can
+// subscribe to.
+func (h *NotificationHndler) emitWebhook(ctx context.Context, status models.NotificationStatus, previous string) {
+	if h.webhooks == nil {
+		return
+	}
+	event := webhooks.Event{
+		Event: webhooks.EventForStatus(status.Status),
+		NotificationID: status.NotificationID,
+		UserID: status.UserID,
+		Type: string(status.Type),
+		TemplateID: status.TemplateID,
+		Status: status.Status,
+		PreviousStatus: previous,
+		Timestamp: status.UpdatedAt,
+	}
+	if status.ErrorMessage != nil {
+		event.ErrorMessage = *status.ErrorMessage
+	}
+	h.webhooks.Emit(ctx, event)
+}
+
+
+// validateIdempotencyKey bounds the key's length and charset since it is
+// embedded directly in a Redis key.
+func validateIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKeyLength {
+		return fmt.Errorf("key must be at most %d characters", maxIdempotencyKeyLength)
+	}
+	if !idempotencyKeyPattern.MatchString(key) {
+		return fmt.Errorf("key may only contain letters, digits, '-', '_', '.' and ':'")
+	}
+	return nil
+}
+
+
+// Idempotency scopes, one per endpoint that accepts X-Idempotency-Key
+const (
+	idempotencyScopeCreate = "create"
+	idempotencyScopeBatch  = "batch"
+)
+
+
+// scopedIdempotencyKey namespaces a client key by endpoint, so the same key
+// sent to create and batch stays independent. "/" can't appear in client
+// keys, so scoped keys also never collide with internal ones like
+// "replay:<id>" or "body:<hash>".
+func scopedIdempotencyKey(scope, key string) string {
+	return scope + "/" + key
+}
+
+
+// flowRetryAfter is suggested to clients while the broker applies flow
+// control; there is no way to know when it will lift
+const flowRetryAfter = 5 * time.Second
+
+
+// publishErrorStatus maps queue errors to the HTTP status returned to clients
+func publishErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, queue.ErrNotConnected), errors.Is(err, queue.ErrQueueFull), errors.Is(err, queue.ErrChannelUnavailable), errors.Is(err, queue.ErrFlowPaused):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, queue.ErrPublishTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, queue.ErrPublishRejected):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+
+// storeErrorStatus maps Redis errors to the HTTP status returned to clients.
+// A closed client means this instance is shutting down, so the request is
+// worth retrying elsewhere.
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, cache.ErrClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		// e.g. the client's X-Request-Timeout ran out
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+
+// statusReadRetryAfter is the Retry-After, in seconds, when a status read
+// times out
+const statusReadRetryAfter = 1
+
+
+// GetNotificationStatus handles GET /api/v1/notifications/:id
+func (h *NotificationHndler) GetNotificationStatus(c *gin.Context) {
+	notificationID := c.Param("id")
+
+	// A slow store answers 503 quickly instead of holding the request until
+	// the write timeout
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.cfg.Load().StatusReadTimeout())
+	defer cancel()
+
+	status, err := h.redis.GetNotificationStatus(ctx, notificationID)
+	if errors.Is(err, cache.ErrNotificationNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("Notification not found", err))
+		return
+	}
+	if err != nil && ctx.Err() != nil && c.Request.Context().Err() == nil {
+		c.Header("Retry-After", strconv.Itoa(statusReadRetryAfter))
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponseSimple("Notification status store is slow, try again shortly"))
+		return
+	}
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to load notification", err))
+		return
+	}
+
+	// Signed links only open the owner's notification
+	var record models.NotificationStatus
+	decodeErr := json.Unmarshal([]byte(status), &record)
+	if c.GetBool(middleware.SignedLinkKey) && (decodeErr != nil || record.UserID != c.GetString("user_id")) {
+		c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Notification not found"))
+		return
+	}
+
+	// A record that doesn't decode is passed through as stored
+	if decodeErr != nil {
+		c.JSON(http.StatusOK, models.SuccessResponse("Notification status retrieved", status))
+		return
+	}
+	if position, ok := h.estimatePosition(ctx, record); ok {
+		var body map[string]interface{}
+		if models.DecodeJSON([]byte(status), &body) == nil {
+			body["estimated_position"] = position
+			c.JSON(http.StatusOK, models.SuccessResponse("Notification status retrieved", body))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Notification status retrieved", json.RawMessage(status)))
+}
+
+
+// estimatePosition approximates how many notifications are queued ahead of
+// a pending one. The queue holds roughly the last depth notifications
+// published to it, and those numbered after this one are behind it, so
+// the rest are ahead. Retries, priorities and several publishers make this
+// approximate; 0 means it is next or already with a worker.
+func (h *NotificationHndler) estimatePosition(ctx context.Context, status models.NotificationStatus) (int64, bool) {
+	if !h.cfg.Load().EstimateQueuePosition || status.Status != models.StatusPending || status.QueueSequence == 0 {
+		return 0, false
+	}
+
+	depth, err := h.rabbitMQ.QueueDepth(ctx, status.RoutingKey)
+	if err != nil {
+		slog.Debug("Queue depth unavailable for position estimate", "routing_key", status.RoutingKey, "error", err)
+		return 0, false
+	}
+	latest, err := h.redis.QueueSequence(ctx, status.RoutingKey)
+	if err != nil {
+		slog.Debug("Queue sequence unavailable for position estimate", "routing_key", status.RoutingKey, "error", err)
+		return 0, false
+	}
+
+	behind := max(latest-status.QueueSequence, 0)
+	return max(int64(depth)-behind-1, 0), true
+}
+
+
+// GetNotificationSummary handles GET /api/v1/notifications/summary
+func (h *NotificationHndler) GetNotificationSummary(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	counts, err := h.redis.GetNotificationSummary(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to load notification summary", err))
+		return
+	}
+
+	summary := models.NotificationSummary{
+		ByStatus: make(map[string]int64, len(counts)),
+		Unread:   counts[cache.SummaryUnreadField],
+	}
+	for status, n := range counts {
+		if status == cache.SummaryUnreadField {
+			continue
+		}
+		summary.ByStatus[status] = n
+		summary.Total += n
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Notification summary retrieved", summary))
+}
+
+
+// MarkNotificationRead handles POST /api/v1/notifications/:id/read
+func (h *NotificationHndler) MarkNotificationRead(c *gin.Context) {
+	ctx := c.Request.Context()
+	notificationID := c.Param("id")
+	userID, _ := middleware.GetUserID(c)
+
+	raw, err := h.redis.GetNotificationStatusForUpdate(ctx, notificationID)
+	if errors.Is(err, cache.ErrNotificationNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("Notification not found", err))
+		return
+	}
+	if err != nil {
+		// The store failed; the notification may well exist
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse("Failed to load notification", err))
+		return
+	}
+
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to decode notification status", err))
+		return
+	}
+	// Other users' notifications are indistinguishable from missing ones
+	if status.UserID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Notification not found"))
+		return
+	}
+	if models.NormalizeStatus(status.Status) != models.StatusSent {
+		c.JSON(http.StatusConflict, models.ErrorResponseSimple("Only delivered notifications can be marked as read"))
+		return
+	}
+
+	if _, err := h.redis.MarkNotificationRead(ctx, status.UserID, notificationID); err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to mark notification as read", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Notification marked as read", nil))
+}
+
+
+// ListNotifications handles GET /api/v1/notifications (placeholder)
 func (h *NotificationHndler) ListNotifications(c *gin.Context) {
+	page, limit, err := parsePaging(c, defaultListLimit, h.cfg.Load().ListMaxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid paging parameters", err))
+		return
+	}
+
 	// This would typically query a database
 	// For now, return a placeholder response
 	c.JSON(http.StatusOK, models.SuccessResponseWithMeta(
 		"Notification retrieved",
 		[]interface{}{},
-		models.CalculatePagination(0, 1, 20),
+		models.CalculatePagination(0, page, limit),
 	))
-}
\ No newline at end of file
+}
+
+
+const defaultListLimit = 20
\ No newline at end of file
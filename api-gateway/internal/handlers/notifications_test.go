@@ -0,0 +1,733 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tobey0x/api-gateway/internal/analytics"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/models"
+	"github.com/tobey0x/api-gateway/internal/queue"
+)
+
+// failingOutboxStore refuses every entry
+type failingOutboxStore struct{}
+
+func (failingOutboxStore) PushOutbox(context.Context, string) error {
+	return errors.New("outbox unavailable")
+}
+func (failingOutboxStore) PeekOutbox(context.Context) (string, error) { return "", nil }
+func (failingOutboxStore) RemoveOutbox(context.Context, string) error { return nil }
+
+// testNotificationHandler wires a handler to miniredis, a user service
+// answering with profile and a broker client that was never connected,
+// so every publish fails with ErrNotConnected. users counts profile calls.
+func testNotificationHandler(t *testing.T, cfg config.NotificationConfig, outboxStore queue.OutboxStore, profile string) (h *NotificationHndler, redisClient *cache.RedisClient, users *atomic.Int32) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users = &atomic.Int32{}
+	userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(profile))
+	}))
+	t.Cleanup(userService.Close)
+
+	rabbitMQ := &queue.RabbitMQClient{}
+	if outboxStore == nil {
+		outboxStore = redisClient
+	}
+	h = NewNotificationHandler(
+		rabbitMQ,
+		redisClient,
+		queue.NewOutbox(rabbitMQ, outboxStore),
+		client.NewUserServiceClient(userService.URL, client.NewCircuitBreaker("users", 5, 0)),
+		cache.NewDenylist(redisClient, 0),
+		analytics.NopExporter{},
+		cfg,
+	)
+	return h, redisClient, users
+}
+
+func testRequest() models.NotificationRequest {
+	return models.NotificationRequest{
+		Type:       models.NotificationTypeEmail,
+		UserID:     "user-1",
+		Priority:   models.PriorityNormal,
+		TemplateID: "welcome",
+		Variables:  map[string]interface{}{"name": "Ada"},
+	}
+}
+
+func TestEnqueueIdempotencyKeyOnlyAfterQueueing(t *testing.T) {
+	tests := []struct {
+		name        string
+		outboxStore queue.OutboxStore
+		wantErr     bool
+		wantKey     bool
+	}{
+		{name: "stored in outbox", wantKey: true},
+		{name: "publish and outbox failed", outboxStore: failingOutboxStore{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{}, tt.outboxStore, `{"data":{}}`)
+			ctx := context.Background()
+			key := scopedIdempotencyKey(idempotencyScopeCreate, "retry-me")
+
+			result, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{IdempotencyKey: key})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Enqueue error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			stored, _ := redisClient.GetIdempotencyKey(ctx, key)
+			if (stored != "") != tt.wantKey {
+				t.Fatalf("idempotency key stored = %q, want stored %v", stored, tt.wantKey)
+			}
+			if tt.wantKey && stored != result.Response.NotificationID {
+				t.Errorf("idempotency key points at %s, want %s", stored, result.Response.NotificationID)
+			}
+		})
+	}
+}
+
+func TestCreateNotificationIdempotencyKeyFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "uuid", key: uuid.New().String(), want: http.StatusAccepted},
+		{name: "allowed punctuation", key: "order_42.retry:1-a", want: http.StatusAccepted},
+		{name: "at the length limit", key: strings.Repeat("k", maxIdempotencyKeyLength), want: http.StatusAccepted},
+		{name: "too long", key: strings.Repeat("k", maxIdempotencyKeyLength+1), want: http.StatusBadRequest},
+		{name: "space", key: "order 42", want: http.StatusBadRequest},
+		{name: "redis glob", key: "order*", want: http.StatusBadRequest},
+		{name: "key separator", key: "order/42", want: http.StatusBadRequest},
+		{name: "non-ascii", key: "ordér", want: http.StatusBadRequest},
+	}
+
+	h, _, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	router := gin.New()
+	router.POST("/notifications", h.CreateNotifiation)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(testRequest())
+			req := httptest.NewRequest(http.MethodPost, "/notifications", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Idempotency-Key", tt.key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestEnqueueSuppressedIsRecorded(t *testing.T) {
+	tests := []struct {
+		name          string
+		cacheSeconds  int
+		wantUserCalls int32
+	}{
+		{name: "preferences cached", cacheSeconds: 300, wantUserCalls: 1},
+		{name: "cache disabled", cacheSeconds: 0, wantUserCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NotificationConfig{PreferenceCacheSeconds: tt.cacheSeconds}
+			profile := `{"data":{"id":"user-1","preference":{"email_enabled":false,"push_enabled":true}}}`
+			h, redisClient, users := testNotificationHandler(t, cfg, nil, profile)
+			ctx := context.Background()
+
+			key := scopedIdempotencyKey(idempotencyScopeCreate, "suppressed")
+			result, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{IdempotencyKey: key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := result.Response.NotificationID
+			if result.Response.Status != models.StatusSuppressed || id == "" {
+				t.Fatalf("response = %+v, want suppressed with an ID", result.Response)
+			}
+
+			raw, err := redisClient.GetNotificationStatus(ctx, id)
+			if err != nil {
+				t.Fatalf("suppressed notification %s has no status record: %v", id, err)
+			}
+			var status models.NotificationStatus
+			if err := json.Unmarshal([]byte(raw), &status); err != nil || status.Status != models.StatusSuppressed {
+				t.Errorf("status record = %s, want status suppressed", raw)
+			}
+			if stored, _ := redisClient.GetIdempotencyKey(ctx, key); stored != id {
+				t.Errorf("idempotency key points at %q, want %s", stored, id)
+			}
+
+			// Another create for the same user, without a key
+			if _, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := users.Load(); got != tt.wantUserCalls {
+				t.Errorf("User Service called %d times, want %d", got, tt.wantUserCalls)
+			}
+		})
+	}
+}
+
+func TestApplyStatusUpdateReleasesInFlight(t *testing.T) {
+	tests := []struct {
+		name         string
+		update       string
+		wantStatus   string
+		wantReleased bool
+	}{
+		{name: "sent", update: models.StatusSent, wantStatus: models.StatusSent, wantReleased: true},
+		{name: "push worker delivered", update: models.StatusDelivered, wantStatus: models.StatusSent, wantReleased: true},
+		{name: "failed", update: models.StatusFailed, wantStatus: models.StatusFailed, wantReleased: true},
+		{name: "processing", update: models.StatusProcessing, wantStatus: models.StatusProcessing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+			ctx := context.Background()
+
+			status := models.NotificationStatus{
+				NotificationID: "n1",
+				UserID:         "user-1",
+				Type:           models.NotificationTypePush,
+				Status:         models.StatusPending,
+				CreatedAt:      time.Now(),
+			}
+			if err := redisClient.SetNotificationStatus(ctx, "n1", status, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := redisClient.IncrementInFlight(ctx, "user-1", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := h.ApplyStatusUpdate(ctx, models.StatusUpdate{NotificationID: "n1", Status: tt.update}); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := redisClient.GetNotificationStatus(ctx, "n1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(raw), &status); err != nil || status.Status != tt.wantStatus {
+				t.Errorf("status record = %s, want status %s", raw, tt.wantStatus)
+			}
+
+			// The next reservation shows whether the first was released
+			inFlight, err := redisClient.IncrementInFlight(ctx, "user-1", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if released := inFlight == 1; released != tt.wantReleased {
+				t.Errorf("in-flight released = %v, want %v", released, tt.wantReleased)
+			}
+		})
+	}
+}
+
+func TestEnqueueChannelRateLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		wantStatus   int
+		wantPriority models.Priority
+	}{
+		{name: "reject", action: config.ChannelRateLimitReject, wantStatus: http.StatusServiceUnavailable},
+		{name: "deprioritize", action: config.ChannelRateLimitDeprioritize, wantPriority: models.PriorityLow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NotificationConfig{
+				ChannelRateLimits:      map[string]int{"email": 2, "push": 100},
+				ChannelRateLimitAction: tt.action,
+			}
+			h, redisClient, _ := testNotificationHandler(t, cfg, nil, `{"data":{}}`)
+			ctx := context.Background()
+
+			// Two per second may arrive at once
+			for range 2 {
+				if _, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Other channels have their own budget
+			push := testRequest()
+			push.Type = models.NotificationTypePush
+			if _, err := h.Enqueue(ctx, push, EnqueueOptions{}); err != nil {
+				t.Fatalf("push create = %v, want its own budget", err)
+			}
+
+			result, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{})
+			if tt.wantStatus != 0 {
+				var enqueueErr *enqueueError
+				if !errors.As(err, &enqueueErr) || enqueueErr.status != tt.wantStatus || enqueueErr.retryAfter <= 0 {
+					t.Fatalf("throttled create = %v, want %d with Retry-After", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, err := redisClient.GetNotificationStatus(ctx, result.Response.NotificationID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status models.NotificationStatus
+			if err := json.Unmarshal([]byte(raw), &status); err != nil || status.Priority != tt.wantPriority {
+				t.Errorf("status record = %s, want priority %s", raw, tt.wantPriority)
+			}
+		})
+	}
+}
+
+func TestEnqueueNotificationID(t *testing.T) {
+	const clientID = "6F1C2A3B-4D5E-4F60-8172-8394A5B6C7D8"
+	tests := []struct {
+		name        string
+		ids         []string
+		outboxStore queue.OutboxStore
+		wantStatus  []int
+	}{
+		{name: "generated", ids: []string{"", ""}, wantStatus: []int{0, 0}},
+		{name: "client", ids: []string{clientID}, wantStatus: []int{0}},
+		{name: "malformed client", ids: []string{"not-a-uuid"}, wantStatus: []int{http.StatusUnprocessableEntity}},
+		{name: "client reused", ids: []string{clientID, clientID}, wantStatus: []int{0, http.StatusConflict}},
+		{name: "client reused with other casing", ids: []string{clientID, "6f1c2a3b-4d5e-4f60-8172-8394a5b6c7d8"}, wantStatus: []int{0, http.StatusConflict}},
+		{
+			name:        "client freed after failure",
+			ids:         []string{clientID, clientID},
+			outboxStore: failingOutboxStore{},
+			wantStatus:  []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, _ := testNotificationHandler(t, config.NotificationConfig{}, tt.outboxStore, `{"data":{}}`)
+			seen := map[string]bool{}
+			for i, id := range tt.ids {
+				req := testRequest()
+				req.NotificationID = id
+				result, err := h.Enqueue(context.Background(), req, EnqueueOptions{})
+
+				var ee *enqueueError
+				status := 0
+				if errors.As(err, &ee) {
+					status = ee.status
+				} else if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+				if status != tt.wantStatus[i] {
+					t.Fatalf("request %d: status %d (%v), want %d", i, status, err, tt.wantStatus[i])
+				}
+				if err != nil {
+					continue
+				}
+
+				got := result.Response.NotificationID
+				if _, err := uuid.Parse(got); err != nil {
+					t.Errorf("request %d: notification ID %q is not a UUID", i, got)
+				}
+				if id != "" && got != strings.ToLower(id) {
+					t.Errorf("request %d: notification ID %q, want %q", i, got, strings.ToLower(id))
+				}
+				if seen[got] {
+					t.Errorf("request %d: notification ID %q assigned twice", i, got)
+				}
+				seen[got] = true
+			}
+		})
+	}
+}
+
+func TestEnqueueConcurrentClientNotificationID(t *testing.T) {
+	h, _, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	req := testRequest()
+	req.NotificationID = uuid.New().String()
+
+	const requests = 10
+	var accepted, conflicts atomic.Int32
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Go(func() {
+			_, err := h.Enqueue(context.Background(), req, EnqueueOptions{})
+			var ee *enqueueError
+			switch {
+			case err == nil:
+				accepted.Add(1)
+			case errors.As(err, &ee) && ee.status == http.StatusConflict:
+				conflicts.Add(1)
+			default:
+				t.Errorf("Enqueue = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if accepted.Load() != 1 || conflicts.Load() != requests-1 {
+		t.Errorf("accepted %d, conflicts %d; want 1, %d", accepted.Load(), conflicts.Load(), requests-1)
+	}
+}
+
+func TestBatchRejectsRepeatedClientNotificationID(t *testing.T) {
+	h, _, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	router := gin.New()
+	router.POST("/batch", h.CreateNotificationBatch)
+
+	id := uuid.New().String()
+	first, second, generated := testRequest(), testRequest(), testRequest()
+	first.NotificationID = id
+	second.NotificationID = id
+	body, _ := json.Marshal(models.BatchNotificationRequest{Notifications: []models.NotificationRequest{first, second, generated}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data models.BatchResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCodes := []int{http.StatusAccepted, http.StatusConflict, http.StatusAccepted}
+	for i, result := range resp.Data.Results {
+		if result.Code != wantCodes[i] {
+			t.Errorf("item %d: code %d (%s), want %d", i, result.Code, result.Error, wantCodes[i])
+		}
+	}
+	if resp.Data.Results[0].NotificationID != id {
+		t.Errorf("item 0: notification ID %q, want %q", resp.Data.Results[0].NotificationID, id)
+	}
+	if resp.Data.Accepted != 2 || resp.Data.Failed != 1 {
+		t.Errorf("accepted %d, failed %d; want 2, 1", resp.Data.Accepted, resp.Data.Failed)
+	}
+}
+
+func TestMarkNotificationRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		owner  string
+		fail   func(mr *miniredis.Miniredis, redisClient *cache.RedisClient)
+		want   int
+	}{
+		{name: "sent", status: models.StatusSent, owner: "user-1", want: http.StatusOK},
+		{name: "not sent yet", status: models.StatusPending, owner: "user-1", want: http.StatusConflict},
+		{name: "other user's", status: models.StatusSent, owner: "user-2", want: http.StatusNotFound},
+		{name: "missing", want: http.StatusNotFound},
+		{name: "store down", status: models.StatusSent, owner: "user-1", fail: func(mr *miniredis.Miniredis, _ *cache.RedisClient) { mr.Close() }, want: http.StatusServiceUnavailable},
+		{name: "store closed", status: models.StatusSent, owner: "user-1", fail: func(_ *miniredis.Miniredis, r *cache.RedisClient) { r.Close() }, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := NewNotificationHandler(nil, redisClient, nil, nil, nil, analytics.NopExporter{}, config.NotificationConfig{})
+
+			id := uuid.New().String()
+			if tt.status != "" {
+				record := models.NotificationStatus{NotificationID: id, UserID: tt.owner, Status: tt.status}
+				if err := redisClient.SetNotificationStatus(context.Background(), id, record, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.fail != nil {
+				tt.fail(mr, redisClient)
+			}
+
+			router := gin.New()
+			router.POST("/notifications/:id/read", func(c *gin.Context) {
+				// Stands in for the auth middleware
+				c.Set("user_id", "user-1")
+			}, h.MarkNotificationRead)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/notifications/"+id+"/read", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// recordingExporter keeps every analytics event
+type recordingExporter struct {
+	mu     sync.Mutex
+	events []analytics.Event
+}
+
+func (e *recordingExporter) Emit(_ context.Context, event analytics.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *recordingExporter) Close() error { return nil }
+
+func TestEnqueueEmitsAnalytics(t *testing.T) {
+	h, _, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	exporter := &recordingExporter{}
+	h.analytics = exporter
+
+	result, err := h.Enqueue(context.Background(), testRequest(), EnqueueOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exporter.events) != 1 {
+		t.Fatalf("emitted %d events, want 1", len(exporter.events))
+	}
+	event := exporter.events[0]
+	if event.EventType != analytics.EventNotificationCreated || event.NotificationID != result.Response.NotificationID ||
+		event.UserID != "user-1" || event.Type != "email" || event.Status != result.Response.Status {
+		t.Errorf("event = %+v, want notification.created for %+v", event, result.Response)
+	}
+}
+
+func TestEnqueueUnaffectedByAnalyticsOutage(t *testing.T) {
+	h, _, _ := testNotificationHandler(t, config.NotificationConfig{}, nil, `{"data":{}}`)
+	// Nothing listens here
+	exporter := analytics.NewKafkaExporter([]string{"127.0.0.1:1"}, "analytics")
+	defer exporter.Close()
+	h.analytics = exporter
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{}); err != nil {
+		t.Errorf("Enqueue with analytics down = %v", err)
+	}
+}
+
+func TestPublishErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: queue.ErrNotConnected, want: http.StatusServiceUnavailable},
+		{err: queue.ErrQueueFull, want: http.StatusServiceUnavailable},
+		{err: queue.ErrChannelUnavailable, want: http.StatusServiceUnavailable},
+		{err: queue.ErrFlowPaused, want: http.StatusServiceUnavailable},
+		{err: fmt.Errorf("%w: i/o timeout", queue.ErrPublishTimeout), want: http.StatusGatewayTimeout},
+		{err: fmt.Errorf("%w: NOT_FOUND", queue.ErrPublishRejected), want: http.StatusBadGateway},
+		{err: errors.New("marshal failed"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := publishErrorStatus(tt.err); got != tt.want {
+			t.Errorf("publishErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+
+	// Without a broker or an outbox the typed error reaches the client
+	h, _, _ := testNotificationHandler(t, config.NotificationConfig{}, failingOutboxStore{}, `{"data":{}}`)
+	_, err := h.Enqueue(context.Background(), testRequest(), EnqueueOptions{})
+	var ee *enqueueError
+	if !errors.As(err, &ee) || ee.status != http.StatusServiceUnavailable || !errors.Is(err, queue.ErrNotConnected) {
+		t.Errorf("Enqueue error = %v, want a 503 wrapping ErrNotConnected", err)
+	}
+}
+
+func TestStoreErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "closed", err: cache.ErrClosed, want: http.StatusServiceUnavailable},
+		{name: "wrapped closed", err: fmt.Errorf("load: %w", cache.ErrClosed), want: http.StatusServiceUnavailable},
+		{name: "deadline", err: context.DeadlineExceeded, want: http.StatusGatewayTimeout},
+		{name: "other", err: errors.New("WRONGTYPE"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := storeErrorStatus(tt.err); got != tt.want {
+			t.Errorf("%s: storeErrorStatus = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetNotificationStatusAfterClose(t *testing.T) {
+	h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{StatusReadTimeoutMillis: 1000}, nil, `{"data":{}}`)
+	result, err := h.Enqueue(context.Background(), testRequest(), EnqueueOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.GET("/notifications/:id", h.GetNotificationStatus)
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/notifications/"+result.Response.NotificationID, nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	redisClient.Close()
+	if w := get(); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("after Close status = %d, want 503: %s", w.Code, w.Body)
+	}
+}
+
+func TestEnqueueUpdateConfig(t *testing.T) {
+	h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{TemplateAllowlist: []string{"welcome"}}, nil, `{"data":{}}`)
+	ctx := context.Background()
+
+	// popRoutingKey returns the routing key of the notification just stored
+	// in the outbox, since publishing always fails here
+	popRoutingKey := func() string {
+		t.Helper()
+		raw, err := redisClient.PeekOutbox(ctx)
+		if err != nil || raw == "" {
+			t.Fatalf("outbox entry %q: %v", raw, err)
+		}
+		redisClient.RemoveOutbox(ctx, raw)
+		var entry queue.OutboxEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry.RoutingKey
+	}
+
+	if _, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := popRoutingKey(); got != "email" {
+		t.Errorf("routing key = %q, want email", got)
+	}
+
+	h.UpdateConfig(config.NotificationConfig{
+		TemplateAllowlist: []string{"reset"},
+		Routes:            map[string]string{"email": "email.v2"},
+	})
+
+	var ee *enqueueError
+	if _, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{}); !errors.As(err, &ee) || ee.status != http.StatusUnprocessableEntity {
+		t.Fatalf("template dropped from the allowlist: error = %v, want 422", err)
+	}
+	req := testRequest()
+	req.TemplateID = "reset"
+	if _, err := h.Enqueue(ctx, req, EnqueueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := popRoutingKey(); got != "email.v2" {
+		t.Errorf("routing key after reload = %q, want email.v2", got)
+	}
+}
+
+func TestBatchIdempotency(t *testing.T) {
+	h, redisClient, _ := testNotificationHandler(t, config.NotificationConfig{TemplateAllowlist: []string{"welcome"}}, nil, `{"data":{}}`)
+	ctx := context.Background()
+	router := gin.New()
+	router.POST("/batch", h.CreateNotificationBatch)
+
+	rejected := testRequest()
+	rejected.TemplateID = "unknown"
+	batch := models.BatchNotificationRequest{Notifications: []models.NotificationRequest{testRequest(), rejected, testRequest()}}
+
+	post := func(key string, req models.BatchNotificationRequest) (*httptest.ResponseRecorder, models.BatchResponse) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			r.Header.Set("X-Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var resp struct {
+			Data models.BatchResponse `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+	queued := func() int64 {
+		t.Helper()
+		n, err := redisClient.OutboxLength(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	w, first := post("batch-1", batch)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	wantCodes := []int{http.StatusAccepted, http.StatusUnprocessableEntity, http.StatusAccepted}
+	for i, item := range first.Results {
+		if item.Code != wantCodes[i] {
+			t.Errorf("item %d: code %d (%s), want %d", i, item.Code, item.Error, wantCodes[i])
+		}
+	}
+	if first.Accepted != 2 || first.Failed != 1 || queued() != 2 {
+		t.Fatalf("accepted %d, failed %d, queued %d; want 2, 1, 2", first.Accepted, first.Failed, queued())
+	}
+
+	// A replay, even with a different body, returns the stored result
+	w, replay := post("batch-1", models.BatchNotificationRequest{Notifications: []models.NotificationRequest{testRequest()}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "idempotent") {
+		t.Errorf("replay status = %d: %s", w.Code, w.Body)
+	}
+	if replay.Results[0].NotificationID != first.Results[0].NotificationID || len(replay.Results) != 3 || queued() != 2 {
+		t.Errorf("replay returned %+v and queued %d, want the first result and nothing new", replay, queued())
+	}
+
+	// A batch still being processed can't be replayed yet
+	if _, err := redisClient.ClaimBatch(ctx, "batch-2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := post("batch-2", batch); w.Code != http.StatusConflict {
+		t.Errorf("in-progress batch: status = %d, want 409", w.Code)
+	}
+
+	// After a crash the retried batch skips items that were already queued
+	crashedItem, err := h.Enqueue(ctx, testRequest(), EnqueueOptions{IdempotencyKey: scopedIdempotencyKey(idempotencyScopeBatch, "batch-3/0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := queued()
+	_, retried := post("batch-3", batch)
+	if retried.Results[0].NotificationID != crashedItem.Response.NotificationID || retried.Results[0].Code != http.StatusOK {
+		t.Errorf("item 0 after a crash = %+v, want the already queued %s", retried.Results[0], crashedItem.Response.NotificationID)
+	}
+	if got := queued() - before; got != 1 {
+		t.Errorf("retried batch queued %d notifications, want 1", got)
+	}
+
+	if w, _ := post("bad key!", batch); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid key: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPagingOffset bounds page*limit so deep pages can't overflow or force a
+// huge scan
+const maxPagingOffset = 100000
+
+// parsePaging reads the page and limit query params shared by every paged
+// endpoint. Missing values default to page 1 and defaultLimit. Zero or
+// negative values are clamped to 1, and limit to maxLimit. Values that
+// aren't integers, or pages past maxPagingOffset results, are errors.
+func parsePaging(c *gin.Context, defaultLimit, maxLimit int) (int, int, error) {
+	page, limit := 1, min(defaultLimit, maxLimit)
+
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("page must be an integer")
+		}
+		page = max(n, 1)
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("limit must be an integer")
+		}
+		limit = min(max(n, 1), maxLimit)
+	}
+	if page > maxPagingOffset/limit {
+		return 0, 0, fmt.Errorf("page must be at most %d for limit %d", maxPagingOffset/limit, limit)
+	}
+	return page, limit, nil
+}
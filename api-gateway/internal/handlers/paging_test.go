@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParsePaging(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantPage  int
+		wantLimit int
+		wantErr   bool
+	}{
+		{query: "", wantPage: 1, wantLimit: 20},
+		{query: "page=3&limit=50", wantPage: 3, wantLimit: 50},
+		{query: "limit=100000", wantPage: 1, wantLimit: 100},
+		{query: "page=0&limit=0", wantPage: 1, wantLimit: 1},
+		{query: "page=-4&limit=-10", wantPage: 1, wantLimit: 1},
+		{query: "page=1000&limit=100", wantPage: 1000, wantLimit: 100},
+		{query: "page=1001&limit=100", wantErr: true},
+		{query: "page=two", wantErr: true},
+		{query: "limit=1.5", wantErr: true},
+		{query: "page=99999999999999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			page, limit, err := parsePaging(c, 20, 100)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePaging() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (page != tt.wantPage || limit != tt.wantLimit) {
+				t.Errorf("parsePaging() = %d, %d, want %d, %d", page, limit, tt.wantPage, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"slices"
+	"time"
+
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// quietHoursDeferral returns when a notification due at `at` may be sent
+// if that falls in the user's quiet hours. High priority, channels not
+// subject to quiet hours, and users without a known timezone are never
+// deferred.
+func quietHoursDeferral(cfg *config.NotificationConfig, preference *client.NotificationPreference, req models.NotificationRequest, at time.Time) (time.Time, bool) {
+	start, end, ok, _ := cfg.QuietHours()
+	if !ok || req.Priority == models.PriorityHigh || !slices.Contains(cfg.QuietHoursChannels, string(req.Type)) {
+		return time.Time{}, false
+	}
+	if preference == nil || preference.Timezone == nil {
+		return time.Time{}, false
+	}
+	loc, err := time.LoadLocation(*preference.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return quietHoursEnd(at.In(loc), start, end)
+}
+
+// quietHoursEnd reports whether local falls in the window [start, end),
+// given as wall-clock offsets from midnight, and if so when the window
+// ends. A window with start after end wraps past midnight.
+func quietHoursEnd(local time.Time, start, end time.Duration) (time.Time, bool) {
+	hour, minute, second := local.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+
+	switch {
+	case start < end && offset >= start && offset < end:
+		return wallClock(local, 0, end), true
+	case start > end && offset >= start:
+		// Before midnight; the window ends tomorrow
+		return wallClock(local, 1, end), true
+	case start > end && offset < end:
+		return wallClock(local, 0, end), true
+	}
+	return time.Time{}, false
+}
+
+// wallClock is the given wall-clock time days after local's date, so a DST
+// change in between doesn't shift it
+func wallClock(local time.Time, days int, offset time.Duration) time.Time {
+	year, month, day := local.Date()
+	return time.Date(year, month, day+days, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, local.Location())
+}
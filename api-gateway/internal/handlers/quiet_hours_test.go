@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	utc := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.June, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		local      time.Time
+		start, end time.Duration
+		wantEnd    time.Time
+		wantQuiet  bool
+	}{
+		{name: "inside a daytime window", local: utc(10, 13, 0), start: 12 * time.Hour, end: 14 * time.Hour, wantEnd: utc(10, 14, 0), wantQuiet: true},
+		{name: "window start is inclusive", local: utc(10, 12, 0), start: 12 * time.Hour, end: 14 * time.Hour, wantEnd: utc(10, 14, 0), wantQuiet: true},
+		{name: "window end is exclusive", local: utc(10, 14, 0), start: 12 * time.Hour, end: 14 * time.Hour},
+		{name: "before a daytime window", local: utc(10, 11, 59), start: 12 * time.Hour, end: 14 * time.Hour},
+		{name: "wrapping window before midnight", local: utc(10, 23, 30), start: 22 * time.Hour, end: 7 * time.Hour, wantEnd: utc(11, 7, 0), wantQuiet: true},
+		{name: "wrapping window after midnight", local: utc(10, 3, 15), start: 22 * time.Hour, end: 7 * time.Hour, wantEnd: utc(10, 7, 0), wantQuiet: true},
+		{name: "outside a wrapping window", local: utc(10, 12, 0), start: 22 * time.Hour, end: 7 * time.Hour},
+		{name: "month boundary", local: time.Date(2026, time.June, 30, 22, 30, 0, 0, time.UTC), start: 22 * time.Hour, end: 7 * time.Hour, wantEnd: time.Date(2026, time.July, 1, 7, 0, 0, 0, time.UTC), wantQuiet: true},
+		{
+			// Clocks spring forward at 02:00 on 8 March, so the night is an
+			// hour shorter but the window still ends at 07:00 local
+			name:      "across a DST change",
+			local:     time.Date(2026, time.March, 7, 23, 0, 0, 0, newYork),
+			start:     22 * time.Hour,
+			end:       7 * time.Hour,
+			wantEnd:   time.Date(2026, time.March, 8, 7, 0, 0, 0, newYork),
+			wantQuiet: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotEnd, quiet := quietHoursEnd(tt.local, tt.start, tt.end)
+			if quiet != tt.wantQuiet || !gotEnd.Equal(tt.wantEnd) {
+				t.Errorf("quietHoursEnd = %s, %v; want %s, %v", gotEnd, quiet, tt.wantEnd, tt.wantQuiet)
+			}
+		})
+	}
+}
+
+func TestQuietHoursDeferral(t *testing.T) {
+	cfg := &config.NotificationConfig{QuietHoursStart: "22:00", QuietHoursEnd: "07:00", QuietHoursChannels: []string{"push"}}
+	// 23:00 in Lagos (UTC+1, no DST)
+	at := time.Date(2026, time.June, 10, 22, 0, 0, 0, time.UTC)
+	zone := func(name string) *client.NotificationPreference {
+		return &client.NotificationPreference{Timezone: &name}
+	}
+	push := models.NotificationRequest{Type: models.NotificationTypePush, Priority: models.PriorityNormal}
+
+	tests := []struct {
+		name       string
+		cfg        *config.NotificationConfig
+		preference *client.NotificationPreference
+		mutate     func(*models.NotificationRequest)
+		wantUntil  time.Time
+	}{
+		{name: "deferred to the user's morning", preference: zone("Africa/Lagos"), wantUntil: time.Date(2026, time.June, 11, 6, 0, 0, 0, time.UTC)},
+		{name: "daytime for the user", preference: zone("Asia/Tokyo")},
+		{name: "high priority", preference: zone("Africa/Lagos"), mutate: func(r *models.NotificationRequest) { r.Priority = models.PriorityHigh }},
+		{name: "channel not subject to quiet hours", preference: zone("Africa/Lagos"), mutate: func(r *models.NotificationRequest) { r.Type = models.NotificationTypeEmail }},
+		{name: "no preferences"},
+		{name: "no timezone", preference: &client.NotificationPreference{}},
+		{name: "unknown timezone", preference: zone("Mars/Olympus_Mons")},
+		{name: "quiet hours disabled", cfg: &config.NotificationConfig{QuietHoursChannels: []string{"push"}}, preference: zone("Africa/Lagos")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			if tt.cfg != nil {
+				c = tt.cfg
+			}
+			req := push
+			if tt.mutate != nil {
+				tt.mutate(&req)
+			}
+			until, deferred := quietHoursDeferral(c, tt.preference, req, at)
+			if deferred != !tt.wantUntil.IsZero() || !until.Equal(tt.wantUntil) {
+				t.Errorf("quietHoursDeferral = %s, %v; want %s", until, deferred, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestEnqueueDefersDuringQuietHours(t *testing.T) {
+	// A window around now, in UTC, so every normal push is deferred
+	now := time.Now().UTC()
+	cfg := config.NotificationConfig{
+		QuietHoursStart:    now.Add(-time.Hour).Format("15:04"),
+		QuietHoursEnd:      now.Add(time.Hour).Format("15:04"),
+		QuietHoursChannels: []string{"push"},
+	}
+	profile := `{"data":{"id":"user-1","preference":{"email_enabled":true,"push_enabled":true,"timezone":"UTC"}}}`
+	h, redisClient, _ := testNotificationHandler(t, cfg, nil, profile)
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		priority     models.Priority
+		test         bool
+		wantDeferred bool
+	}{
+		{name: "normal priority", priority: models.PriorityNormal, wantDeferred: true},
+		{name: "high priority", priority: models.PriorityHigh},
+		{name: "test send", priority: models.PriorityNormal, test: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testRequest()
+			req.Type = models.NotificationTypePush
+			req.Priority = tt.priority
+			result, err := h.Enqueue(ctx, req, EnqueueOptions{Test: tt.test})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := redisClient.GetNotificationStatus(ctx, result.Response.NotificationID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status models.NotificationStatus
+			if err := json.Unmarshal([]byte(raw), &status); err != nil {
+				t.Fatal(err)
+			}
+
+			if (status.ScheduledAt != nil) != tt.wantDeferred {
+				t.Fatalf("scheduled_at %v, want deferred %v", status.ScheduledAt, tt.wantDeferred)
+			}
+			if tt.wantDeferred {
+				end := now.Add(time.Hour).Truncate(time.Minute)
+				if !status.ScheduledAt.Equal(end) {
+					t.Errorf("scheduled_at = %s, want the end of quiet hours %s", status.ScheduledAt, end)
+				}
+			}
+		})
+	}
+}
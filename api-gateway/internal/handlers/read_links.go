@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/links"
+	"github.com/tobey0x/api-gateway/internal/middleware"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// SharedNotificationPath is the signed-link route for a notification's status
+const SharedNotificationPath = "/api/v1/shared/notifications/"
+
+// ReadLinkHandler issues signed links that grant read access to a single
+// notification's status without a JWT.
+type ReadLinkHandler struct {
+	redis  *cache.RedisClient
+	signer *links.Signer
+	ttl    time.Duration
+}
+
+func NewReadLinkHandler(redis *cache.RedisClient, signer *links.Signer, ttl time.Duration) *ReadLinkHandler {
+	return &ReadLinkHandler{
+		redis:  redis,
+		signer: signer,
+		ttl:    ttl,
+	}
+}
+
+// CreateReadLink handles POST /api/v1/notifications/:id/link
+func (h *ReadLinkHandler) CreateReadLink(c *gin.Context) {
+	notificationID := c.Param("id")
+
+	raw, err := h.redis.GetNotificationStatus(c.Request.Context(), notificationID)
+	if errors.Is(err, cache.ErrClosed) {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse("Failed to load notification", err))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("Notification not found", err))
+		return
+	}
+
+	var status models.NotificationStatus
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to decode notification status", err))
+		return
+	}
+	userID, _ := middleware.GetUserID(c)
+	if status.UserID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Notification not found"))
+		return
+	}
+
+	// The link is scoped to the owner, not to whoever requested it
+	now := time.Now()
+	link := h.signer.SignPath(SharedNotificationPath+notificationID, url.Values{"user_id": {status.UserID}}, now)
+	c.JSON(http.StatusOK, models.SuccessResponse("Read link created", gin.H{
+		"url":        link,
+		"expires_at": now.Add(h.ttl).UTC(),
+	}))
+}
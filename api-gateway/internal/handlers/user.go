@@ -2,26 +2,166 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
 )
 
+// cacheableRoutes are the proxied GET routes eligible for response caching.
+var cacheableRoutes = map[string]bool{
+	"/api/v1/users/profile/:id":    true,
+	"/api/v1/users/preference/:id": true,
+}
+
 type UserHandler struct {
 	userServiceURL string
 	httpClient     *http.Client
+	// timeout bounds a whole proxied request, body included; the transport
+	// bounds the phases before the response headers
+	timeout time.Duration
+	// maxResponseBytes caps the buffered User Service response body
+	maxResponseBytes int64
+	redis            *cache.RedisClient
+	cacheTTL         time.Duration
+	breaker          *client.CircuitBreaker
+	forwardHeaders   []string
+	stripHeaders     []string
 }
 
-func NewUserHandler(userServiceURL string) *UserHandler {
+// NewUserHandler creates the User Service proxy. The breaker should be the one
+// shared with the UserServiceClient so both paths fail fast together.
+func NewUserHandler(userServiceURL string, redis *cache.RedisClient, cfg config.ProxyConfig, breaker *client.CircuitBreaker) *UserHandler {
 	return &UserHandler{
-		userServiceURL: userServiceURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+		userServiceURL:   userServiceURL,
+		httpClient:       &http.Client{Transport: proxyTransport(cfg)},
+		timeout:          cfg.Timeout(),
+		maxResponseBytes: cfg.MaxResponseBytes,
+		redis:            redis,
+		cacheTTL:         cfg.CacheTTL(),
+		breaker:          breaker,
+		forwardHeaders:   cfg.ForwardHeaders,
+		stripHeaders:     cfg.StripHeaders,
+	}
+}
+
+func proxyTransport(cfg config.ProxyConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   cfg.ConnectTimeout(),
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout()
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout()
+	return transport
+}
+
+// Proxy timeouts, by the phase the request was in when time ran out
+var (
+	errProxyConnectTimeout        = errors.New("timed out connecting to user service")
+	errProxyTLSHandshakeTimeout   = errors.New("timed out in TLS handshake with user service")
+	errProxyResponseHeaderTimeout = errors.New("timed out waiting for user service response headers")
+	errProxyTimeout               = errors.New("user service request exceeded its overall timeout")
+)
+
+// proxyPhases records how far a proxied request got, so a timeout can be
+// attributed to the phase that ran out of time
+type proxyPhases struct {
+	connected  atomic.Bool
+	handshaken atomic.Bool
+	gotHeaders atomic.Bool
+}
+
+func (p *proxyPhases) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				p.connected.Store(true)
+			}
 		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				p.handshaken.Store(true)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			// A reused connection skips dialing and the handshake
+			if info.Reused {
+				p.connected.Store(true)
+				p.handshaken.Store(true)
+			}
+		},
+		GotFirstResponseByte: func() {
+			p.gotHeaders.Store(true)
+		},
+	}
+}
+
+// timeoutError maps err to one of the proxy timeout errors, or nil if err
+// is not a timeout.
+func (p *proxyPhases) timeoutError(ctx context.Context, err error, https bool) error {
+	var netErr net.Error
+	overall := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if !overall && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		return nil
+	}
+	switch {
+	case !p.connected.Load():
+		return errProxyConnectTimeout
+	case https && !p.handshaken.Load():
+		return errProxyTLSHandshakeTimeout
+	case !p.gotHeaders.Load() && !overall:
+		return errProxyResponseHeaderTimeout
+	default:
+		return errProxyTimeout
+	}
+}
+
+// forwardHeader applies the configured allowlist (empty allows everything)
+// and then the denylist. Patterns are case-insensitive and may end in '*'.
+func (h *UserHandler) forwardHeader(key string) bool {
+	if len(h.forwardHeaders) > 0 && !matchHeader(h.forwardHeaders, key) {
+		return false
 	}
+	return !matchHeader(h.stripHeaders, key)
+}
+
+func matchHeader(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(key, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedResponse is the serialized form of a proxied response in Redis
+type cachedResponse struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
 }
 
 // ProxyToUserService forwards requests to the User Service
@@ -30,12 +170,24 @@ func (h *UserHandler) ProxyToUserService(c *gin.Context) {
 	// Remove /api/v1 prefix if it exists in the path
 	path := c.Request.URL.Path
 	query := c.Request.URL.RawQuery
-	
+
 	targetURL := h.userServiceURL + path
 	if query != "" {
 		targetURL += "?" + query
 	}
 
+	// Serve from cache when possible. Only requests the gateway has already
+	// authenticated are cached, so a revoked or expired token can't be
+	// answered from the cache. Entries are keyed per caller and query, so
+	// one user's token can never read another caller's cached response.
+	cacheVariant := ""
+	if h.cacheTTL > 0 && c.Request.Method == http.MethodGet && cacheableRoutes[c.FullPath()] && c.GetString("user_id") != "" {
+		cacheVariant = responseCacheVariant(c)
+		if !strings.Contains(c.GetHeader("Cache-Control"), "no-cache") && h.serveCached(c, path, cacheVariant) {
+			return
+		}
+	}
+
 	// Read the request body
 	var bodyBytes []byte
 	if c.Request.Body != nil {
@@ -44,8 +196,12 @@ func (h *UserHandler) ProxyToUserService(c *gin.Context) {
 	}
 
 	// Create the proxy request
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+	var phases proxyPhases
+	ctx = httptrace.WithClientTrace(ctx, phases.trace())
 	proxyReq, err := http.NewRequestWithContext(
-		c.Request.Context(),
+		ctx,
 		c.Request.Method,
 		targetURL,
 		bytes.NewReader(bodyBytes),
@@ -72,6 +228,9 @@ func (h *UserHandler) ProxyToUserService(c *gin.Context) {
 			strings.ToLower(key) == "upgrade" {
 			continue
 		}
+		if !h.forwardHeader(key) {
+			continue
+		}
 		for _, value := range values {
 			proxyReq.Header.Add(key, value)
 		}
@@ -82,9 +241,33 @@ func (h *UserHandler) ProxyToUserService(c *gin.Context) {
 	proxyReq.Header.Set("X-Forwarded-Proto", c.Request.Proto)
 	proxyReq.Header.Set("X-Forwarded-Host", c.Request.Host)
 
+	// Fail fast while the User Service is known to be down
+	if err := h.breaker.Allow(); err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(h.breaker.RetryAfter().Seconds()))))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "User service is temporarily unavailable",
+			"error":   err.Error(),
+		})
+		return
+	}
+
 	// Make the request
 	resp, err := h.httpClient.Do(proxyReq)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		h.breaker.Failure()
+	} else {
+		h.breaker.Success()
+	}
 	if err != nil {
+		if timeoutErr := phases.timeoutError(ctx, err, proxyReq.URL.Scheme == "https"); timeoutErr != nil {
+			c.JSON(http.StatusGatewayTimeout, gin.H{
+				"success": false,
+				"message": "User service timed out",
+				"error":   timeoutErr.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusBadGateway, gin.H{
 			"success": false,
 			"message": "Failed to reach user service",
@@ -94,15 +277,16 @@ func (h *UserHandler) ProxyToUserService(c *gin.Context) {
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Writer.Header().Add(key, value)
-		}
+	// Read one byte past the cap to tell a body at the limit from a bigger one
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, h.maxResponseBytes+1))
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"success": false,
+			"message": "User service timed out",
+			"error":   errProxyTimeout.Error(),
+		})
+		return
 	}
-
-	// Copy response status and body
-	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -111,6 +295,80 @@ func (h *UserHandler) ProxyToUserService(c *gin.Context) {
 		})
 		return
 	}
+	if int64(len(respBody)) > h.maxResponseBytes {
+		log.Printf("User service response for %s %s exceeds %d bytes, aborting", c.Request.Method, path, h.maxResponseBytes)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": "User service response too large",
+			"error":   fmt.Sprintf("response exceeds %d bytes", h.maxResponseBytes),
+		})
+		return
+	}
+
+	// Copy response headers once the body is known to be good, so an error
+	// response above doesn't inherit them
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+
+	if cacheVariant != "" {
+		c.Header("X-Cache", "MISS")
+		if resp.StatusCode == http.StatusOK {
+			h.storeCached(c, path, cacheVariant, resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+		}
+	}
+
+	if (c.Request.Method == http.MethodPatch || c.Request.Method == http.MethodPost) &&
+		resp.StatusCode >= 200 && resp.StatusCode < 300 && c.FullPath() == "/api/v1/users/preference/:id" {
+		// Profiles embed the preference, so both views are stale now
+		id := c.Param("id")
+		if err := h.redis.InvalidateCachedResponses(c.Request.Context(),
+			"/api/v1/users/preference/"+id, "/api/v1/users/profile/"+id); err != nil {
+			log.Printf("Failed to invalidate proxy cache for user %s: %v", id, err)
+		}
+		if err := h.redis.InvalidateCachedPreference(c.Request.Context(), id); err != nil {
+			log.Printf("Failed to invalidate cached preferences for user %s: %v", id, err)
+		}
+	}
 
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
 }
+
+func (h *UserHandler) serveCached(c *gin.Context, path, variant string) bool {
+	raw, err := h.redis.GetCachedResponse(c.Request.Context(), path, variant)
+	if err != nil || raw == "" {
+		return false
+	}
+
+	var cached cachedResponse
+	if err := json.Unmarshal([]byte(raw), &cached); err != nil {
+		return false
+	}
+
+	c.Header("X-Cache", "HIT")
+	c.Data(cached.StatusCode, cached.ContentType, cached.Body)
+	return true
+}
+
+func (h *UserHandler) storeCached(c *gin.Context, path, variant string, statusCode int, contentType string, body []byte) {
+	payload, err := json.Marshal(cachedResponse{
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Body:        body,
+	})
+	if err != nil {
+		return
+	}
+	if err := h.redis.SetCachedResponse(c.Request.Context(), path, variant, payload, h.cacheTTL); err != nil {
+		log.Printf("Failed to cache proxy response for %s: %v", path, err)
+	}
+}
+
+// responseCacheVariant identifies a cached response within its path by a
+// hash of the caller's credentials and the raw query.
+func responseCacheVariant(c *gin.Context) string {
+	sum := sha256.Sum256([]byte(c.GetHeader("Authorization") + "\n" + c.Request.URL.RawQuery))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
+)
+
+func TestProxyResponseCache(t *testing.T) {
+	type request struct {
+		query, token string
+		wantCache    string
+	}
+	tests := []struct {
+		name         string
+		authenticate bool
+		requests     []request
+		wantUpstream int32
+	}{
+		{
+			name:         "same caller and query hits",
+			authenticate: true,
+			requests:     []request{{query: "fields=name", token: "a", wantCache: "MISS"}, {query: "fields=name", token: "a", wantCache: "HIT"}},
+			wantUpstream: 1,
+		},
+		{
+			name:         "query is part of the key",
+			authenticate: true,
+			requests:     []request{{query: "fields=name", token: "a", wantCache: "MISS"}, {query: "fields=email", token: "a", wantCache: "MISS"}},
+			wantUpstream: 2,
+		},
+		{
+			name:         "caller is part of the key",
+			authenticate: true,
+			requests:     []request{{token: "a", wantCache: "MISS"}, {token: "b", wantCache: "MISS"}},
+			wantUpstream: 2,
+		},
+		{
+			name:         "unauthenticated requests bypass the cache",
+			requests:     []request{{token: "a"}, {token: "a"}},
+			wantUpstream: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstream atomic.Int32
+			userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"query":"` + r.URL.RawQuery + `"}`))
+			}))
+			defer userService.Close()
+
+			mr := miniredis.RunT(t)
+			redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := NewUserHandler(userService.URL, redisClient, config.ProxyConfig{
+				CacheTTLSeconds:  60,
+				TimeoutSeconds:   5,
+				MaxResponseBytes: 1 << 20,
+			}, client.NewCircuitBreaker("users", 5, 0))
+
+			router := gin.New()
+			router.GET("/api/v1/users/profile/:id", func(c *gin.Context) {
+				// Stands in for the auth middleware on the cached routes
+				if tt.authenticate {
+					c.Set("user_id", c.GetHeader("Authorization"))
+				}
+			}, h.ProxyToUserService)
+
+			for i, req := range tt.requests {
+				target := "/api/v1/users/profile/u1"
+				if req.query != "" {
+					target += "?" + req.query
+				}
+				r := httptest.NewRequest(http.MethodGet, target, nil)
+				r.Header.Set("Authorization", "Bearer "+req.token)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("request %d: status = %d, want 200: %s", i, w.Code, w.Body)
+				}
+				if got := w.Header().Get("X-Cache"); got != req.wantCache {
+					t.Errorf("request %d: X-Cache = %q, want %q", i, got, req.wantCache)
+				}
+				if want := `{"query":"` + req.query + `"}`; w.Body.String() != want {
+					t.Errorf("request %d: body = %s, want %s", i, w.Body, want)
+				}
+			}
+			if got := upstream.Load(); got != tt.wantUpstream {
+				t.Errorf("user service called %d times, want %d", got, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestProxySharesCircuitBreaker(t *testing.T) {
+	var upstream atomic.Int32
+	userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer userService.Close()
+
+	breaker := client.NewCircuitBreaker(t.Name(), 2, time.Minute)
+	h := NewUserHandler(userService.URL, nil, config.ProxyConfig{TimeoutSeconds: 5, MaxResponseBytes: 1 << 20}, breaker)
+	router := gin.New()
+	router.GET("/api/v1/users/profile/:id", h.ProxyToUserService)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users/profile/u1", nil))
+		return w
+	}
+
+	for i := range 2 {
+		if w := get(); w.Code != http.StatusInternalServerError {
+			t.Fatalf("request %d: status = %d, want the upstream 500", i, w.Code)
+		}
+	}
+	w := get()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status once open = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if got := upstream.Load(); got != 2 {
+		t.Errorf("user service called %d times, want 2", got)
+	}
+
+	// The client shares the breaker, so it fails fast too
+	users := client.NewUserServiceClient(userService.URL, breaker)
+	if _, err := users.GetUserProfile(context.Background(), "u1", ""); !errors.Is(err, client.ErrCircuitOpen) {
+		t.Errorf("client error = %v, want ErrCircuitOpen", err)
+	}
+}
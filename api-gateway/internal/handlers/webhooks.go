@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/middleware"
+	"github.com/tobey0x/api-gateway/internal/models"
+	"github.com/tobey0x/api-gateway/internal/netutil"
+	"github.com/tobey0x/api-gateway/internal/webhooks"
+)
+
+// WebhookHandler manages lifecycle webhook subscriptions. Users subscribe
+// to their own notifications; admins may subscribe to everyone's.
+type WebhookHandler struct {
+	redis            *cache.RedisClient
+	maxSubscriptions int
+}
+
+func NewWebhookHandler(redis *cache.RedisClient, maxSubscriptions int) *WebhookHandler {
+	return &WebhookHandler{
+		redis:            redis,
+		maxSubscriptions: maxSubscriptions,
+	}
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=queued sent failed expired"`
+	// AllUsers subscribes to every user's notifications; admin only
+	AllUsers bool `json:"all_users"`
+}
+
+// CreateWebhook handles POST /api/v1/webhooks
+//
+// The response includes the signing secret, which is never shown again.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req createWebhookRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("Webhook URL must be http or https"))
+		return
+	}
+	if internalHost(u.Hostname()) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("Webhook URL must not point at a private or loopback address"))
+		return
+	}
+
+	owner, ok := h.owner(c, req.AllUsers)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	count, err := h.redis.CountWebhookSubscriptions(ctx, owner)
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to load webhooks", err))
+		return
+	}
+	if count >= int64(h.maxSubscriptions) {
+		c.JSON(http.StatusConflict, models.ErrorResponseSimple(fmt.Sprintf("At most %d webhooks are allowed", h.maxSubscriptions)))
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to generate webhook secret", err))
+		return
+	}
+	events := slices.Clone(req.Events)
+	slices.Sort(events)
+	sub := webhooks.Subscription{
+		ID:        uuid.New().String(),
+		Owner:     owner,
+		URL:       req.URL,
+		Events:    slices.Compact(events),
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}
+
+	entry, _ := json.Marshal(sub)
+	if err := h.redis.SaveWebhookSubscription(ctx, owner, sub.ID, string(entry)); err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to save webhook", err))
+		return
+	}
+
+	c.Header("Location", "/api/v1/webhooks/"+sub.ID)
+	c.JSON(http.StatusCreated, models.SuccessResponse("Webhook created", sub))
+}
+
+// ListWebhooks handles GET /api/v1/webhooks
+//
+// ?all_users=true lists the admin subscriptions instead of the caller's.
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	owner, ok := h.owner(c, c.Query("all_users") == "true")
+	if !ok {
+		return
+	}
+
+	raw, err := h.redis.ListWebhookSubscriptions(c.Request.Context(), owner)
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to load webhooks", err))
+		return
+	}
+
+	subs := make([]webhooks.Subscription, 0, len(raw))
+	for _, r := range raw {
+		var sub webhooks.Subscription
+		if json.Unmarshal([]byte(r), &sub) != nil {
+			continue
+		}
+		sub.Secret = ""
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b webhooks.Subscription) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse("Webhooks retrieved", subs))
+}
+
+// DeleteWebhook handles DELETE /api/v1/webhooks/:id
+//
+// Deliveries still pending for the subscription are dropped.
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	owner, ok := h.owner(c, c.Query("all_users") == "true")
+	if !ok {
+		return
+	}
+
+	deleted, err := h.redis.DeleteWebhookSubscription(c.Request.Context(), owner, c.Param("id"))
+	if err != nil {
+		c.JSON(storeErrorStatus(err), models.ErrorResponse("Failed to delete webhook", err))
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Webhook not found"))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse("Webhook deleted", gin.H{"id": c.Param("id")}))
+}
+
+// owner resolves whose subscriptions the request manages, writing the
+// error response when it can't.
+func (h *WebhookHandler) owner(c *gin.Context, allUsers bool) (string, bool) {
+	if allUsers {
+		if !middleware.IsAdmin(c) {
+			c.JSON(http.StatusForbidden, models.ErrorResponseSimple("Insufficient permissions"))
+			return "", false
+		}
+		return webhooks.AllUsers, true
+	}
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Access denied"))
+		return "", false
+	}
+	return userID, true
+}
+
+// internalHost reports whether a webhook host is a literal non-public
+// address or localhost. Names that resolve to internal addresses are
+// refused by the emitter when it dials.
+func internalHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && !netutil.PublicAddress(addr)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/cache"
+)
+
+func TestCreateWebhookURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{name: "public host", url: "https://example.com/hooks", want: http.StatusCreated},
+		{name: "public address", url: "https://93.184.216.34/hooks", want: http.StatusCreated},
+		{name: "not http", url: "ftp://example.com/hooks", want: http.StatusBadRequest},
+		{name: "localhost", url: "http://localhost:8080/hooks", want: http.StatusBadRequest},
+		{name: "localhost subdomain", url: "http://api.localhost/hooks", want: http.StatusBadRequest},
+		{name: "loopback", url: "http://127.0.0.1/hooks", want: http.StatusBadRequest},
+		{name: "ipv6 loopback", url: "http://[::1]/hooks", want: http.StatusBadRequest},
+		{name: "private", url: "http://10.0.0.5/hooks", want: http.StatusBadRequest},
+		{name: "link-local metadata", url: "http://169.254.169.254/latest/meta-data", want: http.StatusBadRequest},
+		{name: "unspecified", url: "http://0.0.0.0/hooks", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := NewWebhookHandler(redisClient, 5)
+
+			router := gin.New()
+			router.POST("/webhooks", func(c *gin.Context) {
+				// Stands in for the auth middleware
+				c.Set("user_id", "user-1")
+			}, h.CreateWebhook)
+
+			body := `{"url":"` + tt.url + `","events":["sent"]}`
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
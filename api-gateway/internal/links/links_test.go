@@ -0,0 +1,74 @@
+package links
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := NewSigner("secret", time.Hour)
+	signed, err := signer.SignAt("https://example.com/n/1?utm=mail", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		link    string
+		at      time.Time
+		signer  *Signer
+		wantErr error
+	}{
+		{name: "valid", link: signed, at: now, signer: signer},
+		{name: "valid until expiry", link: signed, at: now.Add(time.Hour), signer: signer},
+		{name: "expired", link: signed, at: now.Add(time.Hour + time.Second), signer: signer, wantErr: ErrExpired},
+		{name: "other secret", link: signed, at: now, signer: NewSigner("other", time.Hour), wantErr: ErrInvalidSignature},
+		{name: "path changed", link: strings.Replace(signed, "/n/1", "/n/2", 1), at: now, signer: signer, wantErr: ErrInvalidSignature},
+		{name: "query changed", link: strings.Replace(signed, "utm=mail", "utm=sms", 1), at: now, signer: signer, wantErr: ErrInvalidSignature},
+		{name: "expiry extended", link: withParam(t, signed, ExpiresParam, "9999999999"), at: now, signer: signer, wantErr: ErrInvalidSignature},
+		{name: "unsigned", link: "https://example.com/n/1", at: now, signer: signer, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.signer.Verify(tt.link, tt.at); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignPath(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := NewSigner("secret", time.Minute)
+
+	signed := signer.SignPath("/api/v1/shared/notifications/n1", url.Values{"lang": {"fr"}}, now)
+	if !strings.HasPrefix(signed, "/api/v1/shared/notifications/n1?") {
+		t.Fatalf("SignPath = %q, want a relative link", signed)
+	}
+	if err := signer.Verify(signed, now); err != nil {
+		t.Errorf("Verify(SignPath) = %v", err)
+	}
+}
+
+func TestSignAtRejectsRelativeLinks(t *testing.T) {
+	if _, err := NewSigner("secret", time.Minute).SignAt("/n/1", time.Now()); err == nil {
+		t.Error("SignAt accepted a relative link")
+	}
+}
+
+func withParam(t *testing.T, link, key, value string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
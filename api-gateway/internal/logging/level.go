@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// level is shared by every logger, so changing it takes effect at once
+var level slog.LevelVar
+
+// Setup routes slog and the standard log package through one handler
+// filtered by a runtime-adjustable level. log.Printf output is logged at
+// info, so a warn level also quiets it.
+func Setup(initial string) error {
+	if err := SetLevel(initial); err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &level})))
+	return nil
+}
+
+// Level returns the active level name: debug, info, warn or error
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// SetLevel changes the active level by name
+func SetLevel(name string) error {
+	parsed, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(parsed)
+	return nil
+}
+
+// ParseLevel accepts debug, info, warn or error, case-insensitively
+func ParseLevel(name string) (slog.Level, error) {
+	var parsed slog.Level
+	switch strings.ToLower(name) {
+	case "debug", "info", "warn", "error":
+		if err := parsed.UnmarshalText([]byte(name)); err != nil {
+			return 0, err
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+	}
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    slog.Level
+		wantErr bool
+	}{
+		{name: "debug", want: slog.LevelDebug},
+		{name: "info", want: slog.LevelInfo},
+		{name: "warn", want: slog.LevelWarn},
+		{name: "error", want: slog.LevelError},
+		{name: "DEBUG", want: slog.LevelDebug},
+		{name: "Warn", want: slog.LevelWarn},
+		{name: "", wantErr: true},
+		{name: "warning", wantErr: true},
+		{name: "trace", wantErr: true},
+		{name: "info+2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLevelAtRuntime(t *testing.T) {
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	if err := Setup("info"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	logger := slog.Default()
+	if Level() != "info" || logger.Enabled(ctx, slog.LevelDebug) || !logger.Enabled(ctx, slog.LevelInfo) {
+		t.Fatalf("after Setup(info): level %s", Level())
+	}
+
+	steps := []struct {
+		name      string
+		wantLevel string
+		enabled   slog.Level
+		disabled  slog.Level
+	}{
+		{name: "DEBUG", wantLevel: "debug", enabled: slog.LevelDebug},
+		{name: "warn", wantLevel: "warn", enabled: slog.LevelWarn, disabled: slog.LevelInfo},
+		{name: "error", wantLevel: "error", enabled: slog.LevelError, disabled: slog.LevelWarn},
+	}
+	for _, step := range steps {
+		if err := SetLevel(step.name); err != nil {
+			t.Fatal(err)
+		}
+		if Level() != step.wantLevel {
+			t.Errorf("SetLevel(%q): Level() = %q, want %q", step.name, Level(), step.wantLevel)
+		}
+		// The logger installed by Setup follows without being replaced
+		if !logger.Enabled(ctx, step.enabled) {
+			t.Errorf("SetLevel(%q): %v not enabled", step.name, step.enabled)
+		}
+		if step.disabled != 0 && logger.Enabled(ctx, step.disabled) {
+			t.Errorf("SetLevel(%q): %v still enabled", step.name, step.disabled)
+		}
+	}
+
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("SetLevel accepted an unknown level")
+	}
+	if Level() != "error" {
+		t.Errorf("failed SetLevel changed the level to %q", Level())
+	}
+	if err := Setup("loud"); err == nil {
+		t.Error("Setup accepted an unknown level")
+	}
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// CircuitBreakerState reports 0 (closed), 1 (half-open) or 2 (open).
+var CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gateway_circuit_breaker_state",
+	Help: "Current circuit breaker state (0=closed, 1=half-open, 2=open).",
+}, []string{"breaker"})
+
+var CircuitBreakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_circuit_breaker_transitions_total",
+	Help: "Circuit breaker state transitions.",
+}, []string{"breaker", "from", "to"})
+
+// StatusWriteFailures counts notification status records that could not be
+// written, leaving the notification untrackable.
+var StatusWriteFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_status_write_failures_total",
+	Help: "Failed notification status writes to Redis.",
+}, []string{"stage"})
+
+var AnalyticsExportFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "gateway_analytics_export_failures_total",
+	Help: "Analytics events that could not be exported to Kafka.",
+})
+
+var RejectedConnections = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "gateway_rejected_connections_total",
+	Help: "Connections closed for exceeding the per-IP connection limit.",
+})
+
+var IdempotencyCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "gateway_idempotency_cache_size",
+	Help: "Idempotency keys tracked in Redis, as of the last bounded write.",
+})
+
+var IdempotencyEvictions = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "gateway_idempotency_evictions_total",
+	Help: "Idempotency keys evicted to stay under the configured cap.",
+})
+
+// WebhookDeliveries counts webhook delivery attempts by result: delivered,
+// retry or dead (attempts exhausted).
+var WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_webhook_deliveries_total",
+	Help: "Lifecycle webhook delivery attempts.",
+}, []string{"result"})
+
+// ChannelThrottled counts creates over a channel's global rate limit, by
+// the action taken.
+var ChannelThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_channel_throttled_total",
+	Help: "Notifications over their channel's global rate limit.",
+}, []string{"channel", "action"})
+
+// DeliveryLatency measures enqueue (or the scheduled time) to the sent
+// status update, by the channel that delivered.
+var DeliveryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gateway_delivery_latency_seconds",
+	Help:    "Time from enqueue to delivery, from status updates.",
+	Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600},
+}, []string{"channel"})
+
+// RetryAlerts counts notifications whose retries reached the alert
+// threshold, by template. Templates come from clients, so the label goes
+// through RetryAlertTemplates.
+var RetryAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_retry_alerts_total",
+	Help: "Notifications that failed again after reaching the retry alert threshold.",
+}, []string{"template"})
+
+// RetryAlertTemplates bounds the template label of RetryAlerts
+var RetryAlertTemplates = NewLabelSet(100)
+
+// OtherLabel stands in for label values past a LabelSet's cap
+const OtherLabel = "other"
+
+// LabelSet caps the distinct values a client-supplied label can take, so
+// clients can't create series without bound. The first max values are kept
+// and the rest are reported as OtherLabel.
+type LabelSet struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+func NewLabelSet(max int) *LabelSet {
+	return &LabelSet{max: max, seen: make(map[string]struct{})}
+}
+
+// Label returns value if it is already tracked or there is room for it,
+// and OtherLabel otherwise.
+func (s *LabelSet) Label(value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[value]; ok {
+		return value
+	}
+	if len(s.seen) >= s.max {
+		return OtherLabel
+	}
+	s.seen[value] = struct{}{}
+	return value
+}
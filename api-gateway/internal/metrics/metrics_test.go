@@ -0,0 +1,23 @@
+package metrics
+
+import "testing"
+
+func TestLabelSet(t *testing.T) {
+	s := NewLabelSet(2)
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"welcome", "welcome"},
+		{"reset", "reset"},
+		{"promo-123", OtherLabel},
+		{"welcome", "welcome"},
+		{"promo-456", OtherLabel},
+	}
+	// Steps run in order, each against the previous one's state
+	for _, tt := range tests {
+		if got := s.Label(tt.value); got != tt.want {
+			t.Errorf("Label(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
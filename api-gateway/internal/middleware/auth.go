@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -9,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
 	"github.com/tobey0x/api-gateway/internal/models"
 )
 
@@ -16,13 +19,22 @@ type AuthMiddleware struct {
 	jwtSecret     string
 	accessSecret  string  // User Service access token secret
 	userService   *client.UserServiceClient
+	// requiredClaims must be present (and true, if boolean) in every token
+	requiredClaims []string
+	claimNames     config.ClaimNames
+	// validationFallback lets RequireAuthWithValidation verify tokens
+	// locally while the User Service is unavailable
+	validationFallback bool
 }
 
-func NewAuthMiddleware(jwtSecret string, accessSecret string, userServiceURL string) *AuthMiddleware {
+func NewAuthMiddleware(jwtSecret string, accessSecret string, userService *client.UserServiceClient, requiredClaims []string, claimNames config.ClaimNames, validationFallback bool) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtSecret:    jwtSecret,
-		accessSecret: accessSecret,
-		userService:  client.NewUserServiceClient(userServiceURL),
+		jwtSecret:          jwtSecret,
+		accessSecret:       accessSecret,
+		userService:        userService,
+		requiredClaims:     requiredClaims,
+		claimNames:         claimNames,
+		validationFallback: validationFallback,
 	}
 }
 
@@ -32,6 +44,44 @@ type Claims struct {
 	Email string `json:"email"`
 	Role  string `json:"role"`  // User Service uses singular 'role'
 	jwt.RegisteredClaims
+	// Extra holds every claim in the token, including the ones above
+	Extra map[string]interface{} `json:"-"`
+}
+
+// resolveClaims decodes the verified token's payload as a generic map into
+// claims.Extra and fills ID, Email and Role from the configured claim names,
+// keeping the User Service names when those claims are absent.
+func (m *AuthMiddleware) resolveClaims(tokenString string, claims *Claims) {
+	extra := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, extra); err != nil {
+		return
+	}
+	claims.Extra = extra
+
+	if v, ok := extra[m.claimNames.UserID].(string); ok && v != "" {
+		claims.ID = v
+	}
+	if v, ok := extra[m.claimNames.Email].(string); ok && v != "" {
+		claims.Email = v
+	}
+	if v, ok := extra[m.claimNames.Role].(string); ok && v != "" {
+		claims.Role = v
+	}
+}
+
+// missingClaim returns the first required claim that is absent, null or
+// false in the token, or "" when all are satisfied.
+func (m *AuthMiddleware) missingClaim(claims *Claims) string {
+	for _, name := range m.requiredClaims {
+		value, ok := claims.Extra[name]
+		if !ok || value == nil {
+			return name
+		}
+		if b, isBool := value.(bool); isBool && !b {
+			return name
+		}
+	}
+	return ""
 }
 
 // RequireAuth validates JWT token and adds user context
@@ -52,47 +102,63 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-
-		// Parse and validate token using User Service ACCESS_SECRET
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			// Use ACCESS_SECRET for User Service tokens
-			return []byte(m.accessSecret), nil
-		})
-
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Invalid or expired token"))
-			c.Abort()
-			return
+		if m.authenticate(c, parts[1]) {
+			c.Next()
 		}
+	}
+}
 
-		claims, ok := token.Claims.(*Claims)
-		if !ok || !token.Valid {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Invalid token claims"))
-			c.Abort()
-			return
+// authenticate verifies tokenString locally against the access secret and
+// adds the user to the context. On failure it writes the error response,
+// aborts, and returns false.
+func (m *AuthMiddleware) authenticate(c *gin.Context, tokenString string) bool {
+	// Parse and validate token using User Service ACCESS_SECRET
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
+		// Use ACCESS_SECRET for User Service tokens
+		return []byte(m.accessSecret), nil
+	})
 
-		// Check token expiration
-		if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Token has expired"))
-			c.Abort()
-			return
-		}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Invalid or expired token"))
+		c.Abort()
+		return false
+	}
 
-		// Add user info to context (User Service format)
-		c.Set("user_id", claims.ID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
-		// For compatibility, also set as array
-		c.Set("user_roles", []string{claims.Role})
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Invalid token claims"))
+		c.Abort()
+		return false
+	}
 
-		c.Next()
+	// Check token expiration
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Token has expired"))
+		c.Abort()
+		return false
 	}
+
+	// The signature was verified above, so the payload can be decoded
+	// again as a generic map
+	m.resolveClaims(tokenString, claims)
+	if name := m.missingClaim(claims); name != "" {
+		c.JSON(http.StatusForbidden, models.ErrorResponseSimple("Token is missing required claim: "+name))
+		c.Abort()
+		return false
+	}
+
+	// Add user info to context (User Service format)
+	c.Set("user_id", claims.ID)
+	c.Set("user_email", claims.Email)
+	c.Set("user_role", claims.Role)
+	// For compatibility, also set as array
+	c.Set("user_roles", []string{claims.Role})
+	c.Set("user_claims", claims.Extra)
+	return true
 }
 
 // OptionalAuth extracts user info if token present, but doesn't require it
@@ -120,10 +186,12 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 
 		if err == nil {
 			if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+				m.resolveClaims(tokenString, claims)
 				c.Set("user_id", claims.ID)
 				c.Set("user_email", claims.Email)
 				c.Set("user_role", claims.Role)
 				c.Set("user_roles", []string{claims.Role})
+				c.Set("user_claims", claims.Extra)
 			}
 		}
 
@@ -152,6 +220,13 @@ func (m *AuthMiddleware) RequireAuthWithValidation() gin.HandlerFunc {
 
 		// Validate token with User Service
 		profile, err := m.userService.ValidateToken(c.Request.Context(), tokenString)
+		if err != nil && m.validationFallback && errors.Is(err, client.ErrUnavailable) {
+			log.Printf("User Service unavailable, validating token locally (degraded): %v", err)
+			if m.authenticate(c, tokenString) {
+				c.Next()
+			}
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple(fmt.Sprintf("Invalid token: %v", err)))
 			c.Abort()
@@ -214,3 +289,18 @@ func GetUserID(c *gin.Context) (string, bool) {
 	id, ok := userID.(string)
 	return id, ok
 }
+
+// APIKeyContextKey is where authentication stores an API key once it has
+// validated it
+const APIKeyContextKey = "api_key"
+
+// GetAPIKey returns the validated API key from context
+func GetAPIKey(c *gin.Context) (string, bool) {
+	key := strings.TrimSpace(c.GetString(APIKeyContextKey))
+	return key, key != ""
+}
+
+// IsAdmin reports whether the authenticated user has the admin role
+func IsAdmin(c *gin.Context) bool {
+	return c.GetString("user_role") == "admin"
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tobey0x/api-gateway/internal/client"
+	"github.com/tobey0x/api-gateway/internal/config"
+)
+
+const testAccessSecret = "access-secret"
+
+var defaultClaimNames = config.ClaimNames{UserID: "id", Email: "email", Role: "role"}
+
+// signToken signs claims with testAccessSecret, adding an expiry an hour out
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testAccessSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serveAuth runs handler in front of a route that reports the user it saw
+func serveAuth(t *testing.T, handler gin.HandlerFunc, token string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	var userID string
+	router := gin.New()
+	router.GET("/", handler, func(c *gin.Context) {
+		userID, _ = GetUserID(c)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w, userID
+}
+
+func TestRequireAuthRequiredClaims(t *testing.T) {
+	tests := []struct {
+		name       string
+		required   []string
+		claims     jwt.MapClaims
+		wantStatus int
+	}{
+		{name: "none required", claims: jwt.MapClaims{"id": "user-1"}, wantStatus: http.StatusOK},
+		{name: "present", required: []string{"tenant_id", "email_verified"}, claims: jwt.MapClaims{"id": "user-1", "tenant_id": "acme", "email_verified": true}, wantStatus: http.StatusOK},
+		{name: "missing", required: []string{"tenant_id"}, claims: jwt.MapClaims{"id": "user-1"}, wantStatus: http.StatusForbidden},
+		{name: "null", required: []string{"tenant_id"}, claims: jwt.MapClaims{"id": "user-1", "tenant_id": nil}, wantStatus: http.StatusForbidden},
+		{name: "false boolean", required: []string{"email_verified"}, claims: jwt.MapClaims{"id": "user-1", "email_verified": false}, wantStatus: http.StatusForbidden},
+		{name: "one of several missing", required: []string{"tenant_id", "email_verified"}, claims: jwt.MapClaims{"id": "user-1", "email_verified": true}, wantStatus: http.StatusForbidden},
+		{name: "expired before claims are checked", required: []string{"tenant_id"}, claims: jwt.MapClaims{"id": "user-1", "exp": time.Now().Add(-time.Minute).Unix()}, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewAuthMiddleware("", testAccessSecret, nil, tt.required, defaultClaimNames, false)
+			w, userID := serveAuth(t, m.RequireAuth(), signToken(t, tt.claims))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK && userID != "user-1" {
+				t.Errorf("user_id = %q, want user-1", userID)
+			}
+		})
+	}
+}
+
+func TestClaimNames(t *testing.T) {
+	custom := config.ClaimNames{UserID: "sub", Email: "mail", Role: "group"}
+
+	tests := []struct {
+		name      string
+		names     config.ClaimNames
+		claims    jwt.MapClaims
+		wantUser  string
+		wantEmail string
+		wantRole  string
+	}{
+		{
+			name:      "default names",
+			names:     defaultClaimNames,
+			claims:    jwt.MapClaims{"id": "user-1", "email": "a@example.com", "role": "admin", "sub": "other"},
+			wantUser:  "user-1",
+			wantEmail: "a@example.com",
+			wantRole:  "admin",
+		},
+		{
+			name:      "custom names",
+			names:     custom,
+			claims:    jwt.MapClaims{"sub": "auth0|42", "mail": "b@example.com", "group": "support", "id": "legacy"},
+			wantUser:  "auth0|42",
+			wantEmail: "b@example.com",
+			wantRole:  "support",
+		},
+		{
+			name:      "absent custom claims keep the User Service names",
+			names:     custom,
+			claims:    jwt.MapClaims{"id": "user-1", "email": "a@example.com", "role": "user"},
+			wantUser:  "user-1",
+			wantEmail: "a@example.com",
+			wantRole:  "user",
+		},
+		{
+			name:     "non-string and empty claims are ignored",
+			names:    custom,
+			claims:   jwt.MapClaims{"id": "user-1", "mail": "", "group": 7, "role": "user"},
+			wantUser: "user-1",
+			wantRole: "user",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, optional := range []bool{false, true} {
+			name := tt.name
+			if optional {
+				name += "/optional"
+			}
+			t.Run(name, func(t *testing.T) {
+				m := NewAuthMiddleware("", testAccessSecret, nil, nil, tt.names, false)
+				handler := m.RequireAuth()
+				if optional {
+					handler = m.OptionalAuth()
+				}
+
+				var user, email, role string
+				router := gin.New()
+				router.GET("/", handler, func(c *gin.Context) {
+					user, email, role = c.GetString("user_id"), c.GetString("user_email"), c.GetString("user_role")
+					c.Status(http.StatusOK)
+				})
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("Authorization", "Bearer "+signToken(t, tt.claims))
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d: %s", w.Code, w.Body)
+				}
+				if user != tt.wantUser || email != tt.wantEmail || role != tt.wantRole {
+					t.Errorf("user %q, email %q, role %q; want %q, %q, %q", user, email, role, tt.wantUser, tt.wantEmail, tt.wantRole)
+				}
+			})
+		}
+	}
+}
+
+func TestRequireAuthWithValidationFallback(t *testing.T) {
+	valid := jwt.MapClaims{"id": "local-user"}
+
+	tests := []struct {
+		name       string
+		upstream   int // 0 means the User Service is unreachable
+		fallback   bool
+		badToken   bool
+		wantStatus int
+		wantUser   string
+	}{
+		{name: "validated upstream", upstream: http.StatusOK, fallback: true, wantStatus: http.StatusOK, wantUser: "remote-user"},
+		{name: "rejected upstream is never retried locally", upstream: http.StatusUnauthorized, fallback: true, wantStatus: http.StatusUnauthorized},
+		{name: "fail closed on 5xx", upstream: http.StatusServiceUnavailable, wantStatus: http.StatusUnauthorized},
+		{name: "fail closed when unreachable", wantStatus: http.StatusUnauthorized},
+		{name: "fail open on 5xx", upstream: http.StatusServiceUnavailable, fallback: true, wantStatus: http.StatusOK, wantUser: "local-user"},
+		{name: "fail open when unreachable", fallback: true, wantStatus: http.StatusOK, wantUser: "local-user"},
+		{name: "fail open still verifies the token", upstream: http.StatusBadGateway, fallback: true, badToken: true, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.upstream)
+				if tt.upstream == http.StatusOK {
+					w.Write([]byte(`{"success":true,"data":{"id":"remote-user","email":"r@example.com","role":"user"}}`))
+				}
+			}))
+			if tt.upstream == 0 {
+				userService.Close()
+			} else {
+				defer userService.Close()
+			}
+
+			users := client.NewUserServiceClient(userService.URL, client.NewCircuitBreaker(t.Name(), 5, time.Minute))
+			m := NewAuthMiddleware("", testAccessSecret, users, nil, defaultClaimNames, tt.fallback)
+			token := signToken(t, valid)
+			if tt.badToken {
+				token += "x"
+			}
+
+			w, userID := serveAuth(t, m.RequireAuthWithValidation(), token)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if userID != tt.wantUser {
+				t.Errorf("user_id = %q, want %q", userID, tt.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecation marks legacy routes with "Deprecation: true" and their
+// Sunset date. Keys are route patterns as registered ("/api/v1/users/:id"),
+// optionally prefixed by a method ("GET /api/v1/users/:id"); a method entry
+// takes precedence over a bare path. The route itself is unaffected.
+func Deprecation(sunsets map[string]time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		sunset, ok := sunsets[c.Request.Method+" "+route]
+		if !ok {
+			sunset, ok = sunsets[route]
+		}
+		if ok && route != "" {
+			c.Header("Deprecation", "true")
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/flags"
+)
+
+// FeatureFlagsHeader carries admin-signed flags enabling in-development
+// behavior for a single request
+const FeatureFlagsHeader = "X-Feature-Flags"
+
+// FeatureFlags verifies X-Feature-Flags and stores the flags in the request
+// context, where handlers check them with flags.Enabled. Unsigned, tampered
+// or expired values are ignored rather than rejected, so the request runs
+// with the default behavior.
+func FeatureFlags(signer *flags.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.GetHeader(FeatureFlagsHeader)
+		if value == "" {
+			c.Next()
+			return
+		}
+
+		names, err := signer.Verify(value, time.Now())
+		if err != nil {
+			slog.Debug("Ignoring feature flags", "error", err, "request_id", c.GetString("request_id"))
+			c.Next()
+			return
+		}
+
+		c.Request = c.Request.WithContext(flags.NewContext(c.Request.Context(), names))
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// DecompressGzip transparently inflates request bodies sent with
+// Content-Encoding: gzip. The inflated size is capped at maxBytes to
+// guard against zip bombs.
+func DecompressGzip(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.EqualFold(strings.TrimSpace(c.GetHeader("Content-Encoding")), "gzip") {
+			c.Next()
+			return
+		}
+
+		zr, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse("Invalid gzip request body", err))
+			return
+		}
+		defer zr.Close()
+
+		body, err := io.ReadAll(io.LimitReader(zr, maxBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse("Invalid gzip request body", err))
+			return
+		}
+		if int64(len(body)) > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge,
+				models.ErrorResponseSimple(fmt.Sprintf("Decompressed request body exceeds %d bytes", maxBytes)))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+		c.Next()
+	}
+}
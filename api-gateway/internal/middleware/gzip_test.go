@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressGzip(t *testing.T) {
+	const payload = `{"type":"email","user_id":"user-1"}`
+	bomb := strings.Repeat("0", 1<<20)
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "plain body untouched", body: []byte(payload), wantStatus: http.StatusOK, wantBody: payload},
+		{name: "gzip inflated", encoding: "gzip", body: gzipped(t, payload), wantStatus: http.StatusOK, wantBody: payload},
+		{name: "encoding is case-insensitive", encoding: " GZIP ", body: gzipped(t, payload), wantStatus: http.StatusOK, wantBody: payload},
+		{name: "at the limit", encoding: "gzip", body: gzipped(t, strings.Repeat("a", 64)), wantStatus: http.StatusOK, wantBody: strings.Repeat("a", 64)},
+		{name: "not gzip", encoding: "gzip", body: []byte(payload), wantStatus: http.StatusBadRequest},
+		{name: "truncated stream", encoding: "gzip", body: gzipped(t, payload)[:20], wantStatus: http.StatusBadRequest},
+		{name: "bomb capped", encoding: "gzip", body: gzipped(t, bomb), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			var gotLength int64
+			var gotEncoding string
+			router := gin.New()
+			router.Use(DecompressGzip(64))
+			router.POST("/", func(c *gin.Context) {
+				data, _ := io.ReadAll(c.Request.Body)
+				gotBody = string(data)
+				gotLength = c.Request.ContentLength
+				gotEncoding = c.GetHeader("Content-Encoding")
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if gotBody != tt.wantBody {
+				t.Errorf("handler read %q, want %q", gotBody, tt.wantBody)
+			}
+			if gotLength != int64(len(tt.wantBody)) {
+				t.Errorf("ContentLength = %d, want %d", gotLength, len(tt.wantBody))
+			}
+			if tt.encoding != "" && gotEncoding != "" {
+				t.Errorf("Content-Encoding %q left on the inflated request", gotEncoding)
+			}
+		})
+	}
+}
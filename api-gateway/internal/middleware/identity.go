@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdentityResolver derives the rate-limit bucket a request is counted in.
+type IdentityResolver interface {
+	Identity(c *gin.Context) string
+}
+
+// Built-in identity resolver names, selected by rate_limit.identity
+const (
+	IdentityUser   = "user"
+	IdentityIP     = "ip"
+	IdentityAPIKey = "api_key"
+	IdentityTenant = "tenant"
+)
+
+// IdentityResolvers lists the built-in resolver names
+var IdentityResolvers = []string{IdentityUser, IdentityIP, IdentityAPIKey, IdentityTenant}
+
+// NewIdentityResolver returns the built-in resolver called name. IP
+// addresses are grouped by the given prefix lengths; tenantClaim names the
+// JWT claim holding the tenant.
+func NewIdentityResolver(name string, ipv4Prefix, ipv6Prefix int, tenantClaim string) (IdentityResolver, error) {
+	ip := IPResolver{IPv4Prefix: ipv4Prefix, IPv6Prefix: ipv6Prefix}
+	switch name {
+	case IdentityUser, "":
+		return UserResolver{Fallback: ip}, nil
+	case IdentityIP:
+		return ip, nil
+	case IdentityAPIKey:
+		return APIKeyResolver{Fallback: ip}, nil
+	case IdentityTenant:
+		return TenantResolver{Claim: tenantClaim, Fallback: UserResolver{Fallback: ip}}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit identity %q", name)
+	}
+}
+
+// UserResolver keys by the authenticated user ID, falling back when the user
+// ID is missing, not a string, or blank.
+type UserResolver struct {
+	Fallback IdentityResolver
+}
+
+func (r UserResolver) Identity(c *gin.Context) string {
+	if userID, ok := GetUserID(c); ok {
+		if userID = strings.TrimSpace(userID); userID != "" {
+			return "user:" + userID
+		}
+	}
+	return r.Fallback.Identity(c)
+}
+
+// IPResolver keys by client IP, masked to a subnet so e.g. a whole IPv6 /64
+// shares one budget. Prefixes of 0 or the full length keep the address.
+type IPResolver struct {
+	IPv4Prefix int
+	IPv6Prefix int
+}
+
+func (r IPResolver) Identity(c *gin.Context) string {
+	addr, err := netip.ParseAddr(c.ClientIP())
+	if err != nil {
+		return "ip:" + c.ClientIP()
+	}
+	addr = addr.Unmap()
+
+	bits := r.IPv6Prefix
+	if addr.Is4() {
+		bits = r.IPv4Prefix
+	}
+	if bits > 0 && bits < addr.BitLen() {
+		if prefix, err := addr.Prefix(bits); err == nil {
+			return "ip:" + prefix.String()
+		}
+	}
+	return "ip:" + addr.String()
+}
+
+// APIKeyResolver keys by a hash of the API key that auth has validated, so
+// keys never appear in Redis. It never reads the raw header: an unchecked
+// key could be changed on every request to get a fresh budget. Requests
+// without a validated key use the fallback.
+type APIKeyResolver struct {
+	Fallback IdentityResolver
+}
+
+func (r APIKeyResolver) Identity(c *gin.Context) string {
+	key, ok := GetAPIKey(c)
+	if !ok {
+		return r.Fallback.Identity(c)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:16])
+}
+
+// TenantResolver keys by tenant and then the fallback's identity (normally
+// the user), taking the tenant from a verified JWT claim. Requests without
+// the claim use the fallback alone.
+type TenantResolver struct {
+	Claim    string
+	Fallback IdentityResolver
+}
+
+func (r TenantResolver) Identity(c *gin.Context) string {
+	identity := r.Fallback.Identity(c)
+	if tenant := GetTenant(c, r.Claim); tenant != "" {
+		return "tenant:" + tenant + ":" + identity
+	}
+	return identity
+}
+
+// GetTenant returns the tenant named by claim in the verified JWT, or ""
+// when the request has none.
+func GetTenant(c *gin.Context, claim string) string {
+	claims, _ := c.Get("user_claims")
+	extra, _ := claims.(map[string]interface{})
+	tenant, _ := extra[claim].(string)
+	return strings.TrimSpace(tenant)
+}
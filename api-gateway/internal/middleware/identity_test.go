@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdentityResolvers(t *testing.T) {
+	keySum := sha256.Sum256([]byte("key-1"))
+	keyIdentity := "key:" + hex.EncodeToString(keySum[:16])
+
+	tests := []struct {
+		name       string
+		resolver   string
+		ipv4Prefix int
+		ipv6Prefix int
+		remoteAddr string
+		header     string
+		context    map[string]any
+		want       string
+	}{
+		{name: "user", resolver: IdentityUser, context: map[string]any{"user_id": "user-1"}, want: "user:user-1"},
+		{name: "default is user", context: map[string]any{"user_id": "user-1"}, want: "user:user-1"},
+		{name: "user falls back to ip", resolver: IdentityUser, want: "ip:192.0.2.10"},
+		{name: "blank user falls back to ip", resolver: IdentityUser, context: map[string]any{"user_id": " "}, want: "ip:192.0.2.10"},
+		{name: "non-string user falls back to ip", resolver: IdentityUser, context: map[string]any{"user_id": 42}, want: "ip:192.0.2.10"},
+		{name: "ip", resolver: IdentityIP, context: map[string]any{"user_id": "user-1"}, want: "ip:192.0.2.10"},
+		{name: "ipv4 subnet", resolver: IdentityIP, ipv4Prefix: 24, want: "ip:192.0.2.0/24"},
+		{name: "ipv6 subnet", resolver: IdentityIP, ipv6Prefix: 64, remoteAddr: "[2001:db8:1:2:3:4:5:6]:1234", want: "ip:2001:db8:1:2::/64"},
+		{name: "ipv6 full length", resolver: IdentityIP, ipv6Prefix: 128, remoteAddr: "[2001:db8::1]:1234", want: "ip:2001:db8::1"},
+		{name: "validated api key", resolver: IdentityAPIKey, context: map[string]any{APIKeyContextKey: "key-1"}, want: keyIdentity},
+		{name: "validated key ignores header", resolver: IdentityAPIKey, header: "key-2", context: map[string]any{APIKeyContextKey: "key-1"}, want: keyIdentity},
+		{name: "unvalidated header falls back to ip", resolver: IdentityAPIKey, header: "key-1", want: "ip:192.0.2.10"},
+		{name: "api key never uses user", resolver: IdentityAPIKey, context: map[string]any{"user_id": "user-1"}, want: "ip:192.0.2.10"},
+		{
+			name:     "tenant",
+			resolver: IdentityTenant,
+			context:  map[string]any{"user_id": "user-1", "user_claims": map[string]interface{}{"tenant_id": "acme"}},
+			want:     "tenant:acme:user:user-1",
+		},
+		{name: "tenant without claim", resolver: IdentityTenant, context: map[string]any{"user_id": "user-1"}, want: "user:user-1"},
+		{name: "tenant without user", resolver: IdentityTenant, context: map[string]any{"user_claims": map[string]interface{}{"tenant_id": "acme"}}, want: "tenant:acme:ip:192.0.2.10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewIdentityResolver(tt.resolver, tt.ipv4Prefix, tt.ipv6Prefix, "tenant_id")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.RemoteAddr = "192.0.2.10:1234"
+			if tt.remoteAddr != "" {
+				c.Request.RemoteAddr = tt.remoteAddr
+			}
+			if tt.header != "" {
+				c.Request.Header.Set("X-API-Key", tt.header)
+			}
+			for k, v := range tt.context {
+				c.Set(k, v)
+			}
+
+			if got := resolver.Identity(c); got != tt.want {
+				t.Errorf("Identity = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewIdentityResolverUnknown(t *testing.T) {
+	if _, err := NewIdentityResolver("subnet", 0, 0, ""); err == nil {
+		t.Error("unknown resolver accepted")
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// LocalizeErrors translates known error messages into the caller's
+// Accept-Language. Error bodies are buffered and rewritten after the
+// handler runs, but only when the message is in the catalog; anything
+// else, including proxied bodies, is written back byte for byte.
+// Successful responses pass through untouched.
+func LocalizeErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+
+		lang := models.SupportedLanguage(c.GetHeader("Accept-Language"))
+		if lang == "" {
+			c.Next()
+			return
+		}
+
+		w := &errorBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.buf.Len() == 0 {
+			return
+		}
+
+		body := w.buf.Bytes()
+		var resp models.Response
+		if err := json.Unmarshal(body, &resp); err == nil && !resp.Success {
+			if translated, ok := resp.Localize(lang); ok {
+				if localized, err := json.Marshal(translated); err == nil {
+					body = localized
+					// A length copied from an upstream response no
+					// longer matches
+					c.Writer.Header().Del("Content-Length")
+					c.Header("Content-Language", lang)
+				}
+			}
+		}
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// errorBodyWriter holds back error bodies so they can be rewritten
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
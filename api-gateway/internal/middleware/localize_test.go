@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestLocalizeErrors(t *testing.T) {
+	proxied := `{"error":"upstream exploded","detail":{"trace":"abc"}}`
+
+	tests := []struct {
+		name              string
+		acceptLanguage    string
+		handler           gin.HandlerFunc
+		wantBody          string
+		wantLanguage      string
+		wantContentLength string
+	}{
+		{
+			name:           "catalog message translated",
+			acceptLanguage: "es",
+			handler: func(c *gin.Context) {
+				c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("Request body is required"))
+			},
+			wantBody:     `{"success":false,"error":"El cuerpo de la solicitud es obligatorio","code":"validation_body_required","message":"El cuerpo de la solicitud es obligatorio"}`,
+			wantLanguage: "es",
+		},
+		{
+			name:           "unknown message untouched",
+			acceptLanguage: "fr",
+			handler: func(c *gin.Context) {
+				c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Notification not found"))
+			},
+			wantBody: `{"success":false,"error":"Notification not found","message":"Notification not found"}`,
+		},
+		{
+			name:           "proxied body keeps bytes and length",
+			acceptLanguage: "de",
+			handler: func(c *gin.Context) {
+				c.Header("Content-Length", strconv.Itoa(len(proxied)))
+				c.Data(http.StatusBadGateway, "application/json", []byte(proxied))
+			},
+			wantBody:          proxied,
+			wantContentLength: strconv.Itoa(len(proxied)),
+		},
+		{
+			name:           "proxied catalog message drops stale length",
+			acceptLanguage: "de",
+			handler: func(c *gin.Context) {
+				body := `{"success":false,"message":"Internal server error"}`
+				c.Header("Content-Length", strconv.Itoa(len(body)))
+				c.Data(http.StatusInternalServerError, "application/json", []byte(body))
+			},
+			wantBody:     `{"success":false,"message":"Interner Serverfehler"}`,
+			wantLanguage: "de",
+		},
+		{
+			name:           "english untouched",
+			acceptLanguage: "en-GB",
+			handler: func(c *gin.Context) {
+				c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("Request body is required"))
+			},
+			wantBody: `{"success":false,"error":"Request body is required","code":"validation_body_required","message":"Request body is required"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(LocalizeErrors())
+			r.GET("/", tt.handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Language"); got != tt.wantLanguage {
+				t.Errorf("Content-Language = %q, want %q", got, tt.wantLanguage)
+			}
+			if got := w.Header().Get("Content-Length"); got != tt.wantContentLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantContentLength)
+			}
+		})
+	}
+}
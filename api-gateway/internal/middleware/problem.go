@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// ProblemContentType is the RFC 7807 media type for error bodies
+const ProblemContentType = "application/problem+json"
+
+// ProblemDetails rewrites error envelopes as RFC 7807 problem details for
+// callers whose Accept header lists application/problem+json. Everyone else
+// keeps the usual envelope. Error bodies that aren't envelopes, such as
+// ones passed through from the User Service, are left alone.
+func ProblemDetails(typeBase string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+
+		if !acceptsProblem(c.GetHeader("Accept")) {
+			c.Next()
+			return
+		}
+
+		w := &errorBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.buf.Len() == 0 {
+			return
+		}
+
+		body := w.buf.Bytes()
+		if resp, ok := errorEnvelope(body); ok {
+			problem := resp.Problem(w.Status(), typeBase, c.Request.URL.Path)
+			if encoded, err := json.Marshal(problem); err == nil {
+				body = encoded
+				// A length copied from an upstream response no longer matches
+				c.Writer.Header().Del("Content-Length")
+				c.Header("Content-Type", ProblemContentType)
+			}
+		}
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// errorEnvelope decodes body as a models.Response error envelope. Bodies
+// without a "success" key, which would otherwise decode as failures, aren't
+// envelopes.
+func errorEnvelope(body []byte) (models.Response, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return models.Response{}, false
+	}
+	if _, ok := fields["success"]; !ok {
+		return models.Response{}, false
+	}
+	var resp models.Response
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Success {
+		return models.Response{}, false
+	}
+	return resp, true
+}
+
+// acceptsProblem reports whether an Accept header lists
+// application/problem+json with a non-zero quality. Wildcards don't count,
+// so clients have to opt in.
+func acceptsProblem(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != ProblemContentType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+func TestProblemDetails(t *testing.T) {
+	proxied := `{"statusCode":404,"message":"User not found"}`
+
+	tests := []struct {
+		name              string
+		accept            string
+		handler           gin.HandlerFunc
+		wantBody          string
+		wantContentType   string
+		wantContentLength string
+	}{
+		{
+			name:   "envelope with code",
+			accept: ProblemContentType,
+			handler: func(c *gin.Context) {
+				c.JSON(http.StatusBadRequest, models.ErrorResponseSimple("Request body is required"))
+			},
+			wantBody:        `{"type":"urn:test:validation_body_required","title":"Request body is required","status":400,"instance":"/","code":"validation_body_required"}`,
+			wantContentType: ProblemContentType,
+		},
+		{
+			name:   "envelope without code",
+			accept: "application/json, " + ProblemContentType + ";q=0.5",
+			handler: func(c *gin.Context) {
+				c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Notification not found"))
+			},
+			wantBody:        `{"type":"about:blank","title":"Not Found","status":404,"detail":"Notification not found","instance":"/"}`,
+			wantContentType: ProblemContentType,
+		},
+		{
+			name:   "proxied object without success key",
+			accept: ProblemContentType,
+			handler: func(c *gin.Context) {
+				c.Header("Content-Length", strconv.Itoa(len(proxied)))
+				c.Data(http.StatusNotFound, "application/json", []byte(proxied))
+			},
+			wantBody:          proxied,
+			wantContentType:   "application/json",
+			wantContentLength: strconv.Itoa(len(proxied)),
+		},
+		{
+			name:   "wildcard keeps envelope",
+			accept: "*/*",
+			handler: func(c *gin.Context) {
+				c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Notification not found"))
+			},
+			wantBody:        `{"success":false,"error":"Notification not found","message":"Notification not found"}`,
+			wantContentType: "application/json; charset=utf-8",
+		},
+		{
+			name:   "opted out with q=0",
+			accept: ProblemContentType + ";q=0",
+			handler: func(c *gin.Context) {
+				c.JSON(http.StatusNotFound, models.ErrorResponseSimple("Notification not found"))
+			},
+			wantBody:        `{"success":false,"error":"Notification not found","message":"Notification not found"}`,
+			wantContentType: "application/json; charset=utf-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(ProblemDetails("urn:test:"))
+			r.GET("/", tt.handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if got := w.Header().Get("Content-Length"); got != tt.wantContentLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantContentLength)
+			}
+		})
+	}
+}
@@ -2,7 +2,11 @@ package middleware
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,33 +15,125 @@ import (
 )
 
 type RateLimiter struct {
-	redis        *cache.RedisClient
-	maxRequests  int64
-	windowPeriod time.Duration
+	redis    *cache.RedisClient
+	limits   atomic.Pointer[rateLimits]
+	identity atomic.Pointer[identityResolver]
+	// standardHeaders adds the IETF RateLimit and RateLimit-Policy headers
+	standardHeaders atomic.Bool
+	// maxRetryAfter caps the advertised Retry-After, in nanoseconds; 0 is
+	// no cap
+	maxRetryAfter atomic.Int64
+	// excludedPaths skip rate limiting entirely; see SetExcludedPaths
+	excludedPaths atomic.Pointer[[]string]
 }
 
-func NewRateLimiter(redis *cache.RedisClient, maxRequests int64, windowPeriod time.Duration) *RateLimiter {
-	return &RateLimiter{
-		redis:        redis,
-		maxRequests:  maxRequests,
-		windowPeriod: windowPeriod,
+// identityResolver boxes the interface for atomic.Pointer
+type identityResolver struct {
+	IdentityResolver
+}
+
+type rateLimits struct {
+	maxRequests     int64
+	maxReadRequests int64
+	windowPeriod    time.Duration
+	// burst > 0 switches from fixed windows to GCRA, allowing this many
+	// requests above the sustained rate at once
+	burst int64
+}
+
+// NewRateLimiter limits writes to maxRequests and reads (safe methods) to
+// maxReadRequests per window, counted separately. With burst > 0 the limits
+// are sustained rates (spread evenly across the window) and up to burst
+// extra requests may arrive at once.
+func NewRateLimiter(redis *cache.RedisClient, maxRequests, maxReadRequests int64, windowPeriod time.Duration, burst int64, identity IdentityResolver) *RateLimiter {
+	rl := &RateLimiter{redis: redis}
+	rl.SetLimits(maxRequests, maxReadRequests, windowPeriod, burst)
+	rl.SetIdentityResolver(identity)
+	return rl
+}
+
+// SetIdentityResolver atomically swaps how requests are assigned to buckets.
+func (rl *RateLimiter) SetIdentityResolver(identity IdentityResolver) {
+	rl.identity.Store(&identityResolver{identity})
+}
+
+// SetStandardHeaders toggles the IETF RateLimit / RateLimit-Policy headers,
+// sent alongside X-RateLimit-*.
+func (rl *RateLimiter) SetStandardHeaders(enabled bool) {
+	rl.standardHeaders.Store(enabled)
+}
+
+// SetMaxRetryAfter caps the Retry-After sent with 429s. Only the header is
+// capped: a client that retries sooner is rejected again. 0 disables it.
+func (rl *RateLimiter) SetMaxRetryAfter(d time.Duration) {
+	rl.maxRetryAfter.Store(int64(d))
+}
+
+// SetExcludedPaths sets the paths RateLimit lets through without counting
+// them. Patterns containing *, ? or [ are globs (path.Match, so * stops at
+// "/"); others match the path and everything below it.
+func (rl *RateLimiter) SetExcludedPaths(patterns []string) {
+	rl.excludedPaths.Store(&patterns)
+}
+
+func (rl *RateLimiter) excluded(requestPath string) bool {
+	patterns := rl.excludedPaths.Load()
+	if patterns == nil {
+		return false
+	}
+	// Clean so "/api/v1/health/../notifications" can't borrow an exclusion
+	requestPath = path.Clean("/" + requestPath)
+	for _, pattern := range *patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			if ok, _ := path.Match(pattern, requestPath); ok {
+				return true
+			}
+			continue
+		}
+		prefix := strings.TrimSuffix(pattern, "/")
+		if requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
 	}
+	return false
+}
+
+// SetLimits atomically swaps the limits used by subsequent requests.
+func (rl *RateLimiter) SetLimits(maxRequests, maxReadRequests int64, windowPeriod time.Duration, burst int64) {
+	rl.limits.Store(&rateLimits{
+		maxRequests:     maxRequests,
+		maxReadRequests: maxReadRequests,
+		windowPeriod:    windowPeriod,
+		burst:           burst,
+	})
 }
 
-// RateLimit middleware enforces rate limiting per user or IP
+// RateLimit middleware enforces rate limiting per user or IP. Reads and
+// writes have independent budgets so status polling can't starve creates.
 func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Try to get user ID from context (if authenticated)
-		identifier, exists := c.Get("user_id")
-		if !exists || identifier == "" {
-			// Fallback to IP address for unauthenticated requests
-			identifier = c.ClientIP()
+		if rl.excluded(c.Request.URL.Path) {
+			c.Next()
+			return
 		}
 
-		key := fmt.Sprintf("%v", identifier)
+		limits := rl.limits.Load()
+		identity := rl.identity.Load().Identity(c)
+		policy := "write"
+		maxRequests := limits.maxRequests
+		if isSafeMethod(c.Request.Method) {
+			policy = "read"
+			maxRequests = limits.maxReadRequests
+		}
+		key := identity + ":" + policy
+
+		if limits.burst > 0 {
+			rl.allowBurst(c, key, policy, limits.windowPeriod/time.Duration(maxRequests), limits.burst)
+			return
+		}
 
 		// Increment request count
-		count, err := rl.redis.IncrementRateLimit(c.Request.Context(), key, rl.windowPeriod)
+		count, err := rl.redis.IncrementRateLimit(c.Request.Context(), key, limits.windowPeriod)
 		if err != nil {
 			// Log error but don't block request on rate limit failure
 			c.Next()
@@ -45,13 +141,11 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 		}
 
 		// Set rate limit headers
-		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", rl.maxRequests))
-		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", max(0, rl.maxRequests-count)))
-		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(rl.windowPeriod).Unix()))
+		rl.setHeaders(c, policy, maxRequests, max(0, maxRequests-count), limits.windowPeriod, limits.windowPeriod)
 
 		// Check if rate limit exceeded
-		if count > rl.maxRequests {
-			c.Header("Retry-After", fmt.Sprintf("%d", int(rl.windowPeriod.Seconds())))
+		if count > maxRequests {
+			c.Header("Retry-After", rl.retryAfter(limits.windowPeriod))
 			c.JSON(http.StatusTooManyRequests, models.ErrorResponseSimple("Rate limit exceeded. Please try again later."))
 			c.Abort()
 			return
@@ -61,6 +155,56 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 	}
 }
 
+// allowBurst applies GCRA: one request per interval sustained, plus burst.
+// Retry-After is the exact wait until the next request is admitted.
+func (rl *RateLimiter) allowBurst(c *gin.Context, key, policy string, interval time.Duration, burst int64) {
+	result, err := rl.redis.AllowGCRA(c.Request.Context(), key, interval, burst)
+	if err != nil {
+		// Log error but don't block request on rate limit failure
+		c.Next()
+		return
+	}
+
+	// An empty bucket refills burst+1 requests in burst+1 intervals
+	rl.setHeaders(c, policy, burst+1, result.Remaining, interval*time.Duration(burst+1), result.ResetAfter)
+
+	if !result.Allowed {
+		c.Header("Retry-After", rl.retryAfter(result.RetryAfter))
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponseSimple("Rate limit exceeded. Please try again later."))
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// retryAfter formats wait as whole seconds, rounded up and capped at
+// maxRetryAfter.
+func (rl *RateLimiter) retryAfter(wait time.Duration) string {
+	if limit := time.Duration(rl.maxRetryAfter.Load()); limit > 0 && wait > limit {
+		wait = limit
+	}
+	return fmt.Sprintf("%d", int64(math.Ceil(wait.Seconds())))
+}
+
+// setHeaders writes X-RateLimit-* (Reset as a Unix time) and, if enabled,
+// the IETF draft's structured fields: RateLimit-Policy with the quota q per
+// window w, and RateLimit with the remaining r and seconds t until reset.
+func (rl *RateLimiter) setHeaders(c *gin.Context, policy string, limit, remaining int64, window, resetAfter time.Duration) {
+	c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
+	c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+	c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(resetAfter).Unix()))
+
+	if rl.standardHeaders.Load() {
+		c.Header("RateLimit-Policy", fmt.Sprintf("%q;q=%d;w=%d", policy, limit, int64(math.Ceil(window.Seconds()))))
+		c.Header("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", policy, remaining, int64(math.Ceil(resetAfter.Seconds()))))
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
 func max(a, b int64) int64 {
 	if a > b {
 		return a
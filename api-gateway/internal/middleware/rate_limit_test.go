@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/cache"
+)
+
+func TestRateLimitBurst(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxRequests    int64
+		window         time.Duration
+		burst          int64
+		wantAllowed    int
+		wantRetryAfter string
+	}{
+		{name: "burst above sustained rate", maxRequests: 60, window: time.Minute, burst: 2, wantAllowed: 3, wantRetryAfter: "1"},
+		{name: "slow sustained rate", maxRequests: 6, window: time.Minute, burst: 4, wantAllowed: 5, wantRetryAfter: "10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			mr.SetTime(time.Now())
+			redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			identity, _ := NewIdentityResolver(IdentityIP, 32, 128, "")
+			rl := NewRateLimiter(redisClient, tt.maxRequests, tt.maxRequests, tt.window, tt.burst, identity)
+
+			router := gin.New()
+			router.Use(rl.RateLimit())
+			router.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			var allowed int
+			var last *httptest.ResponseRecorder
+			for range tt.wantAllowed + 1 {
+				last = httptest.NewRecorder()
+				router.ServeHTTP(last, httptest.NewRequest(http.MethodPost, "/", nil))
+				if last.Code == http.StatusOK {
+					allowed++
+				}
+			}
+
+			if allowed != tt.wantAllowed {
+				t.Errorf("allowed %d, want %d", allowed, tt.wantAllowed)
+			}
+			if last.Code != http.StatusTooManyRequests {
+				t.Fatalf("request past the burst got %d, want 429", last.Code)
+			}
+			if got := last.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestRateLimitBlankUserIDUsesClientIP(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := NewIdentityResolver(IdentityUser, 0, 0, "")
+	rl := NewRateLimiter(redisClient, 1, 1, time.Minute, 0, identity)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID, ok := c.GetQuery("user"); ok {
+			c.Set("user_id", userID)
+		}
+	}, rl.RateLimit())
+	router.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Each step spends one request from a budget of one per identity
+	steps := []struct {
+		name       string
+		query      string
+		remoteAddr string
+		want       int
+	}{
+		{name: "blank user", query: "?user=%20", remoteAddr: "192.0.2.10:1234", want: http.StatusOK},
+		{name: "empty user shares the ip budget", query: "?user=", remoteAddr: "192.0.2.10:1234", want: http.StatusTooManyRequests},
+		{name: "no user shares the ip budget", remoteAddr: "192.0.2.10:5678", want: http.StatusTooManyRequests},
+		{name: "blank user on another ip", query: "?user=%20", remoteAddr: "192.0.2.11:1234", want: http.StatusOK},
+		{name: "user on a limited ip", query: "?user=user-1", remoteAddr: "192.0.2.10:1234", want: http.StatusOK},
+		{name: "padded user shares the user budget", query: "?user=%20user-1%20", remoteAddr: "192.0.2.12:1234", want: http.StatusTooManyRequests},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/"+step.query, nil)
+		req.RemoteAddr = step.remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != step.want {
+			t.Errorf("%s: status = %d, want %d", step.name, w.Code, step.want)
+		}
+	}
+}
+
+func TestRateLimitSetLimits(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := NewIdentityResolver(IdentityIP, 0, 0, "")
+	rl := NewRateLimiter(redisClient, 1, 1, time.Minute, 0, identity)
+
+	router := gin.New()
+	router.Use(rl.RateLimit())
+	router.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		return w
+	}
+
+	post()
+	if w := post(); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request got %d, want 429", w.Code)
+	}
+
+	// A reload applies to the next request without a new limiter
+	rl.SetLimits(3, 3, time.Minute, 0)
+	w := post()
+	if w.Code != http.StatusOK {
+		t.Fatalf("request after raising the limit got %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "3" {
+		t.Errorf("X-RateLimit-Limit = %q, want 3", got)
+	}
+}
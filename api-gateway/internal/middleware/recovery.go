@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// Recovery turns a panicking handler into a 500 with our JSON envelope. The
+// panic and stack are logged with the request ID but never sent to clients.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+
+			log.Printf("[PANIC] request_id=%s %s %s: %v\n%s",
+				GetRequestID(c), c.Request.Method, c.Request.URL.Path, r, debug.Stack())
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponseSimple("Internal server error"))
+		}()
+
+		c.Next()
+	}
+}
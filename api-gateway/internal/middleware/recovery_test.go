@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     gin.HandlerFunc
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:        "panic before writing",
+			handler:     func(c *gin.Context) { panic("secret dsn=postgres://admin:hunter2@db") },
+			wantStatus:  http.StatusInternalServerError,
+			wantMessage: "Internal server error",
+		},
+		{
+			name: "panic after writing",
+			handler: func(c *gin.Context) {
+				c.String(http.StatusOK, "partial")
+				panic("late failure")
+			},
+			wantStatus: http.StatusOK,
+		},
+		{name: "no panic", handler: func(c *gin.Context) { c.Status(http.StatusNoContent) }, wantStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			after := false
+			router := gin.New()
+			router.Use(RequestID(), Recovery())
+			router.GET("/", tt.handler, func(c *gin.Context) { after = true })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(RequestIDHeader, "req-42")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get(RequestIDHeader); got != "req-42" {
+				t.Errorf("%s = %q, want req-42", RequestIDHeader, got)
+			}
+			if tt.wantMessage != "" {
+				var resp models.Response
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("body %s is not the JSON envelope: %v", w.Body, err)
+				}
+				if resp.Success || resp.Message != tt.wantMessage {
+					t.Errorf("body = %s, want message %q", w.Body, tt.wantMessage)
+				}
+				if strings.Contains(w.Body.String(), "hunter2") {
+					t.Errorf("panic value leaked to the client: %s", w.Body)
+				}
+				if !strings.Contains(logs.String(), "request_id=req-42") || !strings.Contains(logs.String(), "hunter2") {
+					t.Errorf("panic not logged with its request ID: %s", logs.String())
+				}
+				if after {
+					t.Error("handlers after the panic still ran")
+				}
+			}
+		})
+	}
+}
+
+func TestRecoveryRepanicsAbortHandler(t *testing.T) {
+	router := gin.New()
+	router.Use(Recovery())
+	router.GET("/", func(c *gin.Context) { panic(http.ErrAbortHandler) })
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler to propagate", r)
+		}
+	}()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
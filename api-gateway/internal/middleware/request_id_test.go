@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantKept bool
+	}{
+		{name: "caller id kept", header: "trace-1:span_2.a", wantKept: true},
+		{name: "at the length limit", header: strings.Repeat("a", 64), wantKept: true},
+		{name: "missing"},
+		{name: "too long", header: strings.Repeat("a", 65)},
+		{name: "log injection", header: "id\nlevel=error"},
+		{name: "spaces", header: "my request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inContext string
+			router := gin.New()
+			router.Use(RequestID())
+			router.GET("/", func(c *gin.Context) {
+				inContext = GetRequestID(c)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if got != inContext {
+				t.Errorf("header %q differs from context %q", got, inContext)
+			}
+			if tt.wantKept {
+				if got != tt.header {
+					t.Errorf("%s = %q, want the caller's %q", RequestIDHeader, got, tt.header)
+				}
+				return
+			}
+			if _, err := uuid.Parse(got); err != nil {
+				t.Errorf("%s = %q, want a generated UUID", RequestIDHeader, got)
+			}
+		})
+	}
+}
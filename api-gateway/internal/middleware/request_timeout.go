@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// RequestTimeout bounds the request context by the client's
+// X-Request-Timeout, given as a Go duration ("500ms") or in seconds ("2.5").
+// Values above maxTimeout are capped to it. A request that runs out of
+// time without writing a response gets 504.
+func RequestTimeout(maxTimeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(RequestTimeoutHeader)
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		timeout, err := parseRequestTimeout(header)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse("Invalid X-Request-Timeout header", err))
+			return
+		}
+		timeout = min(timeout, maxTimeout)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, models.ErrorResponseSimple("Request timed out"))
+		}
+	}
+}
+
+func parseRequestTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, floatErr := strconv.ParseFloat(value, 64)
+		if floatErr != nil {
+			return 0, fmt.Errorf("must be a duration such as 500ms or a number of seconds")
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return timeout, nil
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		maxTimeout   time.Duration
+		wantStatus   int
+		wantDeadline time.Duration
+	}{
+		{name: "no header", maxTimeout: time.Second, wantStatus: http.StatusOK},
+		{name: "short timeout honored", header: "20ms", maxTimeout: time.Second, wantStatus: http.StatusGatewayTimeout, wantDeadline: 20 * time.Millisecond},
+		{name: "seconds honored", header: "0.02", maxTimeout: time.Second, wantStatus: http.StatusGatewayTimeout, wantDeadline: 20 * time.Millisecond},
+		{name: "oversized capped", header: "1h", maxTimeout: 20 * time.Millisecond, wantStatus: http.StatusGatewayTimeout, wantDeadline: 20 * time.Millisecond},
+		{name: "malformed", header: "soon", maxTimeout: time.Second, wantStatus: http.StatusBadRequest},
+		{name: "negative", header: "-1s", maxTimeout: time.Second, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deadline time.Duration
+			router := gin.New()
+			router.Use(RequestTimeout(tt.maxTimeout))
+			router.GET("/", func(c *gin.Context) {
+				ctx := c.Request.Context()
+				d, ok := ctx.Deadline()
+				if !ok {
+					c.Status(http.StatusOK)
+					return
+				}
+				deadline = time.Until(d)
+				<-ctx.Done()
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestTimeoutHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if deadline > tt.wantDeadline {
+				t.Errorf("deadline = %s, want at most %s", deadline, tt.wantDeadline)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// SchemaViolation is one failed JSON Schema constraint
+type SchemaViolation struct {
+	// Field is a JSON pointer into the request body ("" for the root)
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// LoadSchema compiles the JSON Schema file at path.
+func LoadSchema(path string) (*jsonschema.Schema, error) {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// ValidateSchema rejects JSON bodies that don't satisfy schema with a 400
+// listing every violation, and bodies over maxBytes with a 413. The body is
+// restored for the handler's binding.
+func ValidateSchema(schema *jsonschema.Schema, maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge,
+				models.ErrorResponseSimple(fmt.Sprintf("Request body exceeds %d bytes", maxBytes)))
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse("Invalid request body", err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			// Leave malformed JSON to the handler's binding error
+			c.Next()
+			return
+		}
+
+		var ve *jsonschema.ValidationError
+		if err := schema.Validate(doc); errors.As(err, &ve) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ValidationErrorResponse(schemaViolations(ve)))
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse("Invalid request body", err))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// schemaViolations flattens the error tree to its leaf causes
+func schemaViolations(ve *jsonschema.ValidationError) []SchemaViolation {
+	if len(ve.Causes) == 0 {
+		return []SchemaViolation{{Field: ve.InstanceLocation, Message: ve.Message}}
+	}
+	var violations []SchemaViolation
+	for _, cause := range ve.Causes {
+		violations = append(violations, schemaViolations(cause)...)
+	}
+	return violations
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := jsonschema.MustCompileString("schema.json", `{
+		"type": "object",
+		"required": ["user_id"],
+		"properties": {"user_id": {"type": "string"}}
+	}`)
+
+	tests := []struct {
+		name       string
+		body       string
+		maxBytes   int64
+		wantStatus int
+	}{
+		{name: "valid", body: `{"user_id":"u1"}`, maxBytes: 1024, wantStatus: http.StatusOK},
+		{name: "violation", body: `{"user_id":1}`, maxBytes: 1024, wantStatus: http.StatusBadRequest},
+		{name: "malformed left to handler", body: `{`, maxBytes: 1024, wantStatus: http.StatusOK},
+		{name: "at the limit", body: `{"user_id":"u1"}`, maxBytes: 16, wantStatus: http.StatusOK},
+		{name: "over the limit", body: `{"user_id":"u12"}`, maxBytes: 16, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled string
+			router := gin.New()
+			router.POST("/", ValidateSchema(schema, tt.maxBytes), func(c *gin.Context) {
+				body, _ := io.ReadAll(c.Request.Body)
+				handled = string(body)
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK && handled != tt.body {
+				t.Errorf("handler read %q, want the restored body %q", handled, tt.body)
+			}
+		})
+	}
+}
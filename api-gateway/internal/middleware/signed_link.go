@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/links"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// SignedLinkKey is set in the context when a request was authorized by a
+// signed link rather than a token.
+const SignedLinkKey = "signed_link"
+
+// RequireSignedLink authorizes a request by its signed URL instead of a JWT.
+// The signature covers the path, so a link only grants access to the
+// resource it was issued for, and its user_id becomes the request's user.
+func RequireSignedLink(signer *links.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := signer.Verify(c.Request.URL.RequestURI(), time.Now())
+		if errors.Is(err, links.ErrExpired) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Link has expired"))
+			c.Abort()
+			return
+		}
+		userID := c.Query("user_id")
+		if err != nil || userID == "" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponseSimple("Invalid link signature"))
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Set(SignedLinkKey, true)
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobey0x/api-gateway/internal/links"
+)
+
+func TestRequireSignedLink(t *testing.T) {
+	signer := links.NewSigner("link-secret", time.Hour)
+	owner := url.Values{"user_id": {"user-1"}}
+	valid := signer.SignPath("/shared/n1", owner, time.Now())
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "valid", target: valid, wantStatus: http.StatusOK},
+		{name: "expired", target: signer.SignPath("/shared/n1", owner, time.Now().Add(-2*time.Hour)), wantStatus: http.StatusUnauthorized, wantError: "expired"},
+		{name: "other notification", target: strings.Replace(valid, "/shared/n1", "/shared/n2", 1), wantStatus: http.StatusUnauthorized, wantError: "signature"},
+		{name: "other user", target: strings.Replace(valid, "user_id=user-1", "user_id=user-2", 1), wantStatus: http.StatusUnauthorized, wantError: "signature"},
+		{name: "other secret", target: links.NewSigner("other-secret", time.Hour).SignPath("/shared/n1", owner, time.Now()), wantStatus: http.StatusUnauthorized, wantError: "signature"},
+		{name: "no user", target: signer.SignPath("/shared/n1", nil, time.Now()), wantStatus: http.StatusUnauthorized, wantError: "signature"},
+		{name: "unsigned", target: "/shared/n1?user_id=user-1", wantStatus: http.StatusUnauthorized, wantError: "signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/shared/:id", RequireSignedLink(signer), func(c *gin.Context) {
+				if !c.GetBool(SignedLinkKey) {
+					t.Error("signed link flag not set")
+				}
+				c.String(http.StatusOK, c.GetString("user_id"))
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != "user-1" {
+				t.Errorf("user = %q, want user-1", w.Body)
+			}
+			if tt.wantError != "" && !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("body %s doesn't mention %q", w.Body, tt.wantError)
+			}
+		})
+	}
+}
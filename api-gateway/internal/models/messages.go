@@ -0,0 +1,135 @@
+package models
+
+import "strings"
+
+// catalogEntry is a stable machine-readable code for an error message plus
+// its translations, keyed by base language tag.
+type catalogEntry struct {
+	code         string
+	translations map[string]string
+}
+
+// errorCatalog covers the common auth, rate-limit and validation errors,
+// keyed by the English message used at the call site.
+var errorCatalog = map[string]catalogEntry{
+	"Missing authorization header": {"auth_missing", map[string]string{
+		"es": "Falta el encabezado de autorización",
+		"fr": "En-tête d'autorisation manquant",
+		"de": "Authorization-Header fehlt",
+	}},
+	"Invalid authorization header format": {"auth_invalid_format", map[string]string{
+		"es": "Formato del encabezado de autorización no válido",
+		"fr": "Format de l'en-tête d'autorisation invalide",
+		"de": "Ungültiges Format des Authorization-Headers",
+	}},
+	"Invalid or expired token": {"auth_invalid_token", map[string]string{
+		"es": "Token no válido o caducado",
+		"fr": "Jeton invalide ou expiré",
+		"de": "Ungültiges oder abgelaufenes Token",
+	}},
+	"Invalid token claims": {"auth_invalid_claims", map[string]string{
+		"es": "Claims del token no válidos",
+		"fr": "Revendications du jeton invalides",
+		"de": "Ungültige Token-Claims",
+	}},
+	"Token has expired": {"auth_token_expired", map[string]string{
+		"es": "El token ha caducado",
+		"fr": "Le jeton a expiré",
+		"de": "Das Token ist abgelaufen",
+	}},
+	"Access denied": {"auth_access_denied", map[string]string{
+		"es": "Acceso denegado",
+		"fr": "Accès refusé",
+		"de": "Zugriff verweigert",
+	}},
+	"Insufficient permissions": {"auth_insufficient_permissions", map[string]string{
+		"es": "Permisos insuficientes",
+		"fr": "Autorisations insuffisantes",
+		"de": "Unzureichende Berechtigungen",
+	}},
+	"Rate limit exceeded. Please try again later.": {"rate_limit_exceeded", map[string]string{
+		"es": "Límite de solicitudes excedido. Inténtelo de nuevo más tarde.",
+		"fr": "Limite de requêtes dépassée. Veuillez réessayer plus tard.",
+		"de": "Anfragelimit überschritten. Bitte versuchen Sie es später erneut.",
+	}},
+	"Invalid request body": {"validation_invalid_body", map[string]string{
+		"es": "Cuerpo de la solicitud no válido",
+		"fr": "Corps de la requête invalide",
+		"de": "Ungültiger Anfrageinhalt",
+	}},
+	"Request body is required": {"validation_body_required", map[string]string{
+		"es": "El cuerpo de la solicitud es obligatorio",
+		"fr": "Le corps de la requête est obligatoire",
+		"de": "Anfrageinhalt ist erforderlich",
+	}},
+	"Request validation failed": {"validation_failed", map[string]string{
+		"es": "La validación de la solicitud falló",
+		"fr": "La validation de la requête a échoué",
+		"de": "Validierung der Anfrage fehlgeschlagen",
+	}},
+	"Invalid X-Idempotency-Key header": {"validation_idempotency_key", map[string]string{
+		"es": "Encabezado X-Idempotency-Key no válido",
+		"fr": "En-tête X-Idempotency-Key invalide",
+		"de": "Ungültiger X-Idempotency-Key-Header",
+	}},
+	"X-Idempotency-Key header is required": {"validation_idempotency_key_required", map[string]string{
+		"es": "El encabezado X-Idempotency-Key es obligatorio",
+		"fr": "L'en-tête X-Idempotency-Key est obligatoire",
+		"de": "X-Idempotency-Key-Header ist erforderlich",
+	}},
+	"Internal server error": {"internal_error", map[string]string{
+		"es": "Error interno del servidor",
+		"fr": "Erreur interne du serveur",
+		"de": "Interner Serverfehler",
+	}},
+}
+
+// ErrorCode returns the stable code for a catalog message, or "".
+func ErrorCode(message string) string {
+	return errorCatalog[message].code
+}
+
+// SupportedLanguage picks the first language in an Accept-Language header
+// that the catalog has translations for. English and unsupported languages
+// return "".
+func SupportedLanguage(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		switch base {
+		case "en":
+			return ""
+		case "es", "fr", "de":
+			return base
+		}
+	}
+	return ""
+}
+
+// Localize translates the response's catalog message into lang. The
+// message is looked up by text, then by Code. ok is false, and r is
+// returned unchanged, when the catalog has no translation for it.
+func (r Response) Localize(lang string) (localized Response, ok bool) {
+	entry, found := errorCatalog[r.Message]
+	if !found && r.Code != "" {
+		for _, e := range errorCatalog {
+			if e.code == r.Code {
+				entry, found = e, true
+				break
+			}
+		}
+	}
+	if !found {
+		return r, false
+	}
+	translated, found := entry.translations[lang]
+	if !found {
+		return r, false
+	}
+
+	if r.Error != nil && *r.Error == r.Message {
+		r.Error = &translated
+	}
+	r.Message = translated
+	return r, true
+}
@@ -1,7 +1,11 @@
 package models
 
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
 
 
 type NotificationType string
@@ -29,6 +33,24 @@ type NotificationRequest struct {
 	Priority   Priority               `json:"priority" binding:"required,oneof=high normal low"`
 	TemplateID string                 `json:"template_id" binding:"required"`
 	Variables  map[string]interface{} `json:"variables"`
+	// RoutingKeyOverride targets a specific queue (admin only, allowlisted)
+	RoutingKeyOverride string `json:"routing_key_override,omitempty"`
+	// ScheduledAt defers delivery; omitted or past times send immediately
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	// SignedLinks names URL variables to replace with signed, expiring links
+	SignedLinks []string `json:"signed_links,omitempty"`
+	// NotificationID lets clients choose the ID; a UUID is generated if empty
+	NotificationID string `json:"notification_id,omitempty"`
+	// DedupGroup with SuppressIfDeliveredWithin (seconds) skips the send when
+	// a notification in the same group reached the user within the window
+	DedupGroup                string `json:"dedup_group,omitempty"`
+	SuppressIfDeliveredWithin int    `json:"suppress_if_delivered_within,omitempty" binding:"min=0"`
+	// ForceChannels (admin only) sends on each listed channel regardless of
+	// the user's preferences, one notification per channel
+	ForceChannels []NotificationType `json:"force_channels,omitempty" binding:"omitempty,max=10,dive,oneof=email push"`
+	// SensitiveVariables names variables to encrypt before publishing, in
+	// addition to the configured ones
+	SensitiveVariables []string `json:"sensitive_variables,omitempty" binding:"omitempty,max=50"`
 }
 
 
@@ -42,6 +64,16 @@ type NotificationMessage struct {
 	Metadata       MessageMetadata        `json:"metadata"`
 	RetryCount     int                    `json:"retry_count"`
 	MaxRetries     int                    `json:"max_retries"`
+	ScheduledAt    *time.Time             `json:"scheduled_at,omitempty"`
+	// Rendered is set when the gateway renders the template itself
+	Rendered       *RenderedContent       `json:"rendered,omitempty"`
+}
+
+
+// RenderedContent is a template rendered by the gateway
+type RenderedContent struct {
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
 }
 
 
@@ -49,17 +81,119 @@ type MessageMetadata struct {
 	IPAddress string    `json:"ip_address"`
 	UserAgent string    `json:"user_agent"`
 	Timestamp time.Time `json:"timestamp"`
+	// Test marks a developer's test send to themselves
+	Test bool `json:"test,omitempty"`
+}
+
+
+// DefaultMaxRetries is the number of retries a notification gets
+const DefaultMaxRetries = 3
+
+
+const (
+	StatusPending		= "pending"
+	// StatusQueuedOutbox means the broker was unavailable and the message
+	// is waiting in the outbox to be published.
+	StatusQueuedOutbox	= "queued_outbox"
+	// StatusSuppressed means the user's preferences disabled the channel
+	StatusSuppressed	= "suppressed"
+	// StatusUntracked means the message was published but its status record
+	// could not be written, so it cannot be looked up
+	StatusUntracked		= "untracked"
+	// Worker-reported states
+	StatusProcessing	= "processing"
+	StatusRetry			= "retry"
+	StatusSent			= "sent"
+	StatusFailed		= "failed"
+	// StatusExpired means the notification's deadline passed before it
+	// could be delivered
+	StatusExpired		= "expired"
+	// StatusDelivered is the push worker's name for sent
+	StatusDelivered		= "delivered"
+)
+
+
+// NormalizeStatus maps worker-specific status names onto the gateway's
+func NormalizeStatus(status string) string {
+	if status == StatusDelivered {
+		return StatusSent
+	}
+	return status
+}
+
+
+// IsTerminalStatus reports whether no further updates are expected. It
+// accepts the workers' names as well, since they also write status records
+// directly.
+func IsTerminalStatus(status string) bool {
+	switch NormalizeStatus(status) {
+	case StatusSent, StatusFailed, StatusExpired, StatusSuppressed:
+		return true
+	}
+	return false
+}
+
+
+// AuditEntry records an accepted notification request for replay
+type AuditEntry struct {
+	NotificationID string              `json:"notification_id"`
+	Request        NotificationRequest `json:"request"`
+	CreatedAt      time.Time           `json:"created_at"`
+	// ReplayOf is set on entries created by replaying another notification
+	ReplayOf       string              `json:"replay_of,omitempty"`
+}
+
+
+// StatusUpdate is a worker's report of a delivery state change, in the same
+// shape the workers write to Redis.
+type StatusUpdate struct {
+	NotificationID string    `json:"notification_id"`
+	Status         string    `json:"status"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ErrorMessage   string    `json:"error_message,omitempty"`
+	// DeliveredChannel is the channel that actually delivered, which can
+	// differ from the requested type after a fallback
+	DeliveredChannel string `json:"delivered_channel,omitempty"`
 }
 
 
 type NotificationStatus struct {
-	NotificationID string           `json:"notification_id"`
-	Type           NotificationType `json:"type"`
-	UserID         string           `json:"user_id"`
-	Status         string           `json:"status"` // pending, sent, failed, retry
-	CreatedAt      time.Time        `json:"created_at"`
-	UpdatedAt      time.Time        `json:"updated_at"`
-	ErrorMessage   *string          `json:"error_message,omitempty"`
+	NotificationID   string           `json:"notification_id"`
+	Type             NotificationType `json:"type"`
+	UserID           string           `json:"user_id"`
+	TemplateID       string           `json:"template_id,omitempty"`
+	Priority         Priority         `json:"priority,omitempty"`
+	DedupGroup       string           `json:"dedup_group,omitempty"`
+	Status           string           `json:"status"` // pending, sent, failed, retry
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	ScheduledAt      *time.Time       `json:"scheduled_at,omitempty"`
+	ErrorMessage     *string          `json:"error_message,omitempty"`
+	DeliveredChannel string           `json:"delivered_channel,omitempty"`
+	// Test marks a test send, which holds no in-flight slot
+	Test bool `json:"test,omitempty"`
+	// QueuedBytes is the size counted against the user's queued-bytes
+	// budget, returned when the notification reaches a terminal state
+	QueuedBytes int64 `json:"queued_bytes,omitempty"`
+	// RoutingKey and QueueSequence record the notification's place in its
+	// queue's publish order, for estimating its position
+	RoutingKey    string `json:"routing_key,omitempty"`
+	QueueSequence int64  `json:"queue_sequence,omitempty"`
+}
+
+
+// DecodeJSON unmarshals data keeping numbers as json.Number, so large
+// integers in variables reach the workers exactly as sent.
+func DecodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+
+// MarshalBinary lets the status be stored directly in Redis
+func (s NotificationStatus) MarshalBinary() ([]byte, error) {
+	return json.Marshal(s)
 }
 
 
@@ -68,6 +202,40 @@ type NotificationResponse struct {
 	Type           NotificationType `json:"type"`
 	Status         string           `json:"status"`
 	Message        string           `json:"message"`
+	// Channels lists each channel's notification for force_channels
+	Channels []NotificationResponse `json:"channels,omitempty"`
+}
+
+
+// BatchNotificationRequest creates up to 100 notifications in one call
+type BatchNotificationRequest struct {
+	Notifications []NotificationRequest `json:"notifications" binding:"required,min=1,max=100,dive"`
+}
+
+
+// BatchItemResult is the outcome of one item of a batch
+type BatchItemResult struct {
+	Index int `json:"index"`
+	// Code is the HTTP status the item would have got as a single create
+	Code           int    `json:"code"`
+	NotificationID string `json:"notification_id,omitempty"`
+	Status         string `json:"status,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+
+type BatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Failed   int               `json:"failed"`
+	Results  []BatchItemResult `json:"results"`
+}
+
+
+// NotificationSummary aggregates a user's notifications for badges
+type NotificationSummary struct {
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"by_status"`
+	Unread   int64            `json:"unread"`
 }
 
 
@@ -75,4 +243,30 @@ type HealthResponse struct {
 	Status    string            `json:"status"`
 	Timestamp time.Time         `json:"timestamp"`
 	Services  map[string]string `json:"services"`
+}
+
+
+// Provider health statuses
+const (
+	ProviderHealthy  = "healthy"
+	ProviderDegraded = "degraded"
+)
+
+
+// ProviderHealth is one delivery provider's status, as probed by the
+// gateway or reported by a worker
+type ProviderHealth struct {
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	Source    string    `json:"source"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+
+type ProviderHealthResponse struct {
+	Status    string                    `json:"status"`
+	Timestamp time.Time                 `json:"timestamp"`
+	Providers map[string]ProviderHealth `json:"providers"`
+	// Errors lists sources that could not be read
+	Errors []string `json:"errors,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestIsTerminalStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{StatusSent, true},
+		{StatusDelivered, true},
+		{StatusFailed, true},
+		{StatusExpired, true},
+		{StatusSuppressed, true},
+		{StatusPending, false},
+		{StatusQueuedOutbox, false},
+		{StatusProcessing, false},
+		{StatusRetry, false},
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		if got := IsTerminalStatus(tt.status); got != tt.want {
+			t.Errorf("IsTerminalStatus(%q) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
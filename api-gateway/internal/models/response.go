@@ -1,5 +1,6 @@
 package models
 
+import "net/http"
 
 type PaginationMeta struct {
 	Total        int  `json:"total"`
@@ -14,6 +15,8 @@ type Response struct {
 	Success bool            `json:"success"`
 	Data    interface{}     `json:"data,omitempty"`
 	Error   *string         `json:"error,omitempty"`
+	// Code identifies known errors independently of the message language
+	Code    string          `json:"code,omitempty"`
 	Message string          `json:"message"`
 	Meta    *PaginationMeta `json:"meta,omitempty"`
 }
@@ -45,6 +48,7 @@ func ErrorResponse(message string, err error) Response {
 		Success: false,
 		Data:    nil,
 		Error:   &errMsg,
+		Code:    ErrorCode(message),
 		Message: message,
 		Meta:    nil,
 	}
@@ -56,6 +60,7 @@ func ErrorResponseSimple(message string) Response {
 		Success: false,
 		Data:    nil,
 		Error:   &errMsg,
+		Code:    ErrorCode(message),
 		Message: message,
 		Meta:    nil,
 	}
@@ -68,12 +73,55 @@ func ValidationErrorResponse(validationErrors interface{}) Response {
 		Success: false,
 		Data:    validationErrors,
 		Error:   &errMsg,
+		Code:    ErrorCode("Request validation failed"),
 		Message: "Request validation failed",
 		Meta:    nil,
 	}
 }
 
 
+// Problem is an RFC 7807 problem details body. Code and Errors are
+// extension members carrying the envelope's code and validation details.
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     string      `json:"code,omitempty"`
+	Errors   interface{} `json:"errors,omitempty"`
+}
+
+
+// Problem converts an error envelope to problem details. Errors with a
+// catalog code get typeBase+code as their type and their message as the
+// title; others are "about:blank" titled with the status text, as RFC 7807
+// asks, and their message becomes the detail.
+func (r Response) Problem(status int, typeBase, instance string) Problem {
+	p := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   r.Message,
+		Instance: instance,
+		Code:     r.Code,
+		Errors:   r.Data,
+	}
+	if r.Code != "" {
+		p.Type = typeBase + r.Code
+		p.Title = r.Message
+		p.Detail = ""
+	}
+	if r.Error != nil && *r.Error != r.Message {
+		if p.Detail != "" {
+			p.Detail += ": "
+		}
+		p.Detail += *r.Error
+	}
+	return p
+}
+
+
 func CalculatePagination(total, page, limit int) *PaginationMeta {
 	totalPages := (total + limit - 1) / limit
 	
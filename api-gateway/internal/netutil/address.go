@@ -0,0 +1,38 @@
+package netutil
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"syscall"
+)
+
+// ErrNonPublicAddress means a connection was about to be made to a
+// loopback, private, link-local or otherwise non-public address
+var ErrNonPublicAddress = errors.New("address is not public")
+
+// PublicAddressOnly is a net.Dialer Control hook for connections to
+// caller-chosen URLs. It runs for the resolved address being connected to,
+// so a public name pointing at an internal address is caught too.
+func PublicAddressOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, address)
+	}
+	if !PublicAddress(addrPort.Addr()) {
+		return ErrNonPublicAddress
+	}
+	return nil
+}
+
+// PublicAddress reports whether addr is a globally routable unicast
+// address outside the private, loopback, link-local and CGNAT ranges
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() && !cgnat.Contains(addr)
+}
+
+// cgnat is the shared address space (RFC 6598), which providers use
+// internally and IsPrivate doesn't cover
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
@@ -0,0 +1,82 @@
+package netutil
+
+import (
+	"net"
+	"sync"
+
+	"github.com/tobey0x/api-gateway/internal/metrics"
+)
+
+// PerIPLimitListener caps concurrent connections from each remote IP.
+// Connections over the limit are closed as soon as they are accepted.
+type PerIPLimitListener struct {
+	net.Listener
+	max int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+func NewPerIPLimitListener(l net.Listener, max int) *PerIPLimitListener {
+	return &PerIPLimitListener{
+		Listener: l,
+		max:      max,
+		conns:    make(map[string]int),
+	}
+}
+
+func (l *PerIPLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := remoteIP(conn)
+		if !l.acquire(ip) {
+			metrics.RejectedConnections.Inc()
+			conn.Close()
+			continue
+		}
+		return &trackedConn{Conn: conn, release: func() { l.release(ip) }}, nil
+	}
+}
+
+func (l *PerIPLimitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *PerIPLimitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// trackedConn releases its slot exactly once, however often Close is called
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
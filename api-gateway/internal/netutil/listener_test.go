@@ -0,0 +1,135 @@
+package netutil
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+)
+
+// fakeConn is a connection from a given address that records Close
+type fakeConn struct {
+	net.Conn
+	addr   net.Addr
+	closed atomic.Bool
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *fakeConn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+// fakeListener accepts the connections queued on it, then fails
+type fakeListener struct {
+	net.Listener
+	conns chan net.Conn
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	default:
+		return nil, errors.New("no more connections")
+	}
+}
+
+func dialFrom(l *fakeListener, ip string) *fakeConn {
+	conn := &fakeConn{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}}
+	l.conns <- conn
+	return conn
+}
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := counter.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func accept(t *testing.T, l net.Listener) net.Conn {
+	t.Helper()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept = %v", err)
+	}
+	return conn
+}
+
+func TestPerIPLimitListenerEnforcesLimit(t *testing.T) {
+	inner := &fakeListener{conns: make(chan net.Conn, 10)}
+	l := NewPerIPLimitListener(inner, 2)
+	before := counterValue(t, metrics.RejectedConnections)
+
+	first, second := dialFrom(inner, "10.0.0.1"), dialFrom(inner, "10.0.0.1")
+	over := dialFrom(inner, "10.0.0.1")
+	other := dialFrom(inner, "10.0.0.2")
+
+	if got := accept(t, l).RemoteAddr(); got != first.addr {
+		t.Errorf("accepted %v first, want %v", got, first.addr)
+	}
+	if got := accept(t, l).RemoteAddr(); got != second.addr {
+		t.Errorf("accepted %v second, want %v", got, second.addr)
+	}
+	// The third connection from 10.0.0.1 is closed and skipped
+	if got := accept(t, l).RemoteAddr(); got != other.addr {
+		t.Errorf("accepted %v third, want %v from another IP", got, other.addr)
+	}
+	if !over.closed.Load() {
+		t.Error("connection over the limit was not closed")
+	}
+	if first.closed.Load() || second.closed.Load() || other.closed.Load() {
+		t.Error("a connection within the limit was closed")
+	}
+	if got := counterValue(t, metrics.RejectedConnections) - before; got != 1 {
+		t.Errorf("rejected connections rose by %v, want 1", got)
+	}
+}
+
+func TestPerIPLimitListenerIndependentIPs(t *testing.T) {
+	inner := &fakeListener{conns: make(chan net.Conn, 10)}
+	l := NewPerIPLimitListener(inner, 1)
+
+	ips := []string{"10.0.0.1", "10.0.0.2", "2001:db8::1", "2001:db8::2"}
+	for _, ip := range ips {
+		dialFrom(inner, ip)
+	}
+	for _, ip := range ips {
+		conn := accept(t, l)
+		if got := conn.RemoteAddr().(*net.TCPAddr).IP.String(); got != ip {
+			t.Errorf("accepted %s, want %s", got, ip)
+		}
+	}
+}
+
+func TestPerIPLimitListenerReleasesOnClose(t *testing.T) {
+	inner := &fakeListener{conns: make(chan net.Conn, 10)}
+	l := NewPerIPLimitListener(inner, 1)
+
+	dialFrom(inner, "10.0.0.1")
+	conn := accept(t, l)
+	over := dialFrom(inner, "10.0.0.1")
+	if _, err := l.Accept(); err == nil || !over.closed.Load() {
+		t.Fatal("second connection accepted while the first was open")
+	}
+
+	// Closing twice must only free one slot
+	conn.Close()
+	conn.Close()
+	next := dialFrom(inner, "10.0.0.1")
+	if got := accept(t, l).RemoteAddr(); got != next.addr {
+		t.Errorf("accepted %v after Close, want %v", got, next.addr)
+	}
+	over = dialFrom(inner, "10.0.0.1")
+	if _, err := l.Accept(); err == nil || !over.closed.Load() {
+		t.Error("a double Close freed two slots")
+	}
+}
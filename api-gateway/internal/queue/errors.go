@@ -0,0 +1,36 @@
+package queue
+
+import "errors"
+
+var (
+	// ErrNotConnected means the broker connection or channel is unavailable.
+	// Callers may retry once the client reconnects.
+	ErrNotConnected = errors.New("rabbitmq not connected")
+
+	// ErrPublishRejected means the broker refused the message.
+	ErrPublishRejected = errors.New("rabbitmq rejected publish")
+
+	// ErrPublishTimeout means the publish did not complete before the
+	// context deadline.
+	ErrPublishTimeout = errors.New("rabbitmq publish timed out")
+
+	// ErrQueueFull means the broker accepted the connection but did not keep
+	// the message: it was nacked (e.g. a queue at x-max-length with
+	// x-overflow=reject-publish) or returned as unroutable.
+	ErrQueueFull = errors.New("rabbitmq queue full or unroutable")
+
+	// ErrChannelUnavailable means the routing key's queue failed to set up
+	// at startup and the client is running degraded without it.
+	ErrChannelUnavailable = errors.New("rabbitmq channel unavailable")
+
+	// ErrQueueArgsMismatch means a queue already exists with arguments
+	// (e.g. x-max-priority) other than those the gateway declares.
+	ErrQueueArgsMismatch = errors.New("rabbitmq queue exists with different arguments")
+
+	// ErrQueueNotFound means the named queue does not exist.
+	ErrQueueNotFound = errors.New("rabbitmq queue not found")
+
+	// ErrFlowPaused means the broker asked publishers to stop (channel flow
+	// or a blocked connection). Publishing resumes once it lifts.
+	ErrFlowPaused = errors.New("rabbitmq flow control active")
+)
@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxMinBackoff   = time.Second
+	outboxMaxBackoff   = time.Minute
+)
+
+// OutboxStore persists messages that could not be published.
+type OutboxStore interface {
+	PushOutbox(ctx context.Context, entry string) error
+	// PeekOutbox returns the oldest entry without removing it, or "" when empty.
+	PeekOutbox(ctx context.Context) (string, error)
+	RemoveOutbox(ctx context.Context, entry string) error
+}
+
+type OutboxEntry struct {
+	NotificationID string          `json:"notification_id"`
+	RoutingKey     string          `json:"routing_key"`
+	Message        json.RawMessage `json:"message"`
+	EnqueuedAt     time.Time       `json:"enqueued_at"`
+}
+
+// Publisher publishes a message to the broker. RabbitMQClient implements it.
+type Publisher interface {
+	Publish(ctx context.Context, routingKey string, message interface{}) error
+}
+
+// Outbox gives at-least-once delivery across broker outages: messages that
+// fail to publish are stored and re-published by Run once the broker is back.
+type Outbox struct {
+	client      Publisher
+	store       OutboxStore
+	onPublished func(ctx context.Context, notificationID string)
+}
+
+func NewOutbox(client Publisher, store OutboxStore) *Outbox {
+	return &Outbox{
+		client: client,
+		store:  store,
+	}
+}
+
+// OnPublished registers a callback invoked after an outbox entry reaches the
+// broker. It must be set before Run is started.
+func (o *Outbox) OnPublished(fn func(ctx context.Context, notificationID string)) {
+	o.onPublished = fn
+}
+
+// ShouldStore reports whether a publish error is a transient broker outage
+// worth buffering, as opposed to a rejection that will not succeed on retry.
+func ShouldStore(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, ErrPublishTimeout)
+}
+
+func (o *Outbox) Enqueue(ctx context.Context, notificationID, routingKey string, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+
+	entry, err := json.Marshal(OutboxEntry{
+		NotificationID: notificationID,
+		RoutingKey:     routingKey,
+		Message:        body,
+		EnqueuedAt:     time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+
+	if err := o.store.PushOutbox(ctx, string(entry)); err != nil {
+		return fmt.Errorf("failed to store outbox entry: %w", err)
+	}
+
+	log.Printf("Notification %s stored in outbox (routing key: %s)", notificationID, routingKey)
+	return nil
+}
+
+// Run drains the outbox until ctx is cancelled, backing off exponentially
+// while the broker keeps failing.
+func (o *Outbox) Run(ctx context.Context) {
+	backoff := outboxMinBackoff
+
+	for {
+		wait := outboxPollInterval
+
+		raw, err := o.store.PeekOutbox(ctx)
+		if err != nil {
+			log.Printf("Failed to read outbox: %v", err)
+		} else if raw != "" {
+			if err := o.publish(ctx, raw); err != nil {
+				log.Printf("Outbox publish failed, retrying in %s: %v", backoff, err)
+				wait = backoff
+				backoff = min(backoff*2, outboxMaxBackoff)
+			} else {
+				backoff = outboxMinBackoff
+				wait = 0
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (o *Outbox) publish(ctx context.Context, raw string) error {
+	var entry OutboxEntry
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		log.Printf("Dropping malformed outbox entry: %v", err)
+		return o.store.RemoveOutbox(ctx, raw)
+	}
+
+	if err := o.client.Publish(ctx, entry.RoutingKey, entry.Message); err != nil {
+		return err
+	}
+
+	// A crash before removal re-publishes the entry, hence at-least-once
+	if err := o.store.RemoveOutbox(ctx, raw); err != nil {
+		log.Printf("Failed to remove published outbox entry %s: %v", entry.NotificationID, err)
+	}
+
+	log.Printf("✓ Outbox entry %s published after %s", entry.NotificationID, time.Since(entry.EnqueuedAt).Round(time.Millisecond))
+	if o.onPublished != nil {
+		o.onPublished(ctx, entry.NotificationID)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memOutboxStore is an in-memory OutboxStore
+type memOutboxStore struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (s *memOutboxStore) PushOutbox(_ context.Context, entry string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memOutboxStore) PeekOutbox(_ context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		return "", nil
+	}
+	return s.entries[0], nil
+}
+
+func (s *memOutboxStore) RemoveOutbox(_ context.Context, entry string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.Index(s.entries, entry); i >= 0 {
+		s.entries = slices.Delete(s.entries, i, i+1)
+	}
+	return nil
+}
+
+func (s *memOutboxStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// flakyPublisher fails its first failures publishes with err
+type flakyPublisher struct {
+	mu        sync.Mutex
+	failures  int
+	err       error
+	published []string
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, routingKey string, _ interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return p.err
+	}
+	p.published = append(p.published, routingKey)
+	return nil
+}
+
+func TestOutboxDrainsAfterRecovery(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		entries       []string
+		wantPublished []string
+		wantNotified  []string
+	}{
+		{
+			name:          "broker up",
+			entries:       []string{outboxEntry(t, "n1", "email")},
+			wantPublished: []string{"email"},
+			wantNotified:  []string{"n1"},
+		},
+		{
+			name:          "broker recovers",
+			failures:      1,
+			entries:       []string{outboxEntry(t, "n1", "email"), outboxEntry(t, "n2", "push")},
+			wantPublished: []string{"email", "push"},
+			wantNotified:  []string{"n1", "n2"},
+		},
+		{
+			name:    "malformed entry dropped",
+			entries: []string{"{not json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memOutboxStore{entries: slices.Clone(tt.entries)}
+			publisher := &flakyPublisher{failures: tt.failures, err: fmt.Errorf("%w: connection is closed", ErrNotConnected)}
+
+			var mu sync.Mutex
+			var notified []string
+			outbox := NewOutbox(publisher, store)
+			outbox.OnPublished(func(_ context.Context, id string) {
+				mu.Lock()
+				defer mu.Unlock()
+				notified = append(notified, id)
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				outbox.Run(ctx)
+			}()
+
+			for store.len() > 0 && ctx.Err() == nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			if n := store.len(); n != 0 {
+				t.Fatalf("outbox still holds %d entries", n)
+			}
+			publisher.mu.Lock()
+			defer publisher.mu.Unlock()
+			if !slices.Equal(publisher.published, tt.wantPublished) {
+				t.Errorf("published %v, want %v", publisher.published, tt.wantPublished)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(notified, tt.wantNotified) {
+				t.Errorf("notified %v, want %v", notified, tt.wantNotified)
+			}
+		})
+	}
+}
+
+func TestShouldStore(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w: connection is closed", ErrNotConnected), true},
+		{fmt.Errorf("%w: deadline", ErrPublishTimeout), true},
+		{fmt.Errorf("%w: nacked", ErrQueueFull), false},
+		{fmt.Errorf("%w: paused", ErrFlowPaused), false},
+	}
+	for _, tt := range tests {
+		if got := ShouldStore(tt.err); got != tt.want {
+			t.Errorf("ShouldStore(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func outboxEntry(t *testing.T, notificationID, routingKey string) string {
+	t.Helper()
+	entry, err := json.Marshal(OutboxEntry{
+		NotificationID: notificationID,
+		RoutingKey:     routingKey,
+		Message:        json.RawMessage(`{"notification_id":"` + notificationID + `"}`),
+		EnqueuedAt:     time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(entry)
+}
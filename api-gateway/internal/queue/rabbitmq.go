@@ -1,63 +1,337 @@
 package queue
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tobey0x/api-gateway/internal/models"
 )
 
 
 type RabbitMQClient struct {
-	conn		*amqp.Connection
-	channel		*amqp.Channel
+	// mu guards session, which is replaced whole when the connection drops
+	// and a broker accepts a new one
+	mu			sync.RWMutex
+	session		*session
+	// urls are the brokers in failover order
+	urls		[]string
+	dial		DialOptions
+	// closed stops reconnecting once Close has been called
+	closed		atomic.Bool
+	// reconnecting is set from losing the session until a new one starts
+	reconnecting	atomic.Bool
+	// exchange is the configured exchange; a session may use fallbackExchange
 	exchange	string
+	// channelExchanges routes specific routing keys to their own exchange
+	channelExchanges	map[string]string
 	emailQueue	string
 	pushQueue	string
 	failedQueue	string
+	// fallbackExchange replaces exchange if it already exists with another type
+	fallbackExchange	string
+	// returned records message IDs the broker handed back as unroutable,
+	// keyed while their publish is waiting for its confirm
+	returnedMu	sync.Mutex
+	returned	map[string]bool
+	// allowDegraded lets the client start when only some queues set up
+	allowDegraded	bool
+	// adoptExisting uses a queue as is when it exists with other arguments
+	adoptExisting	bool
+	// compressThreshold gzips bodies larger than this many bytes; 0 disables
+	compressThreshold	int
+	// flowStopped (channel.flow) and blockedReason (connection.blocked) are
+	// the broker's flow control; Publish refuses while either is set
+	flowMu			sync.RWMutex
+	flowStopped		bool
+	blockedReason	string
+	// probing is set while a Probe round trip is outstanding
+	probing		atomic.Bool
+	// depths caches QueueDepth results by routing key for depthCacheTTL
+	depthMu		sync.Mutex
+	depths		map[string]cachedDepth
 }
 
 
-func NewRabbitMQClient(url, exchange, emailQueue, pushQueue, failedQueue string) (*RabbitMQClient, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
-	}
+// session is one broker connection and the publishing channel opened on it
+type session struct {
+	conn		*amqp.Connection
+	channel		*amqp.Channel
+	// active indexes urls for the broker conn is connected to
+	active		int
+	// exchange is the one setup declared, which may be the fallback
+	exchange	string
+	// unavailable maps routing keys whose queues failed to set up to the
+	// setup error
+	unavailable	map[string]error
+	// returnSync asks watchReturns to mark every return received so far;
+	// returnsDone is closed once it has drained the closed return channel
+	returnSync	chan chan struct{}
+	returnsDone	chan struct{}
+}
 
 
-	channel, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+type cachedDepth struct {
+	messages	int
+	at			time.Time
+}
+
+
+// depthCacheTTL keeps status polling from costing a broker round trip each
+const depthCacheTTL = time.Second
+
+
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+
+// DialOptions tune the AMQP connection
+type DialOptions struct {
+	// Heartbeat detects connections silently dropped by firewalls; 0 uses
+	// the broker's suggestion
+	Heartbeat	time.Duration
+	Locale		string
+	// ConnectionName identifies the gateway in the broker's management UI
+	ConnectionName	string
+	// TLS is used for amqps:// URLs; nil uses the system roots
+	TLS		*tls.Config
+}
+
+
+func (o DialOptions) amqpConfig() amqp.Config {
+	properties := amqp.NewConnectionProperties()
+	if o.ConnectionName != "" {
+		properties.SetClientConnectionName(o.ConnectionName)
+	}
+	// amqp091 fills in ServerName from the URL on the config it's given, so
+	// each dial gets a copy and failover verifies each broker's own name
+	return amqp.Config{
+		Heartbeat: o.Heartbeat,
+		Locale: o.Locale,
+		Properties: properties,
+		TLSClientConfig: o.TLS.Clone(),
 	}
+}
 
 
+// NewRabbitMQClient connects to the first of urls that accepts a connection
+// and declares the topology. If the connection or publishing channel later
+// drops, the client redials with backoff and declares the topology again;
+// publishes fail with ErrNotConnected meanwhile. channelExchanges maps
+// a routing key to a dedicated exchange; other keys use exchange. With
+// allowDegraded, queues that fail to set up are reported by
+// UnavailableChannels instead of failing construction. With adoptExisting,
+// a queue that already exists with different arguments is used as is.
+func NewRabbitMQClient(urls []string, exchange, fallbackExchange, emailQueue, pushQueue, failedQueue string, channelExchanges map[string]string, allowDegraded, adoptExisting bool, dial DialOptions) (*RabbitMQClient, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: no broker URLs")
+	}
 	client := &RabbitMQClient{
-		conn:	conn,
-		channel: channel,
+		urls: urls,
+		dial: dial,
 		exchange: exchange,
+		channelExchanges: channelExchanges,
+		fallbackExchange: fallbackExchange,
 		emailQueue: emailQueue,
 		pushQueue: pushQueue,
 		failedQueue: failedQueue,
+		returned: make(map[string]bool),
+		allowDegraded: allowDegraded,
+		adoptExisting: adoptExisting,
+		depths: make(map[string]cachedDepth),
 	}
 
 
-	if err := client.setup(); err != nil {
-		client.Close()
-		return nil, fmt.Errorf("failed to setup queues: %w", err)
+	s, err := client.connect(0)
+	if err != nil {
+		return nil, err
 	}
+	client.start(s)
 
-	log.Println("✓ RabbitMQ client connected successfully")
+	log.Printf("✓ RabbitMQ client connected successfully to %s", client.ActiveBroker())
 	return client, nil
 }
 
 
-func (c *RabbitMQClient) setup() error {
-	err := c.channel.ExchangeDeclare(
-		c.exchange,
+// connect dials the first broker that accepts, trying urls from index start
+// and wrapping around, declares the topology and puts the publishing
+// channel in confirm mode
+func (c *RabbitMQClient) connect(start int) (*session, error) {
+	conn, active, err := dialFirst(c.urls, start, c.dial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	s := &session{
+		conn: conn,
+		channel: channel,
+		active: active,
+		exchange: c.exchange,
+		unavailable: make(map[string]error),
+		returnSync: make(chan chan struct{}),
+		returnsDone: make(chan struct{}),
+	}
+	if err := c.setup(s); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to setup queues: %w", err)
+	}
+
+	// setup may have replaced the channel, so confirms go on the final one
+	if err := s.channel.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	return s, nil
+}
+
+
+// start makes s the current session and watches it. The watchers subscribe
+// before the swap so no publish on s can miss its return.
+func (c *RabbitMQClient) start(s *session) {
+	returns := s.channel.NotifyReturn(make(chan amqp.Return, 16))
+	flows := s.channel.NotifyFlow(make(chan bool, 1))
+	blockings := s.conn.NotifyBlocked(make(chan amqp.Blocking, 1))
+	connClosed := s.conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := s.channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	if c.closed.Load() {
+		// Close ran while this session was being set up
+		c.mu.Unlock()
+		s.conn.Close()
+		return
+	}
+	c.session = s
+	c.mu.Unlock()
+
+	// Flow control state belonged to the previous connection
+	c.flowMu.Lock()
+	c.flowStopped = false
+	c.blockedReason = ""
+	c.flowMu.Unlock()
+
+	go c.watchReturns(s, returns)
+	go c.watchFlow(flows)
+	go c.watchBlocked(blockings)
+	go c.watchSession(s, connClosed, channelClosed)
+}
+
+
+// watchSession waits for s to lose its connection or publishing channel,
+// then redials with backoff until a broker accepts and the topology is
+// declared again. Consumers notice through their delivery channels and
+// reopen on the new connection.
+func (c *RabbitMQClient) watchSession(s *session, connClosed, channelClosed <-chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-channelClosed:
+	}
+	if c.closed.Load() {
+		return
+	}
+	log.Printf("⚠ RabbitMQ connection to %s lost: %v", brokerHost(c.urls[s.active]), reason)
+	c.reconnecting.Store(true)
+	// A closed channel on an open connection still gets a fresh session,
+	// so the topology is redeclared
+	s.conn.Close()
+
+	// Fail over: the broker after the lost one is tried first, and the
+	// whole list on every attempt
+	from := (s.active + 1) % len(c.urls)
+	backoff := reconnectMinBackoff
+	for !c.closed.Load() {
+		next, err := c.connect(from)
+		if err == nil {
+			c.start(next)
+			c.reconnecting.Store(false)
+			log.Printf("✓ RabbitMQ reconnected to %s", brokerHost(c.urls[next.active]))
+			return
+		}
+		log.Printf("RabbitMQ reconnect failed, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+
+// current returns the live session, which may have lost its connection
+// while a reconnect is pending
+func (c *RabbitMQClient) current() *session {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.session
+}
+
+
+// dialFirst tries urls in order from index start, wrapping around, and
+// returns the first connection with its index, or every broker's error if
+// none accepted
+func dialFirst(urls []string, start int, dial DialOptions) (*amqp.Connection, int, error) {
+	var errs []error
+	for _, i := range dialOrder(len(urls), start) {
+		url := urls[i]
+		conn, err := amqp.DialConfig(url, dial.amqpConfig())
+		if err == nil {
+			return conn, i, nil
+		}
+		if len(urls) > 1 {
+			log.Printf("⚠ RabbitMQ broker %s unavailable: %v", brokerHost(url), err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", brokerHost(url), err))
+	}
+	return nil, -1, errors.Join(errs...)
+}
+
+
+// dialOrder lists the indexes of n brokers starting at start
+func dialOrder(n, start int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = (start + i) % n
+	}
+	return order
+}
+
+
+// brokerHost names a broker URL without its credentials
+func brokerHost(rawURL string) string {
+	uri, err := amqp.ParseURI(rawURL)
+	if err != nil {
+		return "invalid broker URL"
+	}
+	return fmt.Sprintf("%s:%d", uri.Host, uri.Port)
+}
+
+
+// ActiveBroker is the host and port of the broker currently connected to
+func (c *RabbitMQClient) ActiveBroker() string {
+	return brokerHost(c.urls[c.current().active])
+}
+
+
+func (s *session) declareExchange(name string) error {
+	return s.channel.ExchangeDeclare(
+		name,
 		"direct",
 		true,
 		false,
@@ -65,8 +339,174 @@ func (c *RabbitMQClient) setup() error {
 		false,
 		nil,
 	)
-	if err != nil {
-		return fmt.Errorf("failed to declare exchange: %w", err)
+}
+
+
+// watchReturns marks messages published with mandatory set that no queue
+// accepted. The broker sends basic.return before the confirm for the same
+// message, and amqp091 hands it to returns before resolving the confirm, so
+// a return is buffered by the time its ack is seen. A sync request drains
+// the buffer before it is answered, which is how Publish orders the two.
+func (c *RabbitMQClient) watchReturns(s *session, returns <-chan amqp.Return) {
+	defer close(s.returnsDone)
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			c.markReturned(ret)
+		case done := <-s.returnSync:
+			for drained := false; !drained; {
+				select {
+				case ret, ok := <-returns:
+					if !ok {
+						close(done)
+						return
+					}
+					c.markReturned(ret)
+				default:
+					drained = true
+				}
+			}
+			close(done)
+		}
+	}
+}
+
+
+func (c *RabbitMQClient) markReturned(ret amqp.Return) {
+	c.returnedMu.Lock()
+	if _, pending := c.returned[ret.MessageId]; pending {
+		c.returned[ret.MessageId] = true
+	}
+	c.returnedMu.Unlock()
+	log.Printf("RabbitMQ returned message %s (routing key %s): %d %s", ret.MessageId, ret.RoutingKey, ret.ReplyCode, ret.ReplyText)
+}
+
+
+// syncReturns waits until watchReturns has marked every return s received
+// before this call, including any for a message whose ack was just seen
+func (s *session) syncReturns(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case s.returnSync <- done:
+	case <-s.returnsDone:
+		// The watcher drained the closed return channel before exiting
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+
+// watchFlow tracks channel.flow: false asks publishers to stop, true resumes
+func (c *RabbitMQClient) watchFlow(flows <-chan bool) {
+	for active := range flows {
+		c.flowMu.Lock()
+		c.flowStopped = !active
+		c.flowMu.Unlock()
+		if active {
+			log.Println("✓ RabbitMQ channel flow resumed")
+		} else {
+			log.Println("RabbitMQ channel flow stopped, pausing publishes")
+		}
+	}
+}
+
+
+// watchBlocked tracks connection.blocked, which current brokers send instead
+// of channel.flow when a resource alarm (memory or disk) fires
+func (c *RabbitMQClient) watchBlocked(blockings <-chan amqp.Blocking) {
+	for b := range blockings {
+		c.flowMu.Lock()
+		c.blockedReason = ""
+		if b.Active {
+			c.blockedReason = "connection blocked: " + b.Reason
+		}
+		c.flowMu.Unlock()
+		if b.Active {
+			log.Printf("RabbitMQ blocked the connection (%s), pausing publishes", b.Reason)
+		} else {
+			log.Println("✓ RabbitMQ unblocked the connection")
+		}
+	}
+}
+
+
+// FlowPaused returns why publishing is paused by broker flow control, or ""
+func (c *RabbitMQClient) FlowPaused() string {
+	c.flowMu.RLock()
+	defer c.flowMu.RUnlock()
+	if c.blockedReason != "" {
+		return c.blockedReason
+	}
+	if c.flowStopped {
+		return "channel flow stopped"
+	}
+	return ""
+}
+
+
+// takeReturned stops tracking messageID and reports whether it was returned
+func (c *RabbitMQClient) takeReturned(messageID string) bool {
+	c.returnedMu.Lock()
+	defer c.returnedMu.Unlock()
+	returned := c.returned[messageID]
+	delete(c.returned, messageID)
+	return returned
+}
+
+
+// isPreconditionFailed reports whether the broker refused a declare because
+// the entity exists with different arguments.
+func isPreconditionFailed(err error) bool {
+	var amqpErr *amqp.Error
+	return errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed
+}
+
+
+// exchangeFor returns the exchange a routing key is published to on s
+func (c *RabbitMQClient) exchangeFor(s *session, routingKey string) string {
+	if exchange, ok := c.channelExchanges[routingKey]; ok && exchange != "" {
+		return exchange
+	}
+	return s.exchange
+}
+
+
+func (c *RabbitMQClient) setup(s *session) error {
+	exchanges := []string{s.exchange}
+	for _, exchange := range c.channelExchanges {
+		exchanges = append(exchanges, exchange)
+	}
+
+	for _, exchange := range exchanges {
+		// Redeclaring an existing exchange with the same settings is a no-op
+		err := s.declareExchange(exchange)
+		if isPreconditionFailed(err) && exchange == s.exchange && c.fallbackExchange != "" {
+			log.Printf("Exchange %s exists with different settings, using fallback exchange %s", exchange, c.fallbackExchange)
+			// The failed declare closed the channel
+			if s.channel, err = s.conn.Channel(); err != nil {
+				return fmt.Errorf("failed to reopen channel: %w", err)
+			}
+			s.exchange = c.fallbackExchange
+			err = s.declareExchange(s.exchange)
+			exchange = s.exchange
+		}
+		if isPreconditionFailed(err) {
+			return fmt.Errorf("exchange %q already exists with a different type or settings than a durable \"direct\" exchange; "+
+				"delete it, point RABBITMQ_EXCHANGE at another name, or set RABBITMQ_FALLBACK_EXCHANGE: %w", exchange, err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to declare exchange %s: %w", exchange, err)
+		}
 	}
 
 
@@ -80,50 +520,148 @@ func (c *RabbitMQClient) setup() error {
 	}
 
 
+	// Every queue is attempted so all failures are reported together
+	var errs []error
 	for _, q := range queues {
-		// QueueDeclare is idempotent - creates queue if it doesn't exist,
-		// or returns existing queue if it does (with matching parameters)
-		_, err := c.channel.QueueDeclare(
-			q.name,
-			true,  // durable
-			false, // delete when unused
-			false, // exclusive
-			false, // no-wait
-			nil,   // arguments (accept existing configuration)
+		if err := c.setupQueue(s, q.name, q.routingKey); err != nil {
+			errs = append(errs, err)
+			s.unavailable[q.routingKey] = err
+			// A failed declare or bind closes the channel
+			if s.channel.IsClosed() {
+				if s.channel, err = s.conn.Channel(); err != nil {
+					return fmt.Errorf("failed to reopen channel: %w", err)
+				}
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	if !c.allowDegraded || len(errs) == len(queues) {
+		return errors.Join(errs...)
+	}
+	for routingKey, err := range s.unavailable {
+		log.Printf("⚠ RabbitMQ channel %s unavailable, starting degraded: %v", routingKey, err)
+	}
+	return nil
+}
+
+
+func (c *RabbitMQClient) setupQueue(s *session, name, routingKey string) error {
+	// QueueDeclare is idempotent - creates queue if it doesn't exist,
+	// or returns existing queue if it does (with matching parameters)
+	_, err := s.channel.QueueDeclare(
+		name,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments (accept existing configuration)
+	)
+	if isPreconditionFailed(err) {
+		err = c.adoptQueue(s, name, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", name, err)
+	}
+
+	// Bind queue to exchange (skip for DLQ)
+	if name != c.failedQueue {
+		err = s.channel.QueueBind(
+			name,
+			routingKey,
+			c.exchangeFor(s, routingKey),
+			false,
+			nil,
 		)
 		if err != nil {
-			return fmt.Errorf("failed to declare queue %s: %w", q.name, err)
-		}
-
-		// Bind queue to exchange (skip for DLQ)
-		if q.name != c.failedQueue {
-			err = c.channel.QueueBind(
-				q.name,
-				q.routingKey,
-				c.exchange,
-				false,
-				nil,
-			)
-			if err != nil {
-				return fmt.Errorf("failed to bind queue %s: %w", q.name, err)
-			}
+			return fmt.Errorf("failed to bind queue %s: %w", name, err)
 		}
 	}
+	return nil
+}
 
+
+// adoptQueue handles a declare refused because the queue exists with other
+// arguments. The broker's reason names the argument, e.g. "inequivalent arg
+// 'x-max-priority' for queue 'email.queue' in vhost '/': received none but
+// current is the value '10'". With adoptExisting the queue is checked with
+// a passive declare and used as is; otherwise the mismatch is returned.
+func (c *RabbitMQClient) adoptQueue(s *session, name string, declareErr error) error {
+	reason := declareErr.Error()
+	var amqpErr *amqp.Error
+	if errors.As(declareErr, &amqpErr) {
+		reason = amqpErr.Reason
+	}
+	log.Printf("⚠ Queue %s exists with different arguments: %s", name, reason)
+
+	if !c.adoptExisting {
+		return fmt.Errorf("%w (%s); delete the queue or set RABBITMQ_ADOPT_EXISTING_QUEUES=true to use it as is: %w",
+			ErrQueueArgsMismatch, reason, declareErr)
+	}
+
+	// The failed declare closed the channel
+	channel, err := s.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to reopen channel: %w", err)
+	}
+	s.channel = channel
+	if _, err := s.channel.QueueDeclarePassive(name, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to adopt existing queue %s: %w", name, err)
+	}
+	log.Printf("✓ Adopted existing queue %s with its current arguments", name)
 	return nil
 }
 
 
+// SetCompressionThreshold gzips message bodies larger than threshold bytes.
+// Zero, the default, never compresses.
+func (c *RabbitMQClient) SetCompressionThreshold(threshold int) {
+	c.compressThreshold = threshold
+}
 
+
+// UnavailableChannels returns the routing keys whose queues failed to set
+// up, with the reason. It is empty unless the client started degraded.
+func (c *RabbitMQClient) UnavailableChannels() map[string]string {
+	s := c.current()
+	channels := make(map[string]string, len(s.unavailable))
+	for routingKey, err := range s.unavailable {
+		channels[routingKey] = err.Error()
+	}
+	return channels
+}
+
+
+
+// Publish sends message to the exchange and waits for the broker's confirm.
+// Failures wrap ErrNotConnected, ErrPublishTimeout, ErrPublishRejected or
+// ErrQueueFull so callers can use errors.Is.
 func (c *RabbitMQClient) Publish(ctx context.Context, routingKey string, message interface{}) error {
+	s := c.current()
+	if err := s.healthCheck(); err != nil {
+		return err
+	}
+	if err, ok := s.unavailable[routingKey]; ok {
+		return fmt.Errorf("%w: %s: %v", ErrChannelUnavailable, routingKey, err)
+	}
+	if reason := c.FlowPaused(); reason != "" {
+		return fmt.Errorf("%w: %s", ErrFlowPaused, reason)
+	}
+
+	// Also the key returns are matched by, so it must be unique even for
+	// publishes in the same instant
+	taskID := uuid.New().String()
+
 	// Wrap message in Celery task format for email service
 	celeryTask := map[string]interface{}{
 		"task": "send_email_task",
-		"id": fmt.Sprintf("%d", time.Now().UnixNano()),
+		"id": taskID,
 		"args": []interface{}{message},
 		"kwargs": map[string]interface{}{},
 		"retries": 0,
-		"eta": nil,
+		"eta": celeryETA(message),
 	}
 
 	body, err := json.Marshal(celeryTask)
@@ -132,26 +670,63 @@ func (c *RabbitMQClient) Publish(ctx context.Context, routingKey string, message
 	}
 
 
-	err = c.channel.PublishWithContext(
+	headers := amqp.Table{
+		"lang": "go",
+		"task": "send_email_task",
+		"id": taskID,
+	}
+	body, contentEncoding, err := compressBody(body, c.compressThreshold)
+	if err != nil {
+		return fmt.Errorf("failed to compress message: %w", err)
+	}
+	if contentEncoding == "gzip" {
+		// Kombu's header for compressed bodies; the pika and amqplib
+		// consumers check ContentEncoding instead
+		headers["compression"] = "application/x-gzip"
+	}
+
+	c.returnedMu.Lock()
+	c.returned[taskID] = false
+	c.returnedMu.Unlock()
+
+	// mandatory makes the broker return messages no queue would take
+	confirm, err := s.channel.PublishWithDeferredConfirmWithContext(
 		ctx,
-		c.exchange,
+		c.exchangeFor(s, routingKey),
 		routingKey,
-		false,
+		true,
 		false, amqp.Publishing{
 			ContentType: "application/json",
-			ContentEncoding: "utf-8",
+			ContentEncoding: contentEncoding,
 			Body: body,
 			DeliveryMode: amqp.Persistent,
 			Timestamp: time.Now(),
-			Headers: amqp.Table{
-				"lang": "go",
-				"task": "send_email_task",
-				"id": fmt.Sprintf("%d", time.Now().UnixNano()),
-			},
+			MessageId: taskID,
+			Headers: headers,
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to publish message: %w", err)
+		c.takeReturned(taskID)
+		return classifyPublishError(ctx, err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err == nil && acked {
+		err = s.syncReturns(ctx)
+	}
+	returned := c.takeReturned(taskID)
+	if err != nil {
+		return classifyPublishError(ctx, err)
+	}
+	if !acked && s.channel.IsClosed() {
+		// Pending confirms are nacked when the channel closes under them
+		return fmt.Errorf("%w: channel closed before the broker confirmed", ErrNotConnected)
+	}
+	if !acked {
+		return fmt.Errorf("%w: broker nacked message for routing key %s", ErrQueueFull, routingKey)
+	}
+	if returned {
+		return fmt.Errorf("%w: no queue accepted message for routing key %s", ErrQueueFull, routingKey)
 	}
 
 	log.Printf("✓ Published message to queue with routing key: %s", routingKey)
@@ -160,28 +735,277 @@ func (c *RabbitMQClient) Publish(ctx context.Context, routingKey string, message
 
 
 
+// compressBody gzips body when threshold is positive and body is larger,
+// returning the body to publish and its content encoding.
+func compressBody(body []byte, threshold int) ([]byte, string, error) {
+	if threshold <= 0 || len(body) <= threshold {
+		return body, "utf-8", nil
+	}
+	compressed, err := gzipBody(body)
+	if err != nil {
+		return nil, "", err
+	}
+	return compressed, "gzip", nil
+}
+
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+
+// celeryETA returns the scheduled send time in RFC3339 so Celery workers
+// hold the task until then, or nil for immediate sends.
+func celeryETA(message interface{}) interface{} {
+	var scheduledAt *time.Time
+	switch m := message.(type) {
+	case models.NotificationMessage:
+		scheduledAt = m.ScheduledAt
+	case json.RawMessage:
+		// Outbox entries are republished as raw JSON
+		var decoded struct {
+			ScheduledAt *time.Time `json:"scheduled_at"`
+		}
+		if json.Unmarshal(m, &decoded) == nil {
+			scheduledAt = decoded.ScheduledAt
+		}
+	}
+
+	if scheduledAt == nil || !scheduledAt.After(time.Now()) {
+		return nil
+	}
+	return scheduledAt.UTC().Format(time.RFC3339)
+}
+
+
+func classifyPublishError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %v", ErrPublishTimeout, err)
+	case errors.Is(err, amqp.ErrClosed):
+		return fmt.Errorf("%w: %v", ErrNotConnected, err)
+	default:
+		return fmt.Errorf("%w: %v", ErrPublishRejected, err)
+	}
+}
+
+
+// HealthCheck reports the locally known connection and channel state. It
+// makes no broker round trip, so it is cheap enough for every publish, but
+// it can't see a channel the broker has stopped answering on; use Probe.
 func (c *RabbitMQClient) HealthCheck() error {
-	if c.conn == nil || c.conn.IsClosed() {
-		return fmt.Errorf("connection is closed")
+	if c.reconnecting.Load() {
+		return fmt.Errorf("%w: reconnecting to RabbitMQ", ErrNotConnected)
 	}
-	if c.channel == nil {
-		return fmt.Errorf("channel is nil")
+	return c.current().healthCheck()
+}
+
+
+func (s *session) healthCheck() error {
+	if s == nil {
+		return fmt.Errorf("%w: not connected", ErrNotConnected)
+	}
+	if s.conn == nil || s.conn.IsClosed() {
+		return fmt.Errorf("%w: connection is closed", ErrNotConnected)
+	}
+	if s.channel == nil || s.channel.IsClosed() {
+		return fmt.Errorf("%w: channel is closed", ErrNotConnected)
 	}
 	return nil
 }
 
 
+// Probe is HealthCheck plus a round trip on the publishing channel: a
+// passive declare of the exchange, which fails if the channel is unusable
+// even while the connection looks open. amqp091 calls can't be cancelled,
+// so a probe that outlives ctx keeps running, and later probes report the
+// channel unresponsive until it returns rather than piling up behind it.
+func (c *RabbitMQClient) Probe(ctx context.Context) error {
+	s := c.current()
+	if err := s.healthCheck(); err != nil {
+		return err
+	}
+	if !c.probing.CompareAndSwap(false, true) {
+		return fmt.Errorf("%w: channel unresponsive, previous probe still pending", ErrNotConnected)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer c.probing.Store(false)
+		done <- s.channel.ExchangeDeclarePassive(s.exchange, "direct", true, false, false, false, nil)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%w: channel probe failed: %v", ErrNotConnected, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: channel unresponsive: %v", ErrNotConnected, ctx.Err())
+	}
+}
+
+
 func (c *RabbitMQClient) Close() error {
-	if c.channel != nil {
-		if err := c.channel.Close(); err != nil {
+	c.mu.Lock()
+	c.closed.Store(true)
+	s := c.session
+	c.mu.Unlock()
+
+	if s.channel != nil {
+		if err := s.channel.Close(); err != nil {
 			log.Printf("Error closing channel: %v", err)
 		}
 	}
-	if c.conn != nil {
-		if err := c.conn.Close(); err != nil {
+	if s.conn != nil {
+		if err := s.conn.Close(); err != nil {
 			log.Printf("Error cloosing connection: %v", err)
 		}
 	}
 	log.Printf("✓ RabbitMQ client closed")
 	return  nil
-}
\ No newline at end of file
+}
+
+// PeekedMessage is a queued message read by Peek
+type PeekedMessage struct {
+	Body		[]byte
+	Redelivered	bool
+}
+
+
+// Peek returns up to limit messages from the head of queue without removing
+// them. Messages are fetched unacked on a dedicated channel and then nacked
+// with requeue, so they stay in the queue (flagged as redelivered) and the
+// channel's close returns any left over. Missing queues wrap ErrQueueNotFound.
+func (c *RabbitMQClient) Peek(ctx context.Context, queue string, limit int) ([]PeekedMessage, error) {
+	s := c.current()
+	if err := s.healthCheck(); err != nil {
+		return nil, err
+	}
+
+	ch, err := s.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to open channel: %v", ErrNotConnected, err)
+	}
+	defer ch.Close()
+
+	var (
+		messages	[]PeekedMessage
+		lastTag		uint64
+	)
+	for len(messages) < limit && ctx.Err() == nil {
+		delivery, ok, err := ch.Get(queue, false)
+		if err != nil {
+			var amqpErr *amqp.Error
+			if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+				return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queue)
+			}
+			return nil, fmt.Errorf("failed to read from queue %s: %w", queue, err)
+		}
+		if !ok {
+			break
+		}
+		lastTag = delivery.DeliveryTag
+
+		body := delivery.Body
+		if delivery.ContentEncoding == "gzip" {
+			if body, err = gunzipBody(body); err != nil {
+				body = delivery.Body
+			}
+		}
+		messages = append(messages, PeekedMessage{Body: body, Redelivered: delivery.Redelivered})
+	}
+
+	if lastTag > 0 {
+		if err := ch.Nack(lastTag, true, true); err != nil {
+			return nil, fmt.Errorf("failed to requeue peeked messages: %w", err)
+		}
+	}
+	return messages, nil
+}
+
+
+// QueueDepth returns the number of ready messages in the queue bound to
+// routingKey, as of at most depthCacheTTL ago. Messages already delivered to
+// a worker and awaiting ack aren't counted. Routing keys without a known
+// queue wrap ErrQueueNotFound.
+func (c *RabbitMQClient) QueueDepth(ctx context.Context, routingKey string) (int, error) {
+	var name string
+	switch routingKey {
+	case "email":
+		name = c.emailQueue
+	case "push":
+		name = c.pushQueue
+	default:
+		return 0, fmt.Errorf("%w: no queue for routing key %s", ErrQueueNotFound, routingKey)
+	}
+
+	c.depthMu.Lock()
+	cached, ok := c.depths[routingKey]
+	c.depthMu.Unlock()
+	if ok && time.Since(cached.at) < depthCacheTTL {
+		return cached.messages, nil
+	}
+
+	s := c.current()
+	if err := s.healthCheck(); err != nil {
+		return 0, err
+	}
+
+	// A passive declare of a missing queue closes its channel, so it gets
+	// its own. amqp091 calls can't be cancelled; one outliving ctx finishes
+	// in the background.
+	type result struct {
+		queue	amqp.Queue
+		err		error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ch, err := s.conn.Channel()
+		if err != nil {
+			done <- result{err: fmt.Errorf("%w: failed to open channel: %v", ErrNotConnected, err)}
+			return
+		}
+		defer ch.Close()
+		q, err := ch.QueueDeclarePassive(name, true, false, false, false, nil)
+		done <- result{queue: q, err: err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	if res.err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(res.err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return 0, fmt.Errorf("%w: %s", ErrQueueNotFound, name)
+		}
+		return 0, fmt.Errorf("failed to inspect queue %s: %w", name, res.err)
+	}
+
+	c.depthMu.Lock()
+	c.depths[routingKey] = cachedDepth{messages: res.queue.Messages, at: time.Now()}
+	c.depthMu.Unlock()
+	return res.queue.Messages, nil
+}
+
+
+func gunzipBody(body []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
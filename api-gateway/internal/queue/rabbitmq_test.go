@@ -0,0 +1,378 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// testClient connects to the broker at RABBITMQ_TEST_URL with throwaway
+// queues, skipping the test when no broker is configured
+func testClient(t *testing.T) *RabbitMQClient {
+	t.Helper()
+	url := os.Getenv("RABBITMQ_TEST_URL")
+	if url == "" {
+		t.Skip("RABBITMQ_TEST_URL not set")
+	}
+
+	suffix := uuid.New().String()[:8]
+	queues := []string{"email.test." + suffix, "push.test." + suffix, "failed.test." + suffix}
+	client, err := NewRabbitMQClient([]string{url}, "notifications.test."+suffix, "", queues[0], queues[1], queues[2], nil, false, false, DialOptions{})
+	if err != nil {
+		t.Fatalf("NewRabbitMQClient: %v", err)
+	}
+	t.Cleanup(func() {
+		if ch, err := client.current().conn.Channel(); err == nil {
+			for _, q := range queues {
+				ch.QueueDelete(q, false, false, false)
+			}
+			ch.ExchangeDelete(client.exchange, false, false)
+			ch.Close()
+		}
+		client.Close()
+	})
+	return client
+}
+
+func TestOutboxDrainsAfterReconnect(t *testing.T) {
+	client := testClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Drop the connection out from under the client
+	client.current().conn.Close()
+
+	err := client.Publish(ctx, "email", map[string]string{"notification_id": "n1"})
+	if !ShouldStore(err) {
+		t.Fatalf("Publish after connection loss = %v, want a storable error", err)
+	}
+
+	store := &memOutboxStore{}
+	published := make(chan string, 1)
+	outbox := NewOutbox(client, store)
+	outbox.OnPublished(func(_ context.Context, id string) { published <- id })
+	if err := outbox.Enqueue(ctx, "n1", "email", map[string]string{"notification_id": "n1"}); err != nil {
+		t.Fatal(err)
+	}
+	go outbox.Run(ctx)
+
+	select {
+	case id := <-published:
+		if id != "n1" {
+			t.Errorf("published %s, want n1", id)
+		}
+	case <-ctx.Done():
+		t.Fatal("outbox did not drain after the client reconnected")
+	}
+	if n := store.len(); n != 0 {
+		t.Errorf("outbox still holds %d entries", n)
+	}
+	if err := client.HealthCheck(); err != nil {
+		t.Errorf("HealthCheck after reconnect = %v", err)
+	}
+}
+
+func TestPublishReportsClosedClient(t *testing.T) {
+	client := testClient(t)
+	client.Close()
+
+	err := client.Publish(context.Background(), "email", map[string]string{})
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Publish after Close = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestDialOrder(t *testing.T) {
+	tests := []struct {
+		n, start int
+		want     []int
+	}{
+		{n: 1, start: 0, want: []int{0}},
+		{n: 3, start: 0, want: []int{0, 1, 2}},
+		{n: 3, start: 1, want: []int{1, 2, 0}},
+		{n: 3, start: 2, want: []int{2, 0, 1}},
+	}
+	for _, tt := range tests {
+		if got := dialOrder(tt.n, tt.start); !slices.Equal(got, tt.want) {
+			t.Errorf("dialOrder(%d, %d) = %v, want %v", tt.n, tt.start, got, tt.want)
+		}
+	}
+}
+
+func TestSyncReturnsMarksBufferedReturns(t *testing.T) {
+	tests := []struct {
+		name         string
+		returned     []string
+		pending      string
+		wantReturned bool
+	}{
+		{name: "returned before ack", returned: []string{"m1"}, pending: "m1", wantReturned: true},
+		{name: "other message returned", returned: []string{"m2"}, pending: "m1", wantReturned: false},
+		{name: "nothing returned", pending: "m1", wantReturned: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &RabbitMQClient{returned: make(map[string]bool)}
+			s := &session{returnSync: make(chan chan struct{}), returnsDone: make(chan struct{})}
+			returns := make(chan amqp.Return, 16)
+			go client.watchReturns(s, returns)
+			defer close(returns)
+
+			// Repeated so a sync answered before the buffer is drained
+			// would show up
+			for i := 0; i < 100; i++ {
+				client.returnedMu.Lock()
+				client.returned[tt.pending] = false
+				client.returnedMu.Unlock()
+				for _, id := range tt.returned {
+					returns <- amqp.Return{MessageId: id}
+				}
+
+				if err := s.syncReturns(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if got := client.takeReturned(tt.pending); got != tt.wantReturned {
+					t.Fatalf("iteration %d: returned = %v, want %v", i, got, tt.wantReturned)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncReturnsAfterChannelClosed(t *testing.T) {
+	client := &RabbitMQClient{returned: map[string]bool{"m1": false}}
+	s := &session{returnSync: make(chan chan struct{}), returnsDone: make(chan struct{})}
+	returns := make(chan amqp.Return, 1)
+	returns <- amqp.Return{MessageId: "m1"}
+	close(returns)
+	go client.watchReturns(s, returns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.syncReturns(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !client.takeReturned("m1") {
+		t.Error("return buffered before the channel closed was not marked")
+	}
+}
+
+func TestCompressBody(t *testing.T) {
+	small := []byte(`{"notification_id":"n1"}`)
+	large := []byte(`{"variables":{"body":"` + strings.Repeat("lorem ipsum ", 200) + `"}}`)
+
+	tests := []struct {
+		name         string
+		body         []byte
+		threshold    int
+		wantEncoding string
+	}{
+		{name: "disabled", body: large, threshold: 0, wantEncoding: "utf-8"},
+		{name: "below threshold", body: small, threshold: 1024, wantEncoding: "utf-8"},
+		{name: "at threshold", body: small, threshold: len(small), wantEncoding: "utf-8"},
+		{name: "above threshold", body: large, threshold: 1024, wantEncoding: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, encoding, err := compressBody(tt.body, tt.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoding != tt.wantEncoding {
+				t.Fatalf("encoding = %q, want %q", encoding, tt.wantEncoding)
+			}
+			if encoding == "utf-8" {
+				if !bytes.Equal(got, tt.body) {
+					t.Errorf("uncompressed body changed: %s", got)
+				}
+				return
+			}
+			if len(got) >= len(tt.body) {
+				t.Errorf("compressed %d bytes to %d", len(tt.body), len(got))
+			}
+			inflated, err := gunzipBody(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(inflated, tt.body) {
+				t.Errorf("round trip = %s, want %s", inflated, tt.body)
+			}
+		})
+	}
+}
+
+func TestPublishCompressesLargeMessages(t *testing.T) {
+	client := testClient(t)
+	client.SetCompressionThreshold(512)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	small := map[string]string{"notification_id": "small"}
+	large := map[string]string{"notification_id": "large", "body": strings.Repeat("lorem ipsum ", 200)}
+	for _, message := range []map[string]string{small, large} {
+		if err := client.Publish(ctx, "email", message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch, err := client.current().conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Close()
+	for _, want := range []struct {
+		id       string
+		encoding string
+	}{{"small", "utf-8"}, {"large", "gzip"}} {
+		delivery, ok, err := ch.Get(client.emailQueue, true)
+		if err != nil || !ok {
+			t.Fatalf("Get = %v, %v", ok, err)
+		}
+		if delivery.ContentEncoding != want.encoding {
+			t.Errorf("%s: ContentEncoding = %q, want %q", want.id, delivery.ContentEncoding, want.encoding)
+		}
+		body := delivery.Body
+		if want.encoding == "gzip" {
+			if delivery.Headers["compression"] != "application/x-gzip" {
+				t.Errorf("%s: compression header = %v", want.id, delivery.Headers["compression"])
+			}
+			if body, err = gunzipBody(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var task struct {
+			Args []map[string]string `json:"args"`
+		}
+		if err := json.Unmarshal(body, &task); err != nil {
+			t.Fatalf("%s: decode %s: %v", want.id, body, err)
+		}
+		if len(task.Args) != 1 || task.Args[0]["notification_id"] != want.id {
+			t.Errorf("%s: task args = %v", want.id, task.Args)
+		}
+	}
+}
+
+func TestPublishUsesUniqueMessageIDs(t *testing.T) {
+	client := testClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const messages = 20
+	errs := make(chan error, messages)
+	for range messages {
+		go func() { errs <- client.Publish(ctx, "email", map[string]string{"notification_id": "n1"}) }()
+	}
+	for range messages {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch, err := client.current().conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Close()
+	seen := map[string]bool{}
+	for range messages {
+		delivery, ok, err := ch.Get(client.emailQueue, true)
+		if err != nil || !ok {
+			t.Fatalf("Get = %v, %v", ok, err)
+		}
+		if _, err := uuid.Parse(delivery.MessageId); err != nil {
+			t.Errorf("MessageId %q is not a UUID", delivery.MessageId)
+		}
+		if seen[delivery.MessageId] {
+			t.Errorf("MessageId %s used twice", delivery.MessageId)
+		}
+		seen[delivery.MessageId] = true
+	}
+}
+
+func TestFlowPaused(t *testing.T) {
+	client := &RabbitMQClient{}
+	flows := make(chan bool)
+	blockings := make(chan amqp.Blocking)
+	flowDone, blockedDone := make(chan struct{}), make(chan struct{})
+	go func() { client.watchFlow(flows); close(flowDone) }()
+	go func() { client.watchBlocked(blockings); close(blockedDone) }()
+
+	steps := []struct {
+		name string
+		send func()
+		want string
+	}{
+		{name: "initially", send: func() {}, want: ""},
+		{name: "flow off", send: func() { flows <- false }, want: "channel flow stopped"},
+		{name: "blocked while flow off", send: func() { blockings <- amqp.Blocking{Active: true, Reason: "low on memory"} }, want: "connection blocked: low on memory"},
+		{name: "flow on while blocked", send: func() { flows <- true }, want: "connection blocked: low on memory"},
+		{name: "unblocked", send: func() { blockings <- amqp.Blocking{Active: false} }, want: ""},
+	}
+	for _, step := range steps {
+		step.send()
+		// The watchers apply a value just after receiving it
+		deadline := time.Now().Add(time.Second)
+		for client.FlowPaused() != step.want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if got := client.FlowPaused(); got != step.want {
+			t.Errorf("%s: FlowPaused = %q, want %q", step.name, got, step.want)
+		}
+	}
+	close(flows)
+	close(blockings)
+	<-flowDone
+	<-blockedDone
+}
+
+func TestClassifyPublishError(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want error
+	}{
+		{name: "deadline", ctx: context.Background(), err: context.DeadlineExceeded, want: ErrPublishTimeout},
+		{name: "expired context", ctx: expired, err: errors.New("write: broken pipe"), want: ErrPublishTimeout},
+		{name: "closed channel", ctx: context.Background(), err: amqp.ErrClosed, want: ErrNotConnected},
+		{name: "wrapped closed channel", ctx: context.Background(), err: fmt.Errorf("publish: %w", amqp.ErrClosed), want: ErrNotConnected},
+		{name: "anything else", ctx: context.Background(), err: errors.New("PRECONDITION_FAILED"), want: ErrPublishRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyPublishError(tt.ctx, tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("classifyPublishError = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(got.Error(), tt.err.Error()) {
+				t.Errorf("classifyPublishError = %v, lost the cause %v", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestPublishWithoutSessionReportsNotConnected(t *testing.T) {
+	client := &RabbitMQClient{}
+	if err := client.HealthCheck(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("HealthCheck = %v, want ErrNotConnected", err)
+	}
+	if err := client.Publish(context.Background(), "email", map[string]string{}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Publish = %v, want ErrNotConnected", err)
+	}
+}
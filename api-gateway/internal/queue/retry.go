@@ -0,0 +1,288 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	headerLeaseID    = "x-lease-id"
+	headerRetryCount = "x-retry-count"
+)
+
+// consumerReopenDelay paces reopening a consumer channel after it closes,
+// giving the client time to reconnect
+const consumerReopenDelay = 5 * time.Second
+
+// LeaseStore records which leased messages have been completed so a lease
+// copy that reappears after its visibility timeout can be discarded.
+type LeaseStore interface {
+	CompleteLease(ctx context.Context, leaseID string, ttl time.Duration) error
+	IsLeaseCompleted(ctx context.Context, leaseID string) (bool, error)
+}
+
+// MessageHandler processes a single message body. A non-nil error leaves the
+// lease open so the message reappears once the visibility timeout elapses.
+type MessageHandler func(ctx context.Context, body []byte) error
+
+type RetryConsumerConfig struct {
+	Queue             string
+	RoutingKey        string
+	VisibilityTimeout time.Duration
+	MaxRetries        int
+}
+
+// RetryConsumer consumes a work queue with SQS-like visibility timeouts.
+//
+// Every delivery is "leased" by publishing a copy to <queue>.retry with a
+// per-message TTL equal to the visibility timeout. The retry queue dead-letters
+// expired copies back to the exchange, so a message that is not completed in
+// time (handler error, crash, lost consumer) reappears on the work queue.
+// Completed leases are recorded in the LeaseStore and their copies dropped.
+type RetryConsumer struct {
+	client     *RabbitMQClient
+	channel    *amqp.Channel
+	cfg        RetryConsumerConfig
+	leases     LeaseStore
+	retryQueue string
+}
+
+func (c *RabbitMQClient) NewRetryConsumer(cfg RetryConsumerConfig, leases LeaseStore) (*RetryConsumer, error) {
+	if cfg.VisibilityTimeout <= 0 {
+		return nil, fmt.Errorf("visibility timeout must be positive")
+	}
+
+	rc := &RetryConsumer{
+		client:     c,
+		cfg:        cfg,
+		leases:     leases,
+		retryQueue: cfg.Queue + ".retry",
+	}
+	if err := rc.open(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// open opens the consumer channel on the client's current connection and
+// declares the queues, replacing any previous channel.
+func (rc *RetryConsumer) open() error {
+	if rc.channel != nil {
+		rc.channel.Close()
+	}
+	s := rc.client.current()
+	channel, err := s.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open consumer channel: %w", err)
+	}
+
+	// The work queue itself is declared and bound so dedicated consumer
+	// queues (e.g. inbound events) don't need separate setup
+	if _, err := channel.QueueDeclare(rc.cfg.Queue, true, false, false, false, nil); err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to declare queue %s: %w", rc.cfg.Queue, err)
+	}
+	if err := channel.QueueBind(rc.cfg.Queue, rc.cfg.RoutingKey, s.exchange, false, nil); err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to bind queue %s: %w", rc.cfg.Queue, err)
+	}
+
+	_, err = channel.QueueDeclare(
+		rc.retryQueue,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{
+			"x-dead-letter-exchange":    s.exchange,
+			"x-dead-letter-routing-key": rc.cfg.RoutingKey,
+		},
+	)
+	if err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to declare retry queue %s: %w", rc.retryQueue, err)
+	}
+
+	rc.channel = channel
+	return nil
+}
+
+// Consume blocks, dispatching deliveries to handler until ctx is cancelled.
+// When the delivery channel closes, as it does when the broker connection
+// drops, the consumer channel is reopened once the client has reconnected.
+func (rc *RetryConsumer) Consume(ctx context.Context, handler MessageHandler) error {
+	for {
+		err := rc.consume(ctx, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Consumer for %s stopped, reopening: %v", rc.cfg.Queue, err)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(consumerReopenDelay):
+			}
+			if err := rc.open(); err != nil {
+				log.Printf("Failed to reopen consumer for %s, retrying in %s: %v", rc.cfg.Queue, consumerReopenDelay, err)
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (rc *RetryConsumer) consume(ctx context.Context, handler MessageHandler) error {
+	deliveries, err := rc.channel.Consume(
+		rc.cfg.Queue,
+		"",
+		false, // manual ack
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to consume from %s: %w", rc.cfg.Queue, err)
+	}
+
+	log.Printf("✓ Consuming %s with %s visibility timeout", rc.cfg.Queue, rc.cfg.VisibilityTimeout)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return fmt.Errorf("delivery channel for %s closed", rc.cfg.Queue)
+			}
+			rc.handle(ctx, d, handler)
+		}
+	}
+}
+
+func (rc *RetryConsumer) handle(ctx context.Context, d amqp.Delivery, handler MessageHandler) {
+	leaseID, _ := d.Headers[headerLeaseID].(string)
+	attempt := headerInt(d.Headers, headerRetryCount)
+
+	if leaseID != "" {
+		completed, err := rc.leases.IsLeaseCompleted(ctx, leaseID)
+		if err != nil {
+			log.Printf("Failed to check lease %s: %v", leaseID, err)
+		}
+		if completed {
+			d.Ack(false)
+			return
+		}
+		// The lease expired without completion, this is a redelivery
+		attempt++
+	} else {
+		leaseID = uuid.New().String()
+	}
+
+	if attempt > rc.cfg.MaxRetries {
+		rc.park(ctx, d, leaseID, attempt)
+		return
+	}
+
+	if err := rc.lease(ctx, d, leaseID, attempt); err != nil {
+		log.Printf("Failed to lease message %s: %v", leaseID, err)
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+
+	if err := handler(ctx, d.Body); err != nil {
+		log.Printf("Handler failed for message %s (attempt %d), redelivering after %s: %v",
+			leaseID, attempt, rc.cfg.VisibilityTimeout, err)
+		return
+	}
+
+	if err := rc.leases.CompleteLease(ctx, leaseID, 2*rc.cfg.VisibilityTimeout); err != nil {
+		log.Printf("Failed to complete lease %s: %v", leaseID, err)
+	}
+}
+
+// lease publishes the visibility copy that reappears on the work queue when
+// its TTL expires.
+func (rc *RetryConsumer) lease(ctx context.Context, d amqp.Delivery, leaseID string, attempt int) error {
+	return rc.channel.PublishWithContext(
+		ctx,
+		"",
+		rc.retryQueue,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			Body:            d.Body,
+			DeliveryMode:    amqp.Persistent,
+			Timestamp:       time.Now(),
+			Expiration:      strconv.FormatInt(rc.cfg.VisibilityTimeout.Milliseconds(), 10),
+			Headers:         leaseHeaders(d.Headers, leaseID, attempt),
+		},
+	)
+}
+
+// park moves a message that exhausted its retries to the failed queue.
+func (rc *RetryConsumer) park(ctx context.Context, d amqp.Delivery, leaseID string, attempt int) {
+	err := rc.channel.PublishWithContext(
+		ctx,
+		"",
+		rc.client.failedQueue,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			Body:            d.Body,
+			DeliveryMode:    amqp.Persistent,
+			Timestamp:       time.Now(),
+			Headers:         leaseHeaders(d.Headers, leaseID, attempt),
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to park message %s: %v", leaseID, err)
+		d.Nack(false, true)
+		return
+	}
+
+	log.Printf("Message %s exceeded %d retries, moved to %s", leaseID, rc.cfg.MaxRetries, rc.client.failedQueue)
+	d.Ack(false)
+}
+
+func (rc *RetryConsumer) Close() error {
+	return rc.channel.Close()
+}
+
+func leaseHeaders(src amqp.Table, leaseID string, attempt int) amqp.Table {
+	headers := amqp.Table{}
+	for k, v := range src {
+		headers[k] = v
+	}
+	headers[headerLeaseID] = leaseID
+	headers[headerRetryCount] = int32(attempt)
+	return headers
+}
+
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
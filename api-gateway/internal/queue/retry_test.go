@@ -0,0 +1,200 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const testVisibilityTimeout = 500 * time.Millisecond
+
+// memLeaseStore is an in-memory LeaseStore
+type memLeaseStore struct {
+	mu        sync.Mutex
+	completed map[string]bool
+}
+
+func (s *memLeaseStore) CompleteLease(_ context.Context, leaseID string, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.completed == nil {
+		s.completed = make(map[string]bool)
+	}
+	s.completed[leaseID] = true
+	return nil
+}
+
+func (s *memLeaseStore) IsLeaseCompleted(_ context.Context, leaseID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.completed[leaseID], nil
+}
+
+// testRetryConsumer declares a throwaway work queue on client and returns a
+// consumer for it, deleting the queue and its retry queue afterwards
+func testRetryConsumer(t *testing.T, client *RabbitMQClient, leases LeaseStore, maxRetries int) *RetryConsumer {
+	t.Helper()
+	name := "work.test." + uuid.New().String()[:8]
+	rc, err := client.NewRetryConsumer(RetryConsumerConfig{
+		Queue:             name,
+		RoutingKey:        name,
+		VisibilityTimeout: testVisibilityTimeout,
+		MaxRetries:        maxRetries,
+	}, leases)
+	if err != nil {
+		t.Fatalf("NewRetryConsumer: %v", err)
+	}
+	t.Cleanup(func() {
+		if ch, err := client.current().conn.Channel(); err == nil {
+			ch.QueueDelete(name, false, false, false)
+			ch.QueueDelete(name+".retry", false, false, false)
+			ch.Close()
+		}
+	})
+	return rc
+}
+
+func TestRetryConsumerRedeliversAfterLostConsumer(t *testing.T) {
+	client := testClient(t)
+	leases := &memLeaseStore{}
+	lost := testRetryConsumer(t, client, leases, 3)
+
+	// The first consumer takes the message and disappears without finishing
+	received := make(chan struct{}, 1)
+	lostCtx, loseConsumer := context.WithCancel(context.Background())
+	go lost.Consume(lostCtx, func(ctx context.Context, _ []byte) error {
+		received <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.Publish(ctx, lost.cfg.RoutingKey, map[string]string{"notification_id": "n1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-ctx.Done():
+		t.Fatal("first consumer never received the message")
+	}
+	leasedAt := time.Now()
+	loseConsumer()
+	lost.Close()
+
+	// A second consumer only sees it again once the lease expires
+	second, err := client.NewRetryConsumer(lost.cfg, leases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	redelivered := make(chan time.Time, 1)
+	go second.Consume(ctx, func(context.Context, []byte) error {
+		redelivered <- time.Now()
+		return nil
+	})
+
+	select {
+	case at := <-redelivered:
+		if waited := at.Sub(leasedAt); waited < testVisibilityTimeout {
+			t.Errorf("redelivered after %s, before the %s visibility timeout", waited, testVisibilityTimeout)
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not redelivered after the visibility timeout")
+	}
+}
+
+func TestRetryConsumerRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		maxRetries   int
+		wantAttempts int32
+		wantParked   bool
+	}{
+		{name: "completed first time", maxRetries: 3, wantAttempts: 1},
+		{name: "completed on redelivery", failures: 1, maxRetries: 3, wantAttempts: 2},
+		{name: "parked after max retries", failures: 10, maxRetries: 1, wantAttempts: 2, wantParked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testClient(t)
+			rc := testRetryConsumer(t, client, &memLeaseStore{}, tt.maxRetries)
+			defer rc.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			var attempts atomic.Int32
+			go rc.Consume(ctx, func(context.Context, []byte) error {
+				if int(attempts.Add(1)) <= tt.failures {
+					return errors.New("handler failed")
+				}
+				return nil
+			})
+			if err := client.Publish(ctx, rc.cfg.RoutingKey, map[string]string{"notification_id": "n1"}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Long enough for every expected lease to expire, plus one more
+			// to catch a completed lease that still reappears
+			time.Sleep(time.Duration(tt.wantAttempts+1)*testVisibilityTimeout + time.Second)
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("handler ran %d times, want %d", got, tt.wantAttempts)
+			}
+
+			ch, err := client.current().conn.Channel()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ch.Close()
+			parked, ok, err := ch.Get(client.failedQueue, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantParked {
+				t.Fatalf("parked = %v, want %v", ok, tt.wantParked)
+			}
+			if ok && headerInt(parked.Headers, headerRetryCount) != tt.maxRetries+1 {
+				t.Errorf("parked with retry count %v, want %d", parked.Headers[headerRetryCount], tt.maxRetries+1)
+			}
+		})
+	}
+}
+
+func TestLeaseHeaders(t *testing.T) {
+	src := amqp.Table{"x-trace": "abc", headerRetryCount: int64(1)}
+	headers := leaseHeaders(src, "lease-1", 2)
+
+	if headers["x-trace"] != "abc" || headers[headerLeaseID] != "lease-1" || headerInt(headers, headerRetryCount) != 2 {
+		t.Errorf("leaseHeaders = %v", headers)
+	}
+	if _, ok := src[headerLeaseID]; ok || headerInt(src, headerRetryCount) != 1 {
+		t.Errorf("leaseHeaders modified its source: %v", src)
+	}
+}
+
+func TestHeaderInt(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int
+	}{
+		{int(3), 3},
+		{int16(3), 3},
+		{int32(3), 3},
+		{int64(3), 3},
+		{"3", 0},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := headerInt(amqp.Table{"n": tt.value}, "n"); got != tt.want {
+			t.Errorf("headerInt(%T %v) = %d, want %d", tt.value, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+const (
+	schedulerTickInterval = time.Second
+	schedulerBatchSize    = 100
+	// retryAlertTTL outlives every retry of a notification, so its
+	// threshold alert is recorded once
+	retryAlertTTL = 24 * time.Hour
+	// schedulerLease is how long a claimed batch stays hidden from other
+	// schedulers. Entries a crashed scheduler never completed become due
+	// again once it passes.
+	schedulerLease = 5 * time.Minute
+)
+
+// RetryStore holds scheduled retries ordered by due time.
+type RetryStore interface {
+	// ScheduleRetry adds entry due at at, or moves it there if it is
+	// already scheduled.
+	ScheduleRetry(ctx context.Context, entry string, at time.Time) error
+	// ClaimDueRetries atomically returns entries due by now and pushes
+	// their due time out by lease, so concurrent schedulers never take the
+	// same entry and a claim that is never completed isn't lost.
+	ClaimDueRetries(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]string, error)
+	// CompleteRetry removes a claimed entry once it has been handled.
+	CompleteRetry(ctx context.Context, entry string) error
+	// ParkRetry keeps entries that exhausted their retries for inspection.
+	ParkRetry(ctx context.Context, entry string) error
+	// MarkRetryAlerted records that a notification raised its retry alert.
+	// It returns false when one was already recorded.
+	MarkRetryAlerted(ctx context.Context, notificationID string, ttl time.Duration) (bool, error)
+}
+
+type RetryEntry struct {
+	RoutingKey string                     `json:"routing_key"`
+	Message    models.NotificationMessage `json:"message"`
+	LastError  string                     `json:"last_error,omitempty"`
+}
+
+// RetryScheduler re-publishes failed notifications after an exponential
+// backoff tracked in Redis rather than in the broker.
+type RetryScheduler struct {
+	client    *RabbitMQClient
+	publisher Publisher
+	store     RetryStore
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// alertThreshold is the retry count that raises an alert; 0 disables
+	alertThreshold int
+}
+
+func NewRetryScheduler(client *RabbitMQClient, store RetryStore, baseDelay, maxDelay time.Duration) *RetryScheduler {
+	return &RetryScheduler{
+		client:    client,
+		publisher: client,
+		store:     store,
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+	}
+}
+
+// SetAlertThreshold raises an alert for notifications that fail again after
+// threshold retries. 0 disables.
+func (s *RetryScheduler) SetAlertThreshold(threshold int) {
+	s.alertThreshold = threshold
+}
+
+// Schedule queues msg for another attempt, or parks it once MaxRetries is
+// reached.
+func (s *RetryScheduler) Schedule(ctx context.Context, routingKey string, msg models.NotificationMessage, lastErr string) error {
+	entry, err := json.Marshal(RetryEntry{RoutingKey: routingKey, Message: msg, LastError: lastErr})
+	if err != nil {
+		return fmt.Errorf("failed to marshal retry entry: %w", err)
+	}
+
+	if s.alertThreshold > 0 && msg.RetryCount >= s.alertThreshold {
+		s.alert(ctx, routingKey, msg, lastErr)
+	}
+
+	maxRetries := msg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = models.DefaultMaxRetries
+	}
+	if msg.RetryCount >= maxRetries {
+		log.Printf("Notification %s exhausted %d retries, parking", msg.NotificationID, maxRetries)
+		return s.store.ParkRetry(ctx, string(entry))
+	}
+
+	at := time.Now().Add(s.backoff(msg.RetryCount))
+	if err := s.store.ScheduleRetry(ctx, string(entry), at); err != nil {
+		return fmt.Errorf("failed to schedule retry: %w", err)
+	}
+
+	log.Printf("Notification %s retry %d/%d scheduled for %s", msg.NotificationID, msg.RetryCount+1, maxRetries, at.Format(time.RFC3339))
+	return nil
+}
+
+// alert logs and counts a notification that reached the alert threshold,
+// once per notification however many more times it fails
+func (s *RetryScheduler) alert(ctx context.Context, routingKey string, msg models.NotificationMessage, lastErr string) {
+	first, err := s.store.MarkRetryAlerted(ctx, msg.NotificationID, retryAlertTTL)
+	if err != nil {
+		// A repeated alert beats a missed one
+		log.Printf("Failed to record retry alert for %s: %v", msg.NotificationID, err)
+	} else if !first {
+		return
+	}
+
+	metrics.RetryAlerts.WithLabelValues(metrics.RetryAlertTemplates.Label(msg.TemplateID)).Inc()
+	slog.Warn("Notification reached retry alert threshold",
+		"event", "retry_threshold_reached",
+		"notification_id", msg.NotificationID,
+		"template_id", msg.TemplateID,
+		"routing_key", routingKey,
+		"retry_count", msg.RetryCount,
+		"threshold", s.alertThreshold,
+		"last_error", lastErr)
+}
+
+func (s *RetryScheduler) backoff(retryCount int) time.Duration {
+	delay := s.baseDelay
+	for i := 0; i < retryCount && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.maxDelay)
+}
+
+// Run publishes due retries every tick until ctx is cancelled.
+func (s *RetryScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.publishDue(ctx)
+		}
+	}
+}
+
+// publishDue claims a batch of due entries and completes each one only
+// after it has been published or parked. If the scheduler dies mid-batch,
+// the rest become due again when their lease runs out.
+func (s *RetryScheduler) publishDue(ctx context.Context) {
+	entries, err := s.store.ClaimDueRetries(ctx, time.Now(), schedulerLease, schedulerBatchSize)
+	if err != nil {
+		log.Printf("Failed to claim due retries: %v", err)
+		return
+	}
+
+	for i, raw := range entries {
+		// DecodeJSON keeps large integers in variables exact across retries
+		var entry RetryEntry
+		if err := models.DecodeJSON([]byte(raw), &entry); err != nil {
+			log.Printf("Parking malformed retry entry: %v", err)
+			if err := s.store.ParkRetry(ctx, raw); err != nil {
+				log.Printf("Failed to park malformed retry entry, it stays leased: %v", err)
+				continue
+			}
+			s.complete(ctx, raw)
+			continue
+		}
+
+		entry.Message.RetryCount++
+		if err := s.publisher.Publish(ctx, entry.RoutingKey, entry.Message); err != nil {
+			// Broker trouble is not the notification's fault, so retry the
+			// unchanged entries without spending an attempt, and don't wait
+			// on the broker for the rest of the batch
+			log.Printf("Retry publish failed for %s, rescheduling %d entries: %v", entry.Message.NotificationID, len(entries)-i, err)
+			s.reschedule(ctx, entries[i:])
+			return
+		}
+		s.complete(ctx, raw)
+	}
+}
+
+func (s *RetryScheduler) complete(ctx context.Context, raw string) {
+	if err := s.store.CompleteRetry(ctx, raw); err != nil {
+		// The entry was handled, but will be published again once its
+		// lease runs out
+		log.Printf("Failed to complete retry entry: %v", err)
+	}
+}
+
+func (s *RetryScheduler) reschedule(ctx context.Context, entries []string) {
+	at := time.Now().Add(s.baseDelay)
+	for _, raw := range entries {
+		if err := s.store.ScheduleRetry(ctx, raw, at); err != nil {
+			log.Printf("Failed to reschedule retry entry, it stays leased until %s: %v", time.Now().Add(schedulerLease).Format(time.RFC3339), err)
+		}
+	}
+}
+
+// ConsumeFailed schedules messages arriving on the failed queue until ctx is
+// cancelled, reopening its channel when the broker connection drops.
+func (s *RetryScheduler) ConsumeFailed(ctx context.Context) error {
+	for {
+		err := s.consumeFailed(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Failed-queue consumer stopped, reopening in %s: %v", consumerReopenDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(consumerReopenDelay):
+		}
+	}
+}
+
+func (s *RetryScheduler) consumeFailed(ctx context.Context) error {
+	channel, err := s.client.current().conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open failed-queue channel: %w", err)
+	}
+	defer channel.Close()
+
+	deliveries, err := channel.Consume(s.client.failedQueue, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to consume from %s: %w", s.client.failedQueue, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return fmt.Errorf("delivery channel for %s closed", s.client.failedQueue)
+			}
+			s.handleFailed(ctx, d)
+		}
+	}
+}
+
+func (s *RetryScheduler) handleFailed(ctx context.Context, d amqp.Delivery) {
+	msg, lastErr, err := DecodeFailedMessage(d.Body)
+	if err != nil {
+		log.Printf("Parking undecodable failed message: %v", err)
+		if err := s.store.ParkRetry(ctx, string(d.Body)); err != nil {
+			d.Nack(false, true)
+			return
+		}
+		d.Ack(false)
+		return
+	}
+	if IsPermanentFailure(d.Body) {
+		// Another attempt would fail the same way
+		log.Printf("Parking %s, its failure is permanent: %s", msg.NotificationID, lastErr)
+		if err := s.store.ParkRetry(ctx, string(d.Body)); err != nil {
+			d.Nack(false, true)
+			return
+		}
+		d.Ack(false)
+		return
+	}
+
+	if err := s.Schedule(ctx, string(msg.Type), msg, lastErr); err != nil {
+		log.Printf("Failed to schedule retry for %s: %v", msg.NotificationID, err)
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+// IsPermanentFailure reports whether a worker marked a failed-queue message
+// with "permanent": true, meaning a retry can't succeed (e.g. an invalid
+// address or device token).
+func IsPermanentFailure(body []byte) bool {
+	var wrapper struct {
+		Permanent bool `json:"permanent"`
+	}
+	return json.Unmarshal(body, &wrapper) == nil && wrapper.Permanent
+}
+
+// DecodeFailedMessage extracts the notification from the shapes workers put
+// on the failed queue: a {"original_payload", "error"} wrapper, a Celery task
+// envelope, or the bare message.
+func DecodeFailedMessage(body []byte) (models.NotificationMessage, string, error) {
+	var wrapper struct {
+		OriginalPayload json.RawMessage   `json:"original_payload"`
+		Error           string            `json:"error"`
+		Args            []json.RawMessage `json:"args"`
+	}
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		return models.NotificationMessage{}, "", fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	payload := json.RawMessage(body)
+	switch {
+	case len(wrapper.OriginalPayload) > 0:
+		payload = wrapper.OriginalPayload
+	case len(wrapper.Args) > 0:
+		payload = wrapper.Args[0]
+	}
+
+	// A wrapped payload may itself be a Celery envelope
+	var envelope struct {
+		Args []json.RawMessage `json:"args"`
+	}
+	if json.Unmarshal(payload, &envelope) == nil && len(envelope.Args) > 0 {
+		payload = envelope.Args[0]
+	}
+
+	var msg models.NotificationMessage
+	if err := models.DecodeJSON(payload, &msg); err != nil {
+		return models.NotificationMessage{}, "", fmt.Errorf("invalid notification payload: %w", err)
+	}
+	if msg.NotificationID == "" || msg.Type == "" {
+		return models.NotificationMessage{}, "", fmt.Errorf("payload is missing notification_id or type")
+	}
+	return msg, wrapper.Error, nil
+}
@@ -0,0 +1,323 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+const (
+	testScheduledKey = "retry:scheduled"
+	testParkedKey    = "retry:parked"
+)
+
+// testRetryScheduler wires a scheduler to miniredis, publishing through
+// publisher
+func testRetryScheduler(t *testing.T, publisher Publisher) (*RetryScheduler, *cache.RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisClient, err := cache.NewRedisClient("redis://"+mr.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewRetryScheduler(&RabbitMQClient{}, redisClient, time.Minute, time.Hour)
+	s.publisher = publisher
+	return s, redisClient, mr
+}
+
+func retryEntry(t *testing.T, msg models.NotificationMessage) string {
+	t.Helper()
+	entry, err := json.Marshal(RetryEntry{RoutingKey: string(msg.Type), Message: msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(entry)
+}
+
+// ackRecorder is an amqp.Acknowledger remembering the last outcome
+type ackRecorder struct {
+	outcome string
+}
+
+func (a *ackRecorder) Ack(uint64, bool) error        { a.outcome = "ack"; return nil }
+func (a *ackRecorder) Nack(uint64, bool, bool) error { a.outcome = "nack"; return nil }
+func (a *ackRecorder) Reject(uint64, bool) error     { a.outcome = "reject"; return nil }
+
+func TestPublishDue(t *testing.T) {
+	msg := models.NotificationMessage{NotificationID: "n1", Type: models.NotificationTypeEmail, RetryCount: 1}
+
+	tests := []struct {
+		name          string
+		entry         string
+		failures      int
+		wantPublished []string
+		wantScheduled bool
+		wantParked    bool
+	}{
+		{name: "published and completed", entry: retryEntry(t, msg), wantPublished: []string{"email"}},
+		{name: "broker down", entry: retryEntry(t, msg), failures: 1, wantScheduled: true},
+		{name: "malformed entry parked", entry: "{not json", wantParked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &flakyPublisher{failures: tt.failures, err: fmt.Errorf("%w: connection is closed", ErrNotConnected)}
+			s, redisClient, mr := testRetryScheduler(t, publisher)
+			ctx := context.Background()
+			if err := redisClient.ScheduleRetry(ctx, tt.entry, time.Now().Add(-time.Second)); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			s.publishDue(ctx)
+
+			if !slices.Equal(publisher.published, tt.wantPublished) {
+				t.Errorf("published %v, want %v", publisher.published, tt.wantPublished)
+			}
+			scheduled, _ := mr.ZMembers(testScheduledKey)
+			if got := len(scheduled) == 1; got != tt.wantScheduled {
+				t.Fatalf("scheduled = %v, want entry scheduled %v", scheduled, tt.wantScheduled)
+			}
+			if tt.wantScheduled {
+				// Rescheduled unchanged, after the base delay rather than
+				// the lease
+				if scheduled[0] != tt.entry {
+					t.Errorf("rescheduled %s, want the unchanged %s", scheduled[0], tt.entry)
+				}
+				score, _ := mr.ZScore(testScheduledKey, tt.entry)
+				due := time.UnixMilli(int64(score))
+				// Scores are in whole milliseconds
+				if due.Before(start.Add(s.baseDelay-time.Millisecond)) || due.After(time.Now().Add(s.baseDelay)) {
+					t.Errorf("rescheduled for %s, want about %s from now", time.Until(due).Round(time.Second), s.baseDelay)
+				}
+			}
+			parked, _ := mr.List(testParkedKey)
+			if got := len(parked) == 1; got != tt.wantParked {
+				t.Errorf("parked = %v, want entry parked %v", parked, tt.wantParked)
+			}
+		})
+	}
+}
+
+func TestClaimDueRetriesLeases(t *testing.T) {
+	_, redisClient, _ := testRetryScheduler(t, &flakyPublisher{})
+	ctx := context.Background()
+	now := time.Now()
+
+	due := "due"
+	later := "later"
+	if err := redisClient.ScheduleRetry(ctx, due, now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisClient.ScheduleRetry(ctx, later, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want []string
+	}{
+		{name: "due entry claimed", at: now, want: []string{due}},
+		{name: "claimed entry hidden", at: now.Add(time.Second)},
+		{name: "lease ran out", at: now.Add(schedulerLease), want: []string{due}},
+	}
+	// Steps run in order, each against the previous one's state
+	for _, tt := range tests {
+		got, err := redisClient.ClaimDueRetries(ctx, tt.at, schedulerLease, schedulerBatchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: claimed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := redisClient.CompleteRetry(ctx, due); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := redisClient.ClaimDueRetries(ctx, now.Add(2*time.Hour), schedulerLease, schedulerBatchSize); !slices.Equal(got, []string{later}) {
+		t.Errorf("after completion claimed %v, want only %s", got, later)
+	}
+}
+
+func TestPublishDueKeepsLargeIntegers(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{
+			name:  "int64 id",
+			entry: `{"routing_key":"email","message":{"notification_id":"n1","type":"email","variables":{"order_id":9007199254740993}}}`,
+		},
+		{
+			name:  "nested amount",
+			entry: `{"routing_key":"push","message":{"notification_id":"n2","type":"push","variables":{"order":{"order_id":12345678901234567890}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &recordingPublisher{}
+			s, redisClient, _ := testRetryScheduler(t, publisher)
+			ctx := context.Background()
+			if err := redisClient.ScheduleRetry(ctx, tt.entry, time.Now().Add(-time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			s.publishDue(ctx)
+
+			var want RetryEntry
+			if err := models.DecodeJSON([]byte(tt.entry), &want); err != nil {
+				t.Fatal(err)
+			}
+			wantVars, _ := json.Marshal(want.Message.Variables)
+			if len(publisher.bodies) != 1 {
+				t.Fatalf("published %d messages, want 1", len(publisher.bodies))
+			}
+			var got models.NotificationMessage
+			if err := models.DecodeJSON(publisher.bodies[0], &got); err != nil {
+				t.Fatal(err)
+			}
+			gotVars, _ := json.Marshal(got.Variables)
+			if string(gotVars) != string(wantVars) {
+				t.Errorf("variables = %s, want %s", gotVars, wantVars)
+			}
+		})
+	}
+}
+
+// recordingPublisher keeps the JSON of every message it publishes
+type recordingPublisher struct {
+	bodies [][]byte
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, _ string, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	p.bodies = append(p.bodies, body)
+	return nil
+}
+
+func TestHandleFailed(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantScheduled bool
+		wantParked    bool
+	}{
+		{
+			name:          "scheduled",
+			body:          `{"original_payload":{"notification_id":"n1","type":"email","retry_count":0,"max_retries":3},"error":"smtp timeout"}`,
+			wantScheduled: true,
+		},
+		{
+			name:       "retries exhausted",
+			body:       `{"original_payload":{"notification_id":"n1","type":"email","retry_count":3,"max_retries":3},"error":"smtp timeout"}`,
+			wantParked: true,
+		},
+		{
+			name:       "permanent failure",
+			body:       `{"original_payload":{"notification_id":"n1","type":"push","retry_count":0,"max_retries":3},"error":"invalid device token","permanent":true}`,
+			wantParked: true,
+		},
+		{
+			name:       "undecodable",
+			body:       `{"original_payload":{}}`,
+			wantParked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, mr := testRetryScheduler(t, &flakyPublisher{})
+			ack := &ackRecorder{}
+			s.handleFailed(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte(tt.body)})
+
+			if ack.outcome != "ack" {
+				t.Errorf("delivery outcome = %q, want ack", ack.outcome)
+			}
+			scheduled, _ := mr.ZMembers(testScheduledKey)
+			if got := len(scheduled) == 1; got != tt.wantScheduled {
+				t.Errorf("scheduled = %v, want entry scheduled %v", scheduled, tt.wantScheduled)
+			}
+			parked, _ := mr.List(testParkedKey)
+			if got := len(parked) == 1; got != tt.wantParked {
+				t.Errorf("parked = %v, want entry parked %v", parked, tt.wantParked)
+			}
+		})
+	}
+}
+
+func TestIsPermanentFailure(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"original_payload":{},"permanent":true}`, true},
+		{`{"original_payload":{},"permanent":false}`, false},
+		{`{"original_payload":{}}`, false},
+		{`{not json`, false},
+	}
+	for _, tt := range tests {
+		if got := IsPermanentFailure([]byte(tt.body)); got != tt.want {
+			t.Errorf("IsPermanentFailure(%s) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleAlertsOncePerNotification(t *testing.T) {
+	tests := []struct {
+		name        string
+		threshold   int
+		retryCounts []int
+		wantAlerts  float64
+	}{
+		{name: "disabled", threshold: 0, retryCounts: []int{0, 1, 2}},
+		{name: "below threshold", threshold: 2, retryCounts: []int{0, 1}},
+		{name: "reaches threshold", threshold: 2, retryCounts: []int{0, 1, 2}, wantAlerts: 1},
+		{name: "fails past threshold", threshold: 1, retryCounts: []int{1, 2, 3}, wantAlerts: 1},
+		{name: "arrives above threshold", threshold: 1, retryCounts: []int{2}, wantAlerts: 1},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, _ := testRetryScheduler(t, &flakyPublisher{})
+			s.SetAlertThreshold(tt.threshold)
+			template := fmt.Sprintf("alert-test-%d", i)
+			counter := metrics.RetryAlerts.WithLabelValues(template)
+			before := counterValue(t, counter)
+
+			for _, n := range tt.retryCounts {
+				msg := models.NotificationMessage{NotificationID: "n1", Type: models.NotificationTypeEmail, TemplateID: template, RetryCount: n, MaxRetries: 3}
+				if err := s.Schedule(context.Background(), "email", msg, "smtp timeout"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := counterValue(t, counter) - before; got != tt.wantAlerts {
+				t.Errorf("alerts = %v, want %v", got, tt.wantAlerts)
+			}
+		})
+	}
+}
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := counter.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
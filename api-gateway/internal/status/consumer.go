@@ -0,0 +1,41 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+type Applier interface {
+	ApplyStatusUpdate(ctx context.Context, update models.StatusUpdate) error
+}
+
+// Consumer applies status updates that workers publish to the status queue.
+type Consumer struct {
+	applier Applier
+}
+
+func NewConsumer(applier Applier) *Consumer {
+	return &Consumer{
+		applier: applier,
+	}
+}
+
+// Handle processes one queue message. Malformed updates are dropped since
+// redelivery can't fix them; apply failures are returned so the message
+// reappears after its visibility timeout.
+func (c *Consumer) Handle(ctx context.Context, body []byte) error {
+	var update models.StatusUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		log.Printf("Dropping malformed status update: %v", err)
+		return nil
+	}
+	if update.NotificationID == "" || update.Status == "" {
+		log.Printf("Dropping status update without notification_id or status")
+		return nil
+	}
+
+	return c.applier.ApplyStatusUpdate(ctx, update)
+}
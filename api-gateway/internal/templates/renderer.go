@@ -0,0 +1,104 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/tobey0x/api-gateway/internal/models"
+)
+
+// MaxOutputBytes bounds the rendered subject or body
+const MaxOutputBytes = 256 << 10
+
+var (
+	// ErrMissingVariable means the template referenced a variable the
+	// request did not supply
+	ErrMissingVariable = errors.New("missing template variable")
+	errOutputTooLarge  = fmt.Errorf("rendered output exceeds %d bytes", MaxOutputBytes)
+)
+
+// executor is satisfied by both text/template and html/template
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Check parses text the way Render would, so malformed templates are
+// rejected when the config is loaded rather than on first use.
+func Check(name, text string, html bool) error {
+	_, err := parse(name, text, html)
+	return err
+}
+
+// Render produces the subject and body for variables. Variables are only
+// ever data: their values are inserted, never parsed as template syntax,
+// and with html the body is escaped for its HTML context. References to
+// variables that weren't supplied wrap ErrMissingVariable.
+func Render(subject, body string, html bool, variables map[string]interface{}) (*models.RenderedContent, error) {
+	renderedSubject, err := render("subject", subject, false, variables)
+	if err != nil {
+		return nil, err
+	}
+	renderedBody, err := render("body", body, html, variables)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RenderedContent{Subject: renderedSubject, Body: renderedBody}, nil
+}
+
+func render(name, text string, html bool, variables map[string]interface{}) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := parse(name, text, html)
+	if err != nil {
+		return "", err
+	}
+
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+	out := &limitedBuilder{limit: MaxOutputBytes}
+	if err := tmpl.Execute(out, variables); err != nil {
+		if errors.Is(err, errOutputTooLarge) {
+			return "", fmt.Errorf("%s: %w", name, errOutputTooLarge)
+		}
+		if strings.Contains(err.Error(), "map has no entry for key") {
+			return "", fmt.Errorf("%w: %s: %v", ErrMissingVariable, name, err)
+		}
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return out.String(), nil
+}
+
+func parse(name, text string, html bool) (executor, error) {
+	if html {
+		tmpl, err := htmltemplate.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", name, err)
+		}
+		return tmpl, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// limitedBuilder fails writes past limit so a template can't expand into
+// an unbounded message (e.g. ranging over a huge variable)
+type limitedBuilder struct {
+	strings.Builder
+	limit int
+}
+
+func (b *limitedBuilder) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errOutputTooLarge
+	}
+	return b.Builder.Write(p)
+}
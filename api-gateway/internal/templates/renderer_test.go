@@ -0,0 +1,138 @@
+package templates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		subject     string
+		body        string
+		html        bool
+		variables   map[string]interface{}
+		wantSubject string
+		wantBody    string
+	}{
+		{
+			name:        "text",
+			subject:     "Welcome, {{.name}}",
+			body:        "Hi {{.name}}, your code is {{.code}}.",
+			variables:   map[string]interface{}{"name": "Ada", "code": 1234},
+			wantSubject: "Welcome, Ada",
+			wantBody:    "Hi Ada, your code is 1234.",
+		},
+		{
+			name:        "html escapes the body only",
+			subject:     "Hello {{.name}}",
+			body:        "<p>Hello {{.name}}</p>",
+			html:        true,
+			variables:   map[string]interface{}{"name": "<b>Ada</b>"},
+			wantSubject: "Hello <b>Ada</b>",
+			wantBody:    "<p>Hello &lt;b&gt;Ada&lt;/b&gt;</p>",
+		},
+		{
+			name:        "variables are data, not templates",
+			subject:     "{{.name}}",
+			body:        "{{.name}}",
+			variables:   map[string]interface{}{"name": "{{.secret}}"},
+			wantSubject: "{{.secret}}",
+			wantBody:    "{{.secret}}",
+		},
+		{
+			name:      "empty templates",
+			variables: map[string]interface{}{"name": "Ada"},
+		},
+		{
+			name:        "no variables",
+			subject:     "Static subject",
+			body:        "Static body",
+			wantSubject: "Static subject",
+			wantBody:    "Static body",
+		},
+		{
+			name:        "optional variable guarded by if",
+			subject:     "Hi",
+			body:        `{{if .nickname}}{{.nickname}}{{else}}friend{{end}}`,
+			variables:   map[string]interface{}{"nickname": ""},
+			wantSubject: "Hi",
+			wantBody:    "friend",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.subject, tt.body, tt.html, tt.variables)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Subject != tt.wantSubject || got.Body != tt.wantBody {
+				t.Errorf("Render = %q / %q, want %q / %q", got.Subject, got.Body, tt.wantSubject, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRenderMissingVariable(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		body    string
+		html    bool
+		want    string
+	}{
+		{name: "in subject", subject: "Hi {{.name}}", body: "ok", want: "subject"},
+		{name: "in text body", subject: "Hi", body: "Code {{.code}}", want: "body"},
+		{name: "in html body", subject: "Hi", body: "<p>{{.code}}</p>", html: true, want: "body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Render(tt.subject, tt.body, tt.html, map[string]interface{}{"other": "x"})
+			if !errors.Is(err, ErrMissingVariable) {
+				t.Fatalf("Render = %v, want ErrMissingVariable", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q doesn't name the %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMalformedTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		html bool
+	}{
+		{name: "unclosed action", text: "Hi {{.name"},
+		{name: "unknown function", text: "{{shout .name}}"},
+		{name: "unterminated if", text: "{{if .name}}yes"},
+		{name: "html unclosed action", text: "<p>{{.name</p>", html: true},
+	}
+
+	variables := map[string]interface{}{"name": "Ada"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check("body", tt.text, tt.html); err == nil {
+				t.Error("Check accepted a malformed template")
+			}
+			if _, err := Render("Hi", tt.text, tt.html, variables); err == nil || !strings.Contains(err.Error(), "invalid body template") {
+				t.Errorf("Render with malformed body = %v, want an invalid body template error", err)
+			}
+			if _, err := Render(tt.text, "ok", false, variables); err == nil || !strings.Contains(err.Error(), "invalid subject template") {
+				t.Errorf("Render with malformed subject = %v, want an invalid subject template error", err)
+			}
+		})
+	}
+}
+
+func TestRenderOutputLimit(t *testing.T) {
+	big := strings.Repeat("x", MaxOutputBytes/2+1)
+	_, err := Render("Hi", "{{.a}}{{.a}}", false, map[string]interface{}{"a": big})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Render = %v, want an output size error", err)
+	}
+}
@@ -0,0 +1,334 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/metrics"
+	"github.com/tobey0x/api-gateway/internal/models"
+	"github.com/tobey0x/api-gateway/internal/netutil"
+)
+
+// Lifecycle events a subscription can select
+const (
+	EventQueued  = "queued"
+	EventSent    = "sent"
+	EventFailed  = "failed"
+	EventExpired = "expired"
+)
+
+var Events = []string{EventQueued, EventSent, EventFailed, EventExpired}
+
+// AllUsers is the owner of admin subscriptions that receive every user's
+// events
+const AllUsers = "*"
+
+const (
+	// SignatureHeader carries "t=<unix>,v1=<hex>", an HMAC-SHA256 of
+	// "<t>.<body>" keyed by the subscription secret
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	tickInterval = time.Second
+	batchSize    = 100
+)
+
+// EventForStatus maps a notification status to its lifecycle event, or ""
+// for statuses no one can subscribe to.
+func EventForStatus(status string) string {
+	switch status {
+	case models.StatusPending, models.StatusQueuedOutbox:
+		return EventQueued
+	case models.StatusSent:
+		return EventSent
+	case models.StatusFailed:
+		return EventFailed
+	case models.StatusExpired:
+		return EventExpired
+	}
+	return ""
+}
+
+type Subscription struct {
+	ID     string   `json:"id"`
+	Owner  string   `json:"owner"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret signs deliveries; it is only shown when the subscription is
+	// created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s Subscription) Wants(event string) bool {
+	return slices.Contains(s.Events, event)
+}
+
+// Event is the body posted to subscribers
+type Event struct {
+	ID             string    `json:"id"`
+	Event          string    `json:"event"`
+	NotificationID string    `json:"notification_id"`
+	UserID         string    `json:"user_id"`
+	Type           string    `json:"type"`
+	TemplateID     string    `json:"template_id,omitempty"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	ErrorMessage   string    `json:"error_message,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// delivery is one event bound for one subscription. The subscription is
+// looked up again on each attempt, so deleting it stops pending retries.
+type delivery struct {
+	Owner          string `json:"owner"`
+	SubscriptionID string `json:"subscription_id"`
+	Event          Event  `json:"event"`
+	Attempt        int    `json:"attempt"`
+	LastError      string `json:"last_error,omitempty"`
+}
+
+// Store holds subscriptions, keyed by owner, and scheduled deliveries
+// ordered by due time.
+type Store interface {
+	SaveWebhookSubscription(ctx context.Context, owner, id, entry string) error
+	GetWebhookSubscription(ctx context.Context, owner, id string) (string, error)
+	ListWebhookSubscriptions(ctx context.Context, owner string) ([]string, error)
+	ScheduleWebhook(ctx context.Context, entry string, at time.Time) error
+	// PopDueWebhooks atomically removes and returns deliveries due by now.
+	PopDueWebhooks(ctx context.Context, now time.Time, limit int64) ([]string, error)
+	// DeadLetterWebhook keeps deliveries that exhausted their attempts.
+	DeadLetterWebhook(ctx context.Context, entry string) error
+}
+
+// Emitter fans lifecycle events out to matching subscriptions and delivers
+// them with exponential backoff, dead-lettering after maxAttempts.
+type Emitter struct {
+	store       Store
+	httpClient  *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func NewEmitter(store Store, timeout time.Duration, maxAttempts int, baseDelay, maxDelay time.Duration) *Emitter {
+	// Subscribers choose the URL, so refuse to connect anywhere internal.
+	// No proxy: it would be the address checked, not the subscriber's.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout: timeout,
+		Control: netutil.PublicAddressOnly,
+	}).DialContext
+
+	return &Emitter{
+		store: store,
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// A redirect could point a signed event somewhere unintended
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+	}
+}
+
+// Emit schedules the event for every subscription of the notification's
+// user, and every admin subscription, that selected it. It only touches
+// Redis; delivery happens in Run.
+func (e *Emitter) Emit(ctx context.Context, event Event) {
+	if event.Event == "" {
+		return
+	}
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+
+	for _, owner := range []string{event.UserID, AllUsers} {
+		subs, err := e.subscriptions(ctx, owner)
+		if err != nil {
+			log.Printf("Failed to load webhook subscriptions for %s: %v", owner, err)
+			continue
+		}
+		for _, sub := range subs {
+			if !sub.Wants(event.Event) {
+				continue
+			}
+			if err := e.schedule(ctx, delivery{Owner: owner, SubscriptionID: sub.ID, Event: event}, time.Now()); err != nil {
+				log.Printf("Failed to schedule webhook %s for notification %s: %v", sub.ID, event.NotificationID, err)
+			}
+		}
+	}
+}
+
+func (e *Emitter) subscriptions(ctx context.Context, owner string) ([]Subscription, error) {
+	raw, err := e.store.ListWebhookSubscriptions(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]Subscription, 0, len(raw))
+	for _, r := range raw {
+		var sub Subscription
+		if err := json.Unmarshal([]byte(r), &sub); err != nil {
+			log.Printf("Skipping corrupt webhook subscription for %s: %v", owner, err)
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (e *Emitter) schedule(ctx context.Context, d delivery, at time.Time) error {
+	entry, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook delivery: %w", err)
+	}
+	return e.store.ScheduleWebhook(ctx, string(entry), at)
+}
+
+func (e *Emitter) backoff(attempt int) time.Duration {
+	delay := e.baseDelay
+	for i := 1; i < attempt && delay < e.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, e.maxDelay)
+}
+
+// Run delivers due webhooks every tick until ctx is cancelled.
+func (e *Emitter) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.deliverDue(ctx)
+		}
+	}
+}
+
+func (e *Emitter) deliverDue(ctx context.Context) {
+	entries, err := e.store.PopDueWebhooks(ctx, time.Now(), batchSize)
+	if err != nil {
+		log.Printf("Failed to pop due webhooks: %v", err)
+		return
+	}
+
+	// Deliver concurrently so one slow subscriber doesn't hold up the rest
+	var wg sync.WaitGroup
+	for _, raw := range entries {
+		var d delivery
+		if err := json.Unmarshal([]byte(raw), &d); err != nil {
+			log.Printf("Dead-lettering malformed webhook delivery: %v", err)
+			_ = e.store.DeadLetterWebhook(ctx, raw)
+			continue
+		}
+		wg.Go(func() { e.attempt(ctx, d) })
+	}
+	wg.Wait()
+}
+
+// attempt makes one delivery attempt and then reschedules or dead-letters
+// it on failure.
+func (e *Emitter) attempt(ctx context.Context, d delivery) {
+	raw, err := e.store.GetWebhookSubscription(ctx, d.Owner, d.SubscriptionID)
+	if errors.Is(err, cache.ErrWebhookNotFound) {
+		return
+	}
+	if err != nil {
+		// The store, not the subscriber, failed; don't spend an attempt
+		log.Printf("Failed to load webhook subscription %s, rescheduling: %v", d.SubscriptionID, err)
+		_ = e.schedule(ctx, d, time.Now().Add(e.baseDelay))
+		return
+	}
+	var sub Subscription
+	if err := json.Unmarshal([]byte(raw), &sub); err != nil {
+		log.Printf("Dropping webhook delivery for corrupt subscription %s: %v", d.SubscriptionID, err)
+		return
+	}
+
+	d.Attempt++
+	err = e.post(ctx, sub, d.Event)
+	if err == nil {
+		metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+		return
+	}
+
+	d.LastError = err.Error()
+	if d.Attempt >= e.maxAttempts {
+		log.Printf("Webhook %s for notification %s failed %d times, dead-lettering: %v", sub.ID, d.Event.NotificationID, d.Attempt, err)
+		metrics.WebhookDeliveries.WithLabelValues("dead").Inc()
+		if entry, err := json.Marshal(d); err == nil {
+			_ = e.store.DeadLetterWebhook(ctx, string(entry))
+		}
+		return
+	}
+
+	metrics.WebhookDeliveries.WithLabelValues("retry").Inc()
+	if err := e.schedule(ctx, d, time.Now().Add(e.backoff(d.Attempt))); err != nil {
+		log.Printf("Failed to reschedule webhook %s for notification %s: %v", sub.ID, d.Event.NotificationID, err)
+	}
+}
+
+// post sends one signed event. Any 2xx response is a success.
+func (e *Emitter) post(ctx context.Context, sub Subscription, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Event)
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body, time.Now()))
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("subscriber returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body sent at now. Receivers
+// recompute the HMAC over "<t>.<body>" and should reject stale t values.
+func Sign(secret string, body []byte, now time.Time) string {
+	t := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
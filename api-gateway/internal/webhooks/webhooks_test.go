@@ -0,0 +1,330 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tobey0x/api-gateway/internal/cache"
+	"github.com/tobey0x/api-gateway/internal/netutil"
+)
+
+// memoryStore is an in-memory Store that keeps scheduled entries in order
+// with their due times
+type memoryStore struct {
+	mu        sync.Mutex
+	subs      map[string]map[string]string
+	scheduled []scheduledEntry
+	dead      []string
+}
+
+type scheduledEntry struct {
+	entry string
+	at    time.Time
+}
+
+func newMemoryStore(subs ...Subscription) *memoryStore {
+	s := &memoryStore{subs: map[string]map[string]string{}}
+	for _, sub := range subs {
+		raw, _ := json.Marshal(sub)
+		_ = s.SaveWebhookSubscription(context.Background(), sub.Owner, sub.ID, string(raw))
+	}
+	return s
+}
+
+func (s *memoryStore) SaveWebhookSubscription(_ context.Context, owner, id, entry string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[owner] == nil {
+		s.subs[owner] = map[string]string{}
+	}
+	s.subs[owner][id] = entry
+	return nil
+}
+
+func (s *memoryStore) GetWebhookSubscription(_ context.Context, owner, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.subs[owner][id]
+	if !ok {
+		return "", cache.ErrWebhookNotFound
+	}
+	return entry, nil
+}
+
+func (s *memoryStore) ListWebhookSubscriptions(_ context.Context, owner string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []string
+	for _, entry := range s.subs[owner] {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *memoryStore) ScheduleWebhook(_ context.Context, entry string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scheduled = append(s.scheduled, scheduledEntry{entry: entry, at: at})
+	return nil
+}
+
+func (s *memoryStore) PopDueWebhooks(_ context.Context, now time.Time, limit int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []string
+	var rest []scheduledEntry
+	for _, e := range s.scheduled {
+		if !e.at.After(now) && int64(len(due)) < limit {
+			due = append(due, e.entry)
+			continue
+		}
+		rest = append(rest, e)
+	}
+	s.scheduled = rest
+	return due, nil
+}
+
+func (s *memoryStore) DeadLetterWebhook(_ context.Context, entry string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead = append(s.dead, entry)
+	return nil
+}
+
+// popScheduled removes and decodes every scheduled delivery regardless
+// of due time, returning when each was due
+func (s *memoryStore) popScheduled(t *testing.T) ([]delivery, []time.Time) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deliveries []delivery
+	var due []time.Time
+	for _, e := range s.scheduled {
+		var d delivery
+		if err := json.Unmarshal([]byte(e.entry), &d); err != nil {
+			t.Fatal(err)
+		}
+		deliveries = append(deliveries, d)
+		due = append(due, e.at)
+	}
+	s.scheduled = nil
+	return deliveries, due
+}
+
+func TestEmitSchedulesMatchingSubscriptions(t *testing.T) {
+	store := newMemoryStore(
+		Subscription{ID: "user-sent", Owner: "user-1", Events: []string{EventSent, EventFailed}},
+		Subscription{ID: "user-queued", Owner: "user-1", Events: []string{EventQueued}},
+		Subscription{ID: "other-user", Owner: "user-2", Events: []string{EventSent}},
+		Subscription{ID: "admin-sent", Owner: AllUsers, Events: []string{EventSent}},
+		Subscription{ID: "admin-expired", Owner: AllUsers, Events: []string{EventExpired}},
+	)
+
+	tests := []struct {
+		name  string
+		event Event
+		want  []string
+	}{
+		{name: "user and admin subscriptions", event: Event{Event: EventSent, UserID: "user-1"}, want: []string{"admin-sent", "user-sent"}},
+		{name: "only the selected event", event: Event{Event: EventQueued, UserID: "user-1"}, want: []string{"user-queued"}},
+		{name: "admin only", event: Event{Event: EventExpired, UserID: "user-1"}, want: []string{"admin-expired"}},
+		{name: "user without subscriptions", event: Event{Event: EventFailed, UserID: "user-3"}},
+		{name: "no event", event: Event{UserID: "user-1"}},
+	}
+
+	emitter := NewEmitter(store, time.Second, 3, time.Second, time.Minute)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emitter.Emit(context.Background(), tt.event)
+
+			deliveries, _ := store.popScheduled(t)
+			var got []string
+			for _, d := range deliveries {
+				got = append(got, d.SubscriptionID)
+				if d.Event.ID == "" {
+					t.Errorf("delivery for %s has no event ID", d.SubscriptionID)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("scheduled %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWants(t *testing.T) {
+	sub := Subscription{Events: []string{EventSent, EventFailed}}
+	for event, want := range map[string]bool{EventSent: true, EventFailed: true, EventQueued: false, EventExpired: false, "": false} {
+		if got := sub.Wants(event); got != want {
+			t.Errorf("Wants(%q) = %v, want %v", event, got, want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	emitter := NewEmitter(newMemoryStore(), time.Second, 10, time.Second, 10*time.Second)
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 5, want: 10 * time.Second},
+		{attempt: 50, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := emitter.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestAttemptRetriesThenDeadLetters(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sub := Subscription{ID: "sub-1", Owner: "user-1", URL: srv.URL, Events: []string{EventFailed}, Secret: "secret"}
+	store := newMemoryStore(sub)
+	emitter := NewEmitter(store, time.Second, 3, time.Second, time.Minute)
+	emitter.httpClient = srv.Client()
+
+	d := delivery{Owner: sub.Owner, SubscriptionID: sub.ID, Event: Event{ID: "event-1", Event: EventFailed}}
+	for attempt := 1; attempt < 3; attempt++ {
+		before := time.Now()
+		emitter.attempt(context.Background(), d)
+
+		deliveries, due := store.popScheduled(t)
+		if len(deliveries) != 1 {
+			t.Fatalf("attempt %d: %d deliveries rescheduled, want 1", attempt, len(deliveries))
+		}
+		d = deliveries[0]
+		if d.Attempt != attempt || d.LastError == "" {
+			t.Errorf("attempt %d: rescheduled with attempt %d, last error %q", attempt, d.Attempt, d.LastError)
+		}
+		if delay := due[0].Sub(before); delay < emitter.backoff(attempt) || delay > emitter.backoff(attempt)+time.Second {
+			t.Errorf("attempt %d: rescheduled %v later, want %v", attempt, delay, emitter.backoff(attempt))
+		}
+	}
+
+	emitter.attempt(context.Background(), d)
+	if deliveries, _ := store.popScheduled(t); len(deliveries) != 0 {
+		t.Errorf("final attempt rescheduled %d deliveries, want 0", len(deliveries))
+	}
+	if len(store.dead) != 1 {
+		t.Fatalf("%d dead-lettered deliveries, want 1", len(store.dead))
+	}
+	var dead delivery
+	if err := json.Unmarshal([]byte(store.dead[0]), &dead); err != nil {
+		t.Fatal(err)
+	}
+	if dead.Attempt != 3 || !strings.Contains(dead.LastError, "500") {
+		t.Errorf("dead-lettered attempt %d with error %q, want 3 and a 500", dead.Attempt, dead.LastError)
+	}
+	if requests != 3 {
+		t.Errorf("subscriber got %d requests, want 3", requests)
+	}
+}
+
+func TestAttemptDeliversSignedEvent(t *testing.T) {
+	var got struct {
+		body                 []byte
+		event, id, signature string
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.body, _ = io.ReadAll(r.Body)
+		got.event = r.Header.Get(EventHeader)
+		got.id = r.Header.Get(DeliveryHeader)
+		got.signature = r.Header.Get(SignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sub := Subscription{ID: "sub-1", Owner: "user-1", URL: srv.URL, Events: []string{EventSent}, Secret: "secret"}
+	store := newMemoryStore(sub)
+	emitter := NewEmitter(store, time.Second, 3, time.Second, time.Minute)
+	emitter.httpClient = srv.Client()
+
+	emitter.attempt(context.Background(), delivery{Owner: sub.Owner, SubscriptionID: sub.ID, Event: Event{ID: "event-1", Event: EventSent}})
+
+	if deliveries, _ := store.popScheduled(t); len(deliveries) != 0 || len(store.dead) != 0 {
+		t.Errorf("successful delivery left %d scheduled and %d dead", len(deliveries), len(store.dead))
+	}
+	if got.event != EventSent || got.id != "event-1" {
+		t.Errorf("headers event %q, delivery %q; want %q, %q", got.event, got.id, EventSent, "event-1")
+	}
+	ts, _, ok := strings.Cut(strings.TrimPrefix(got.signature, "t="), ",")
+	if !ok {
+		t.Fatalf("malformed signature %q", got.signature)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(ts + "." + string(got.body)))
+	if want := "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil)); got.signature != want {
+		t.Errorf("signature %q does not verify, want %q", got.signature, want)
+	}
+}
+
+func TestAttemptSkipsDeletedSubscription(t *testing.T) {
+	store := newMemoryStore()
+	emitter := NewEmitter(store, time.Second, 3, time.Second, time.Minute)
+
+	emitter.attempt(context.Background(), delivery{Owner: "user-1", SubscriptionID: "gone", Event: Event{Event: EventSent}})
+
+	if deliveries, _ := store.popScheduled(t); len(deliveries) != 0 || len(store.dead) != 0 {
+		t.Errorf("deleted subscription left %d scheduled and %d dead", len(deliveries), len(store.dead))
+	}
+}
+
+func TestSign(t *testing.T) {
+	now := time.Unix(1731320000, 0)
+	body := []byte(`{"event":"sent"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1731320000." + string(body)))
+	want := "t=1731320000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("secret", body, now); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+	if Sign("other", body, now) == want {
+		t.Error("signature doesn't depend on the secret")
+	}
+	if Sign("secret", body, now.Add(time.Second)) == want {
+		t.Error("signature doesn't depend on the timestamp")
+	}
+}
+
+func TestPostRefusesInternalAddresses(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	emitter := NewEmitter(newMemoryStore(), time.Second, 3, time.Second, time.Minute)
+	err := emitter.post(context.Background(), Subscription{URL: srv.URL, Secret: "secret"}, Event{Event: EventSent})
+	if !errors.Is(err, netutil.ErrNonPublicAddress) {
+		t.Errorf("post to %s = %v, want ErrNonPublicAddress", srv.URL, err)
+	}
+	if requests != 0 {
+		t.Errorf("loopback subscriber got %d requests, want 0", requests)
+	}
+}
@@ -4,6 +4,7 @@ Consumes raw JSON messages from email.queue and converts them to Celery tasks.
 This bridges the gap between API Gateway's raw JSON publishing and Celery's task format.
 """
 import pika
+import gzip
 import json
 import os
 import time
@@ -28,9 +29,16 @@ def signal_handler(sig, frame):
 signal.signal(signal.SIGINT, signal_handler)
 signal.signal(signal.SIGTERM, signal_handler)
 
+def decode_body(properties, body):
+    """Inflate bodies the API Gateway gzipped before publishing"""
+    if properties.content_encoding == "gzip":
+        return gzip.decompress(body)
+    return body
+
 def callback(ch, method, properties, body):
     """Process incoming messages and invoke Celery task"""
     try:
+        body = decode_body(properties, body)
         message = json.loads(body.decode())
         
         # Handle case where message might be a list (unwrap if needed)
@@ -78,7 +86,7 @@ def callback(ch, method, properties, body):
         
     except Exception as e:
         print(f"[ERROR] Failed to process message: {e}")
-        print(f"[DEBUG] Raw message body: {body.decode()[:500]}")  # First 500 chars
+        print(f"[DEBUG] Raw message body: {body.decode(errors='replace')[:500]}")  # First 500 chars
         import traceback
         traceback.print_exc()
         # Negative ack - requeue the message
@@ -2,6 +2,7 @@
 Object.defineProperty(exports, "__esModule", { value: true });
 exports.closeConnection = exports.getChannel = exports.connectToRabbitMQ = void 0;
 const amqplib_1 = require("amqplib");
+const zlib_1 = require("zlib");
 const logger_1 = require("../utils/logger");
 const queue_service_1 = require("../services/queue.service");
 let channel = null;
@@ -115,6 +116,13 @@ const setupQueues = async (ch) => {
         throw error;
     }
 };
+/**
+ * Returns the message body as text, inflating bodies the API Gateway gzipped
+ */
+const decodeContent = (msg) => {
+    const content = msg.properties.contentEncoding === 'gzip' ? (0, zlib_1.gunzipSync)(msg.content) : msg.content;
+    return content.toString();
+};
 /**
  * Sets up the message consumer
  */
@@ -128,7 +136,7 @@ const setupConsumer = async (ch) => {
             const messageId = msg.properties.messageId || 'unknown';
             const startTime = Date.now();
             try {
-                const message = JSON.parse(msg.content.toString());
+                const message = JSON.parse(decodeContent(msg));
                 logger_1.logger.info(`Processing message ${messageId}`, { messageId });
                 await (0, queue_service_1.processPushNotification)(message);
                 channel.ack(msg);
@@ -1,4 +1,5 @@
 import { Channel, connect, ConsumeMessage, Connection as AmqpConnection, Options } from 'amqplib';
+import { gunzipSync } from 'zlib';
 
 // Use the base AmqpConnection type but add the close method
 type Connection = AmqpConnection & {
@@ -134,6 +135,14 @@ const setupQueues = async (ch: Channel): Promise<void> => {
   }
 };
 
+/**
+ * Returns the message body as text, inflating bodies the API Gateway gzipped
+ */
+const decodeContent = (msg: ConsumeMessage): string => {
+  const content = msg.properties.contentEncoding === 'gzip' ? gunzipSync(msg.content) : msg.content;
+  return content.toString();
+};
+
 /**
  * Sets up the message consumer
  */
@@ -151,7 +160,7 @@ const setupConsumer = async (ch: Channel): Promise<void> => {
         const startTime = Date.now();
         
         try {
-          const message = JSON.parse(msg.content.toString());
+          const message = JSON.parse(decodeContent(msg));
           logger.info(`Processing message ${messageId}`, { messageId });
           
           await processPushNotification(message);